@@ -0,0 +1,49 @@
+// Package backoff computes jittered exponential delays between retries.
+package backoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff doubles the delay after every attempt, from Min up to Max. Each
+// delay is randomized between half and all of its nominal value so clients
+// that failed together do not retry in lockstep. The zero value retries
+// after roughly a second, backing off to a minute.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	attempt int
+}
+
+// Next returns the delay before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	min, max := b.Min, b.Max
+	if min <= 0 {
+		min = time.Second
+	}
+	if max <= 0 {
+		max = time.Minute
+	}
+	if max < min {
+		max = min
+	}
+
+	d := min
+	for i := 0; i < b.attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	b.attempt++
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// Reset starts over from Min, e.g. after a successful connection.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,36 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := &Backoff{Min: 100 * time.Millisecond, Max: time.Second}
+
+	nominal := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, n := range nominal {
+		n *= time.Millisecond
+		d := b.Next()
+		if d < n/2 || d > n {
+			t.Errorf("Attempt %d: delay %v outside [%v, %v]", i, d, n/2, n)
+		}
+	}
+
+	b.Reset()
+	if d := b.Next(); d > 100*time.Millisecond {
+		t.Errorf("Expected delay <= 100ms after Reset, got %v", d)
+	}
+}
+
+func TestBackoff_Defaults(t *testing.T) {
+	b := &Backoff{}
+	for i := 0; i < 20; i++ {
+		if d := b.Next(); d > time.Minute {
+			t.Fatalf("Delay %v exceeds default max", d)
+		}
+	}
+	if d := b.Next(); d < 30*time.Second {
+		t.Errorf("Expected delay to reach the default max range, got %v", d)
+	}
+}
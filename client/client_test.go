@@ -2,9 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/morrowc/irc-bot/backoff"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	pbService "github.com/morrowc/irc-bot/proto/service"
@@ -42,6 +50,199 @@ func TestHandleMessage(t *testing.T) {
 	}
 }
 
+func TestChannelEvent(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.width = 80
+	cs.height = 24
+
+	cs.handleMessage(&pbService.IRCMessage{Id: 1, Channel: "#test", Sender: "alice", Content: "hi", Timestamp: timestamppb.Now()})
+	cs.addEvent("#test", &pbService.StreamEvent{Event: &pbService.StreamEvent_ChannelEvent{ChannelEvent: &pbService.ChannelEvent{
+		Id:        2,
+		Channel:   "#test",
+		Type:      pbService.ChannelEvent_KICK,
+		Actor:     "op",
+		Target:    "alice",
+		Reason:    "spam",
+		Timestamp: timestamppb.Now(),
+	}}})
+
+	if !strings.Contains(out.String(), "-!- alice was kicked from #test by op (spam)") {
+		t.Errorf("Expected kick to be rendered, got %s", out.String())
+	}
+	// Channel events count towards where we resume.
+	if got := cs.subscribeRequest().GetSubscribe().GetLastSeen()["#test"]; got != 2 {
+		t.Errorf("Expected last seen 2, got %d", got)
+	}
+}
+
+func TestQueryWindow(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.width = 80
+	cs.height = 24
+	cs.channels = []string{"#test"}
+	cs.currentChannel = "#test"
+
+	cs.handleMessage(&pbService.IRCMessage{Id: 1, Channel: "alice", Sender: "alice", Content: "psst", Timestamp: timestamppb.Now()})
+	if len(cs.channels) != 2 || cs.channels[1] != "alice" {
+		t.Fatalf("Expected a query window for alice, got %v", cs.channels)
+	}
+	if !strings.Contains(out.String(), "Opened query with alice") {
+		t.Errorf("Expected a notice about the new query, got %s", out.String())
+	}
+
+	out.Reset()
+	cs.nextChannel()
+	if !strings.Contains(out.String(), "[ Query: alice ]") || !strings.Contains(out.String(), "psst") {
+		t.Errorf("Expected the query window, got %s", out.String())
+	}
+}
+
+func TestNetworks(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.width = 80
+	cs.height = 24
+
+	cs.handleMessage(&pbService.IRCMessage{Id: 1, Channel: "#test", Sender: "alice", Content: "hi", Timestamp: timestamppb.Now()})
+	cs.handleMessage(&pbService.IRCMessage{Id: 1, Network: "libera", Channel: "#test", Sender: "bob", Content: "hey", Timestamp: timestamppb.Now()})
+	cs.handleMessage(&pbService.IRCMessage{Id: 2, Network: "libera", Channel: "carol", Sender: "carol", Content: "psst", Timestamp: timestamppb.Now()})
+	if want := []string{"#test", "libera/#test", "libera/carol"}; !slices.Equal(cs.channels, want) {
+		t.Fatalf("Expected windows %v, got %v", want, cs.channels)
+	}
+	// Each network resumes from its own IDs.
+	if got := cs.subscribeRequest().GetSubscribe().GetLastSeen(); got["#test"] != 1 || got["libera/#test"] != 1 || got["libera/carol"] != 2 {
+		t.Errorf("Expected last seen per network, got %v", got)
+	}
+
+	out.Reset()
+	cs.handleCommand("/network")
+	if !strings.Contains(out.String(), "Networks: *- libera") {
+		t.Errorf("Expected the network list, got %q", out.String())
+	}
+	cs.handleCommand("/network libera")
+	if cs.currentChannel != "libera/#test" {
+		t.Errorf("Expected libera/#test, got %q", cs.currentChannel)
+	}
+	cs.handleCommand("/network oftc")
+	if !strings.Contains(out.String(), "No windows on network oftc") || cs.currentChannel != "libera/#test" {
+		t.Errorf("Expected to stay on libera/#test, got %q", cs.currentChannel)
+	}
+
+	// Sends go to the network of the window.
+	stream := &fakeStream{hold: true}
+	cs.stream = stream
+	cs.sendText(cs.currentChannel, "hello", pbService.IRCMessage_PRIVMSG)
+	cs.handleCommand("/notice carol hi")
+	deadline := time.Now().Add(time.Second)
+	for len(stream.Sent()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for _, req := range stream.Sent() {
+		if m := req.GetSendMessage(); m.GetNetwork() != "libera" || (m.GetChannel() != "#test" && m.GetChannel() != "carol") {
+			t.Errorf("Expected a send on libera, got %v", m)
+		}
+	}
+
+	// Queued lines add up across networks.
+	cs.setQueued("", 2)
+	cs.setQueued("libera", 3)
+	if !strings.Contains(out.String(), "[ 5 queued ]") {
+		t.Errorf("Expected 5 queued lines, got %q", out.String())
+	}
+}
+
+func TestMessageKinds(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.width = 80
+	cs.height = 24
+
+	cs.handleMessage(&pbService.IRCMessage{Id: 1, Channel: "#test", Sender: "alice", Content: "waves", Kind: pbService.IRCMessage_ACTION, Timestamp: timestamppb.Now()})
+	cs.handleMessage(&pbService.IRCMessage{Id: 2, Channel: "#test", Sender: "bob", Content: "heads up", Kind: pbService.IRCMessage_NOTICE, Timestamp: timestamppb.Now()})
+	if !strings.Contains(out.String(), "* alice waves") || !strings.Contains(out.String(), "-bob- heads up") {
+		t.Errorf("Expected action and notice rendering, got %s", out.String())
+	}
+
+	// /me and /notice go out with the right kind.
+	stream := &fakeStream{hold: true}
+	cs.stream = stream
+	cs.handleCommand("/me waves back")
+	cs.handleCommand("/notice bob  got it, thanks")
+	deadline := time.Now().Add(time.Second)
+	for len(stream.Sent()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	got := map[pbService.IRCMessage_Kind]*pbService.SendMessageRequest{}
+	for _, req := range stream.Sent() {
+		got[req.GetSendMessage().GetKind()] = req.GetSendMessage()
+	}
+	if me := got[pbService.IRCMessage_ACTION]; me.GetChannel() != "#test" || me.GetMessage() != "waves back" {
+		t.Errorf("Expected action to #test, got %v", me)
+	}
+	if n := got[pbService.IRCMessage_NOTICE]; n.GetChannel() != "bob" || n.GetMessage() != "got it, thanks" {
+		t.Errorf("Expected notice to bob, got %v", n)
+	}
+}
+
+func TestSendAck(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.stream = &fakeStream{hold: true}
+
+	cs.sendText("#test", "one", pbService.IRCMessage_PRIVMSG)
+	cs.sendText("#nope", "two", pbService.IRCMessage_PRIVMSG)
+	if len(cs.pending) != 2 {
+		t.Fatalf("Expected 2 pending sends, got %v", cs.pending)
+	}
+
+	// Only failures are shown; either way the send is no longer pending.
+	cs.handleSendAck(&pbService.SendMessageResponse{Success: true, MessageId: 7, RequestId: "1"})
+	cs.handleSendAck(&pbService.SendMessageResponse{Error: "not in channel #nope", RequestId: "2"})
+	if got := out.String(); strings.Count(got, "Failed") != 1 || !strings.Contains(got, "Failed to send to #nope: not in channel #nope") {
+		t.Errorf("Expected one failure for #nope, got %q", got)
+	}
+	if len(cs.pending) != 0 {
+		t.Errorf("Expected no pending sends, got %v", cs.pending)
+	}
+}
+
+func TestNickPrompt(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.currentChannel = "libera/#go"
+
+	// Only the current network's nick is shown.
+	cs.setNick("", "bot")
+	if got := out.String(); !strings.HasSuffix(got, "\0338") || strings.Contains(got, "[bot]") {
+		t.Errorf("Expected no nick in the prompt, got %q", got)
+	}
+	cs.setNick("libera", "bot_")
+	if got := out.String(); !strings.Contains(got, "[bot_] > ") {
+		t.Errorf("Expected the nick in the prompt, got %q", got)
+	}
+	out.Reset()
+	cs.setNick("libera", "bot_")
+	if out.Len() != 0 {
+		t.Errorf("Expected no redraw for the same nick, got %q", out.String())
+	}
+}
+
+func TestTokenCreds(t *testing.T) {
+	md, err := tokenCreds("s3cret").GetRequestMetadata(context.Background())
+	if err != nil || md["authorization"] != "Bearer s3cret" {
+		t.Errorf("Expected a bearer token, got %v (err %v)", md, err)
+	}
+}
+
 func TestChannelSwitching(t *testing.T) {
 	out := new(bytes.Buffer)
 	cs := NewClientState()
@@ -137,3 +338,243 @@ func TestHandleCommand(t *testing.T) {
 		t.Error("Expected exit logic for /disconnect")
 	}
 }
+
+// fakeServiceClient implements the RPCs the client uses.
+type fakeServiceClient struct {
+	pbService.IRCServiceClient
+	historyReqs []*pbService.GetHistoryRequest
+	history     []*pbService.IRCMessage
+	state       *pbService.ChannelState
+	clients     []*pbService.AttachedClient
+
+	// StreamMessages hands out these in order, failing when it runs out.
+	mu      sync.Mutex
+	streams []*fakeStream
+	dials   int
+}
+
+func (f *fakeServiceClient) StreamMessages(ctx context.Context, opts ...grpc.CallOption) (pbService.IRCService_StreamMessagesClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dials++
+	if len(f.streams) == 0 {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	s := f.streams[0]
+	f.streams = f.streams[1:]
+	s.ctx = ctx
+	return s, nil
+}
+
+// fakeStream delivers events until they run out, then fails (or blocks until
+// the context is done if hold is set).
+type fakeStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	events []*pbService.StreamEvent
+	hold   bool
+
+	mu   sync.Mutex
+	sent []*pbService.StreamRequest
+}
+
+func (s *fakeStream) Send(req *pbService.StreamRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, req)
+	return nil
+}
+
+func (s *fakeStream) Recv() (*pbService.StreamEvent, error) {
+	s.mu.Lock()
+	if len(s.events) > 0 {
+		ev := s.events[0]
+		s.events = s.events[1:]
+		s.mu.Unlock()
+		return ev, nil
+	}
+	s.mu.Unlock()
+	if s.hold {
+		<-s.ctx.Done()
+		return nil, s.ctx.Err()
+	}
+	return nil, status.Error(codes.Unavailable, "transport is closing")
+}
+
+func (s *fakeStream) Sent() []*pbService.StreamRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pbService.StreamRequest(nil), s.sent...)
+}
+
+func (f *fakeServiceClient) GetHistory(ctx context.Context, req *pbService.GetHistoryRequest, opts ...grpc.CallOption) (*pbService.GetHistoryResponse, error) {
+	f.historyReqs = append(f.historyReqs, req)
+	return &pbService.GetHistoryResponse{Messages: f.history}, nil
+}
+
+func (f *fakeServiceClient) GetChannelState(ctx context.Context, req *pbService.GetChannelStateRequest, opts ...grpc.CallOption) (*pbService.ChannelState, error) {
+	if f.state == nil {
+		return nil, status.Error(codes.NotFound, "not in channel")
+	}
+	return f.state, nil
+}
+
+func (f *fakeServiceClient) ListClients(ctx context.Context, req *pbService.ListClientsRequest, opts ...grpc.CallOption) (*pbService.ListClientsResponse, error) {
+	return &pbService.ListClientsResponse{Clients: f.clients}, nil
+}
+
+func TestShowClients(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.width = 80
+	cs.height = 24
+	cs.client = &fakeServiceClient{clients: []*pbService.AttachedClient{
+		{Identity: "laptop", Address: "192.0.2.1:4000", Since: timestamppb.Now(), Sent: 7},
+		{Identity: "phone (token phone)", Address: "192.0.2.2:4000", Since: timestamppb.Now()},
+	}}
+
+	cs.showClients()
+	for _, want := range []string{"2 clients attached", "laptop from 192.0.2.1:4000", "(sent 7, dropped 0)", "phone (token phone) from 192.0.2.2:4000"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, got %s", want, out.String())
+		}
+	}
+}
+
+func TestChannelState(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.width = 80
+	cs.height = 24
+
+	cs.connStatus = ""
+	cs.setChannelState(&pbService.ChannelState{
+		Channel: "#test",
+		Topic:   "old topic",
+		Members: []*pbService.ChannelMember{{Nick: "op", Prefixes: "@"}, {Nick: "alice"}},
+	})
+	if cs.currentChannel != "#test" || !strings.Contains(out.String(), "[ 2 users ] old topic") {
+		t.Errorf("Expected #test with topic in the status bar, got %s", out.String())
+	}
+
+	// Topic changes update the status bar.
+	out.Reset()
+	cs.addEvent("#test", &pbService.StreamEvent{Event: &pbService.StreamEvent_ChannelEvent{ChannelEvent: &pbService.ChannelEvent{
+		Id: 1, Channel: "#test", Type: pbService.ChannelEvent_TOPIC, Actor: "op", Topic: "new topic", Timestamp: timestamppb.Now(),
+	}}})
+	if !strings.Contains(out.String(), "[ 2 users ] new topic") {
+		t.Errorf("Expected new topic in the status bar, got %s", out.String())
+	}
+
+	// So do lines waiting in the server's send queue.
+	out.Reset()
+	cs.setQueued("", 12)
+	if !strings.Contains(out.String(), "[ 2 users ] [ 12 queued ] new topic") {
+		t.Errorf("Expected the queue depth in the status bar, got %s", out.String())
+	}
+	cs.setQueued("", 0)
+
+	out.Reset()
+	cs.client = &fakeServiceClient{state: cs.chanState["#test"]}
+	cs.showNames("#test")
+	if !strings.Contains(out.String(), "2 users in #test: @op alice") {
+		t.Errorf("Expected names list, got %s", out.String())
+	}
+}
+
+func TestFetchOlder(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.width = 80
+	cs.height = 24
+
+	fake := &fakeServiceClient{
+		history: []*pbService.IRCMessage{
+			{Id: 3, Channel: "#test", Content: "older", Timestamp: timestamppb.Now()},
+			{Id: 4, Channel: "#test", Content: "old", Timestamp: timestamppb.Now()},
+		},
+	}
+	cs.client = fake
+	cs.handleMessage(&pbService.IRCMessage{Id: 5, Channel: "#test", Content: "new", Timestamp: timestamppb.Now()})
+
+	cs.fetchOlder("#test", 10)
+
+	if len(fake.historyReqs) != 1 || fake.historyReqs[0].GetCursor() != 5 {
+		t.Fatalf("Expected one request with cursor 5, got %v", fake.historyReqs)
+	}
+	msgs := cs.msgHistory["#test"]
+	if len(msgs) != 3 || msgs[0].GetMessage().GetContent() != "older" || msgs[2].GetMessage().GetContent() != "new" {
+		t.Errorf("Expected older messages prepended, got %v", msgs)
+	}
+}
+
+func TestResumeSubscription(t *testing.T) {
+	cs := NewClientState()
+	cs.out = new(bytes.Buffer)
+	cs.width = 80
+	cs.height = 24
+
+	cs.handleMessage(&pbService.IRCMessage{Id: 7, Channel: "#test", Content: "a", Timestamp: timestamppb.Now()})
+	cs.handleMessage(&pbService.IRCMessage{Id: 8, Channel: "#test", Content: "b", Timestamp: timestamppb.Now()})
+
+	// A replayed duplicate is ignored.
+	cs.handleMessage(&pbService.IRCMessage{Id: 8, Channel: "#test", Content: "b", Timestamp: timestamppb.Now()})
+	if len(cs.msgHistory["#test"]) != 2 {
+		t.Errorf("Expected duplicate to be dropped, got %d messages", len(cs.msgHistory["#test"]))
+	}
+
+	sub := cs.subscribeRequest().GetSubscribe()
+	if got := sub.GetLastSeen()["#test"]; got != 8 {
+		t.Errorf("Expected last seen 8 for #test, got %d", got)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	out := new(bytes.Buffer)
+	cs := NewClientState()
+	cs.out = out
+	cs.width = 80
+	cs.height = 24
+	cs.currentChannel = "#test"
+	cs.inputBuffer = []rune("draft")
+	cs.retry = backoff.Backoff{Min: time.Millisecond, Max: time.Millisecond}
+
+	first := &fakeStream{events: []*pbService.StreamEvent{
+		{Event: &pbService.StreamEvent_Message{Message: &pbService.IRCMessage{Id: 5, Channel: "#test", Content: "hi", Timestamp: timestamppb.Now()}}},
+	}}
+	second := &fakeStream{hold: true}
+	fake := &fakeServiceClient{streams: []*fakeStream{first, second}}
+	cs.client = fake
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cs.run(ctx)
+		close(done)
+	}()
+
+	// Wait for the second stream to subscribe.
+	deadline := time.Now().Add(time.Second)
+	for len(second.Sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	sent := second.Sent()
+	if len(sent) == 0 {
+		t.Fatal("Expected the client to resubscribe after losing the stream")
+	}
+	if got := sent[0].GetSubscribe().GetLastSeen()["#test"]; got != 5 {
+		t.Errorf("Expected resubscribe from last seen 5, got %d", got)
+	}
+	if !strings.Contains(out.String(), "disconnected") {
+		t.Error("Expected disconnected status in the status bar")
+	}
+	if string(cs.inputBuffer) != "draft" || cs.currentChannel != "#test" {
+		t.Errorf("Expected input and channel preserved, got %q in %s", string(cs.inputBuffer), cs.currentChannel)
+	}
+}
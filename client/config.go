@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+const (
+	defaultServerPort = 50051
+	defaultTimeFormat = "15:04"
+)
+
+// loadConfig reads the config file, which may be the server's own.
+func loadConfig(path string) (*pbConfig.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	config := &pbConfig.Config{}
+	if err := prototext.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	return config, nil
+}
+
+// clientConfig returns the client section of config with every unset field
+// filled in from the server's sections, or a default.
+func clientConfig(config *pbConfig.Config) *pbConfig.ClientConfig {
+	cc := &pbConfig.ClientConfig{}
+	if config.GetClient() != nil {
+		cc = proto.Clone(config.GetClient()).(*pbConfig.ClientConfig)
+	}
+	svc, tlsConfig := config.GetService(), config.GetTls()
+
+	if cc.ServerAddress == "" {
+		host := svc.GetHost()
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+			// The server listens everywhere; reach it locally.
+			host = "localhost"
+		}
+		port := int(svc.GetPort())
+		if port == 0 {
+			port = defaultServerPort
+		}
+		cc.ServerAddress = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	if cc.CaFile == "" {
+		cc.CaFile = tlsConfig.GetCaFile()
+	}
+	if cc.CertFile == "" {
+		cc.CertFile = tlsConfig.GetClientCertFile()
+	}
+	if cc.KeyFile == "" {
+		cc.KeyFile = tlsConfig.GetClientKeyFile()
+	}
+	if cc.Token == "" {
+		cc.Token = svc.GetClientPasskey()
+	}
+	if cc.InitialHistory <= 0 {
+		cc.InitialHistory = initialHistory
+	}
+	if cc.TimestampFormat == "" {
+		cc.TimestampFormat = defaultTimeFormat
+	}
+	if cc.StartChannel == "" && len(config.GetChannels()) > 0 {
+		cc.StartChannel = config.GetChannels()[0].GetName()
+	}
+	for _, n := range config.GetNetworks() {
+		if cc.StartChannel == "" && len(n.GetChannels()) > 0 {
+			cc.StartChannel = windowKey(n.GetName(), n.GetChannels()[0].GetName())
+		}
+	}
+	return cc
+}
+
+// registerFlags defines the flags that override the client config.
+func registerFlags(fs *flag.FlagSet) {
+	fs.String("server", "", "Server address, host:port")
+	fs.String("server-name", "", "Name to verify the server's certificate against")
+	fs.String("ca", "", "CA certificate file")
+	fs.String("cert", "", "Client certificate file")
+	fs.String("key", "", "Client key file")
+	fs.String("token-file", "", "File holding the bearer token (kept off the command line, where other users can see it)")
+	fs.Int("history", 0, "Messages per channel fetched on connect")
+	fs.String("timestamp-format", "", "Go time layout for scrollback")
+	fs.String("channel", "", "Channel to show first")
+}
+
+// applyFlags overrides cc with the flags that were given.
+func applyFlags(fs *flag.FlagSet, cc *pbConfig.ClientConfig) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		v := f.Value.String()
+		switch f.Name {
+		case "server":
+			cc.ServerAddress = v
+		case "server-name":
+			cc.ServerName = v
+		case "ca":
+			cc.CaFile = v
+		case "cert":
+			cc.CertFile = v
+		case "key":
+			cc.KeyFile = v
+		case "token-file":
+			data, ferr := os.ReadFile(v)
+			if ferr != nil {
+				err = fmt.Errorf("failed to read token file: %v", ferr)
+				return
+			}
+			cc.Token = strings.TrimSpace(string(data))
+		case "history":
+			n, _ := strconv.Atoi(v)
+			if n > 0 {
+				cc.InitialHistory = int32(n)
+			}
+		case "timestamp-format":
+			cc.TimestampFormat = v
+		case "channel":
+			cc.StartChannel = v
+		}
+	})
+	return err
+}
+
+// checkClientConfig makes sure cc is enough to connect with, and fills in the
+// server name.
+func checkClientConfig(cc *pbConfig.ClientConfig) error {
+	host, _, err := net.SplitHostPort(cc.ServerAddress)
+	if err != nil {
+		return fmt.Errorf("invalid server address %q: %v", cc.ServerAddress, err)
+	}
+	if cc.ServerName == "" {
+		cc.ServerName = host
+	}
+	if cc.CaFile == "" || cc.CertFile == "" || cc.KeyFile == "" {
+		return errors.New("a CA, client certificate and key are required (client or tls section, or -ca, -cert and -key)")
+	}
+	return nil
+}
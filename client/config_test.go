@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+func TestClientConfig(t *testing.T) {
+	server := &pbConfig.Config{
+		Channels: []*pbConfig.Channel{{Name: "#go"}, {Name: "#irc"}},
+		Service:  &pbConfig.Service{Host: "0.0.0.0", Port: 6000, ClientPasskey: "s3cret"},
+		Tls:      &pbConfig.TLS{CaFile: "ca.crt", ClientCertFile: "client.crt", ClientKeyFile: "client.key"},
+	}
+	want := &pbConfig.ClientConfig{
+		ServerAddress:   "localhost:6000",
+		CaFile:          "ca.crt",
+		CertFile:        "client.crt",
+		KeyFile:         "client.key",
+		Token:           "s3cret",
+		InitialHistory:  initialHistory,
+		TimestampFormat: defaultTimeFormat,
+		StartChannel:    "#go",
+	}
+	if got := clientConfig(server); !proto.Equal(got, want) {
+		t.Errorf("From the server's sections: got %v, want %v", got, want)
+	}
+
+	// The client section wins.
+	server.Client = &pbConfig.ClientConfig{ServerAddress: "bouncer.example:443", Token: "mine", StartChannel: "#irc"}
+	got := clientConfig(server)
+	if got.GetServerAddress() != "bouncer.example:443" || got.GetToken() != "mine" || got.GetStartChannel() != "#irc" || got.GetCaFile() != "ca.crt" {
+		t.Errorf("Expected the client section to override, got %v", got)
+	}
+	if server.GetClient().GetCaFile() != "" {
+		t.Error("clientConfig modified the config")
+	}
+
+	if got := clientConfig(&pbConfig.Config{}); got.GetServerAddress() != "localhost:50051" {
+		t.Errorf("Expected the default address, got %q", got.GetServerAddress())
+	}
+
+	// Without top-level channels, start on the first network's.
+	nets := &pbConfig.Config{Networks: []*pbConfig.Network{{Name: "libera", Channels: []*pbConfig.Channel{{Name: "#go"}}}}}
+	if got := clientConfig(nets); got.GetStartChannel() != "libera/#go" {
+		t.Errorf("Expected to start on libera/#go, got %q", got.GetStartChannel())
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	registerFlags(fs)
+	if err := fs.Parse([]string{"-server", "[2001:db8::1]:7000", "-token-file", tokenFile, "-history", "200", "-channel", "#other"}); err != nil {
+		t.Fatal(err)
+	}
+	cc := &pbConfig.ClientConfig{ServerAddress: "localhost:50051", CaFile: "ca.crt", CertFile: "c.crt", KeyFile: "c.key", Token: "config", InitialHistory: 50}
+	if err := applyFlags(fs, cc); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkClientConfig(cc); err != nil {
+		t.Fatal(err)
+	}
+	want := &pbConfig.ClientConfig{
+		ServerAddress:  "[2001:db8::1]:7000",
+		ServerName:     "2001:db8::1",
+		CaFile:         "ca.crt",
+		CertFile:       "c.crt",
+		KeyFile:        "c.key",
+		Token:          "from-file",
+		InitialHistory: 200,
+		StartChannel:   "#other",
+	}
+	if !proto.Equal(cc, want) {
+		t.Errorf("Got %v, want %v", cc, want)
+	}
+
+	fs = flag.NewFlagSet("client", flag.ContinueOnError)
+	registerFlags(fs)
+	fs.Parse([]string{"-token-file", filepath.Join(t.TempDir(), "missing")})
+	if err := applyFlags(fs, &pbConfig.ClientConfig{}); err == nil {
+		t.Error("Expected an error for a missing token file")
+	}
+
+	bad := []*pbConfig.ClientConfig{
+		{ServerAddress: "no-port", CaFile: "ca.crt", CertFile: "c.crt", KeyFile: "c.key"},
+		{ServerAddress: "localhost:50051", CaFile: "ca.crt"},
+	}
+	for _, cc := range bad {
+		if err := checkClientConfig(cc); err == nil {
+			t.Errorf("Expected %v to be rejected", cc)
+		}
+	}
+}
@@ -5,33 +5,52 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/term"
 
+	"github.com/morrowc/irc-bot/backoff"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
-	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/grpc/status"
 
-	pbConfig "github.com/morrowc/irc-bot/proto/config"
 	pbService "github.com/morrowc/irc-bot/proto/service"
 )
 
-// ClientState manages the client logic and state
+// Default number of recent messages per channel requested on subscribe. Older
+// scrollback is fetched on demand with /history.
+const initialHistory = 50
+
+// ClientState manages the client logic and state. Channels and queries are
+// kept under their window key, see windowKey.
 type ClientState struct {
 	currentChannel string
 	channels       []string
-	msgHistory     map[string][]*pbService.IRCMessage
+	msgHistory     map[string][]*pbService.StreamEvent // Messages and channel events
+	chanState      map[string]*pbService.ChannelState  // Topic and members, from the server
+	pending        map[string]string                   // Request ID -> target of sends not yet acked
+	nextRequest    uint64
+	queued         map[string]int32  // Network -> lines the server is holding back for flood control
+	nicks          map[string]string // Network -> the bot's nick there, shown in the prompt
+	historySize    int               // Messages per channel requested on subscribe
+	timeFormat     string            // Layout of scrollback timestamps
 	mu             sync.RWMutex
 	termState      *term.State
-	stream         pbService.IRCService_StreamMessagesClient
+	client         pbService.IRCServiceClient
+	stream         pbService.IRCService_StreamMessagesClient // nil while disconnected
+	sendMu         sync.Mutex
+	retry          backoff.Backoff
+	connStatus     string    // Shown in the status bar while not connected
 	out            io.Writer // For testing output
 	exitFunc       func(int) // For testing exit
 
@@ -42,34 +61,38 @@ type ClientState struct {
 
 func NewClientState() *ClientState {
 	return &ClientState{
-		msgHistory: make(map[string][]*pbService.IRCMessage),
-		out:        os.Stdout,
-		exitFunc:   os.Exit,
+		msgHistory:  make(map[string][]*pbService.StreamEvent),
+		chanState:   make(map[string]*pbService.ChannelState),
+		pending:     make(map[string]string),
+		queued:      make(map[string]int32),
+		nicks:       make(map[string]string),
+		historySize: initialHistory,
+		timeFormat:  defaultTimeFormat,
+		out:         os.Stdout,
+		exitFunc:    os.Exit,
+		connStatus:  "connecting...",
 	}
 }
 
 func main() {
-	// Connect to gRPC
 	configPath := flag.String("config", "config.textproto", "Path to configuration file")
+	registerFlags(flag.CommandLine)
 	flag.Parse()
 
-	configFile, err := os.ReadFile(*configPath)
+	config, err := loadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("failed to read config file: %v", err)
+		log.Fatal(err)
 	}
-
-	config := &pbConfig.Config{}
-	if err := prototext.Unmarshal(configFile, config); err != nil {
-		log.Fatalf("failed to parse config file: %v", err)
+	cc := clientConfig(config)
+	if err := applyFlags(flag.CommandLine, cc); err != nil {
+		log.Fatal(err)
 	}
-
-	tlsConfig := config.GetTls()
-	if tlsConfig == nil {
-		log.Fatal("TLS config missing in configuration file")
+	if err := checkClientConfig(cc); err != nil {
+		log.Fatal(err)
 	}
 
 	// Load CA
-	caCert, err := os.ReadFile(tlsConfig.GetCaFile())
+	caCert, err := os.ReadFile(cc.GetCaFile())
 	if err != nil {
 		log.Fatalf("failed to read CA cert: %v", err)
 	}
@@ -79,7 +102,7 @@ func main() {
 	}
 
 	// Load Client Cert/Key
-	clientCert, err := tls.LoadX509KeyPair(tlsConfig.GetClientCertFile(), tlsConfig.GetClientKeyFile())
+	clientCert, err := tls.LoadX509KeyPair(cc.GetCertFile(), cc.GetKeyFile())
 	if err != nil {
 		log.Fatalf("failed to load client keypair: %v", err)
 	}
@@ -88,11 +111,16 @@ func main() {
 	tConf := &tls.Config{
 		RootCAs:      caCertPool,
 		Certificates: []tls.Certificate{clientCert},
-		ServerName:   "localhost", // Match server cert CN
+		ServerName:   cc.GetServerName(),
 	}
 	creds := credentials.NewTLS(tConf)
 
-	conn, err := grpc.NewClient("localhost:50051", grpc.WithTransportCredentials(creds))
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if token := cc.GetToken(); token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCreds(token)))
+	}
+
+	conn, err := grpc.NewClient(cc.GetServerAddress(), opts...)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
@@ -100,40 +128,32 @@ func main() {
 
 	client := pbService.NewIRCServiceClient(conn)
 
-	// Subscribe
-	ctx := context.Background()
-	stream, err := client.StreamMessages(ctx)
-	if err != nil {
-		log.Fatalf("Error creating stream: %v", err)
-	}
-
 	// Initialize State
 	state := NewClientState()
-	state.stream = stream
+	state.client = client
+	state.historySize = int(cc.GetInitialHistory())
+	state.timeFormat = cc.GetTimestampFormat()
 
 	// Pre-populate channels from config
 	for _, ch := range config.GetChannels() {
 		state.channels = append(state.channels, ch.GetName())
 	}
-	if len(state.channels) > 0 {
-		state.currentChannel = state.channels[0]
+	for _, n := range config.GetNetworks() {
+		for _, ch := range n.GetChannels() {
+			state.channels = append(state.channels, windowKey(n.GetName(), ch.GetName()))
+		}
 	}
-
-	// Send subscription
-	if err := stream.Send(&pbService.StreamRequest{
-		Request: &pbService.StreamRequest_Subscribe{
-			Subscribe: &pbService.SubscribeRequest{
-				GetHistory: true, // Request history
-			},
-		},
-	}); err != nil {
-		log.Fatalf("Failed to subscribe: %v", err)
+	if start := cc.GetStartChannel(); start != "" {
+		if !slices.Contains(state.channels, start) {
+			state.channels = append(state.channels, start)
+		}
+		state.currentChannel = start
 	}
 
 	// Set raw mode
 	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
 	if err != nil {
-		log.Fatalf("Failed to set raw mode: %n", err)
+		log.Fatalf("Failed to set raw mode: %v", err)
 	}
 	state.termState = oldState
 	defer term.Restore(int(os.Stdin.Fd()), oldState)
@@ -145,23 +165,197 @@ func main() {
 	// Handle Input
 	go state.handleInput(os.Stdin)
 
-	// Handle Output/Stream
+	// Handle Output/Stream, reconnecting as needed
+	state.run(context.Background())
+}
+
+// tokenCreds sends the client's bearer token with every call.
+type tokenCreds string
+
+func (t tokenCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t tokenCreds) RequireTransportSecurity() bool {
+	return true
+}
+
+// run keeps a stream to the server open until ctx is done, redialing with
+// backoff whenever it is lost. Scrollback, input and the current channel are
+// kept, and each new stream resumes where the last one left off.
+func (cs *ClientState) run(ctx context.Context) {
 	for {
-		in, err := stream.Recv()
-		if err == io.EOF {
-			break
+		err := cs.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay := cs.retry.Next()
+		cs.setConnStatus(fmt.Sprintf("disconnected (%v), retrying in %v", grpcStatusMessage(err), delay.Round(time.Second)))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
 		}
+		cs.setConnStatus("reconnecting...")
+	}
+}
+
+// session subscribes on a new stream and handles events until it fails.
+func (cs *ClientState) session(ctx context.Context) error {
+	stream, err := cs.client.StreamMessages(ctx)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(cs.subscribeRequest()); err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	cs.stream = stream
+	cs.mu.Unlock()
+	defer func() {
+		cs.mu.Lock()
+		cs.stream = nil
+		// Acks for this stream will never come.
+		clear(cs.pending)
+		cs.mu.Unlock()
+	}()
+
+	for first := true; ; first = false {
+		in, err := stream.Recv()
 		if err != nil {
-			log.Fatalf("Failed to receive: %v", err)
+			if err == io.EOF {
+				return errors.New("server closed the stream")
+			}
+			return err
+		}
+		if first {
+			// The server is talking to us again.
+			cs.retry.Reset()
+			cs.setConnStatus("")
 		}
 
 		switch e := in.Event.(type) {
 		case *pbService.StreamEvent_Message:
-			state.handleMessage(e.Message)
+			cs.handleMessage(e.Message)
 		case *pbService.StreamEvent_SystemMessage:
-			state.handleSystemMessage(e.SystemMessage)
+			if nick := e.SystemMessage.GetNick(); nick != "" {
+				cs.setNick(e.SystemMessage.GetNetwork(), nick)
+			}
+			cs.handleSystemMessage(e.SystemMessage)
+		case *pbService.StreamEvent_ChannelEvent:
+			cs.addEvent(windowKey(e.ChannelEvent.GetNetwork(), e.ChannelEvent.GetChannel()), in)
+		case *pbService.StreamEvent_ChannelState:
+			cs.setChannelState(e.ChannelState)
+		case *pbService.StreamEvent_SendAck:
+			cs.handleSendAck(e.SendAck)
+		case *pbService.StreamEvent_SendQueue:
+			cs.setQueued(e.SendQueue.GetNetwork(), e.SendQueue.GetDepth())
+		}
+	}
+}
+
+// sendText sends a message to the window key through the current stream, if
+// there is one. Must be called with cs.mu held.
+func (cs *ClientState) sendText(key, text string, kind pbService.IRCMessage_Kind) {
+	stream := cs.stream
+	if stream == nil {
+		return
+	}
+	cs.nextRequest++
+	id := strconv.FormatUint(cs.nextRequest, 10)
+	cs.pending[id] = key
+	network, channel := splitWindowKey(key)
+
+	// Start goroutine to send to avoid blocking input loop. If the stream
+	// is gone, run() reconnects.
+	go func() {
+		_ = cs.send(stream, &pbService.StreamRequest{
+			Request: &pbService.StreamRequest_SendMessage{
+				SendMessage: &pbService.SendMessageRequest{
+					Network:   network,
+					Channel:   channel,
+					Message:   text,
+					Kind:      kind,
+					RequestId: id,
+				},
+			},
+		})
+	}()
+}
+
+// send writes a request to the current stream. gRPC streams do not allow
+// concurrent sends, so they are serialized here.
+func (cs *ClientState) send(stream pbService.IRCService_StreamMessagesClient, req *pbService.StreamRequest) error {
+	cs.sendMu.Lock()
+	defer cs.sendMu.Unlock()
+	return stream.Send(req)
+}
+
+// setConnStatus updates the connection status shown in the status bar.
+func (cs *ClientState) setConnStatus(status string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.connStatus == status {
+		return
+	}
+	cs.connStatus = status
+	fmt.Fprint(cs.out, "\0337") // Save Cursor
+	cs.drawStatusBar()
+	fmt.Fprint(cs.out, "\0338") // Restore Cursor
+}
+
+// setQueued updates the number of lines queued for a network, shown in the
+// status bar.
+func (cs *ClientState) setQueued(network string, depth int32) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.queued[network] == depth {
+		return
+	}
+	if depth == 0 {
+		delete(cs.queued, network)
+	} else {
+		cs.queued[network] = depth
+	}
+	fmt.Fprint(cs.out, "\0337") // Save Cursor
+	cs.drawStatusBar()
+	fmt.Fprint(cs.out, "\0338") // Restore Cursor
+}
+
+// grpcStatusMessage returns the human readable part of a gRPC error.
+func grpcStatusMessage(err error) string {
+	if st, ok := status.FromError(err); ok {
+		return st.Message()
+	}
+	return err.Error()
+}
+
+// subscribeRequest builds the subscription for a new stream. Channels we
+// already have messages for resume after the newest one, so nothing is
+// duplicated or skipped.
+func (cs *ClientState) subscribeRequest() *pbService.StreamRequest {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	lastSeen := make(map[string]uint64)
+	for ch, evs := range cs.msgHistory {
+		if n := len(evs); n > 0 && eventID(evs[n-1]) != 0 {
+			lastSeen[ch] = eventID(evs[n-1])
 		}
 	}
+
+	return &pbService.StreamRequest{
+		Request: &pbService.StreamRequest_Subscribe{
+			Subscribe: &pbService.SubscribeRequest{
+				GetHistory:   true, // Request history
+				HistoryLimit: int32(cs.historySize),
+				LastSeen:     lastSeen,
+			},
+		},
+	}
 }
 
 func (cs *ClientState) handleInput(input io.Reader) {
@@ -197,34 +391,21 @@ func (cs *ClientState) handleInput(input io.Reader) {
 		case 16: // Ctrl-P (Prev Channel)
 			cs.mu.Unlock()
 			cs.prevChannel()
+		case 13, 10: // Enter
 			if len(cs.inputBuffer) > 0 {
 				msg := string(cs.inputBuffer)
-				cs.inputBuffer = nil
-
-				// Clear input line
-				cs.moveToInput()
 
 				if len(msg) > 0 && msg[0] == '/' {
+					cs.inputBuffer = nil
+					cs.moveToInput()
 					cs.handleCommand(msg)
-				} else {
-					// Send to Server
-					if cs.stream != nil {
-						// Start goroutine to send to avoid blocking input loop
-						go func(ch, txt string) {
-							err := cs.stream.Send(&pbService.StreamRequest{
-								Request: &pbService.StreamRequest_SendMessage{
-									SendMessage: &pbService.SendMessageRequest{
-										Channel: ch,
-										Message: txt,
-									},
-								},
-							})
-							if err != nil {
-								// Log error?
-							}
-						}(cs.currentChannel, msg)
-					}
+				} else if cs.stream != nil {
+					cs.inputBuffer = nil
+					cs.moveToInput()
+					cs.sendText(cs.currentChannel, msg, pbService.IRCMessage_PRIVMSG)
 				}
+				// While disconnected the line stays in the input buffer,
+				// so it can be sent once we are back.
 			}
 			cs.mu.Unlock()
 		case 127, 8: // Backspace
@@ -245,24 +426,32 @@ func (cs *ClientState) handleInput(input io.Reader) {
 }
 
 func (cs *ClientState) handleMessage(msg *pbService.IRCMessage) {
+	cs.addEvent(windowKey(msg.GetNetwork(), msg.GetChannel()), &pbService.StreamEvent{Event: &pbService.StreamEvent_Message{Message: msg}})
+}
+
+// addEvent appends a message or channel event to a channel's scrollback and
+// prints it if the channel is on screen.
+func (cs *ClientState) addEvent(ch string, ev *pbService.StreamEvent) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
-	ch := msg.GetChannel()
-	cs.msgHistory[ch] = append(cs.msgHistory[ch], msg)
-
-	// Add to channel list if new
-	found := false
-	for _, c := range cs.channels {
-		if c == ch {
-			found = true
-			break
-		}
+	// Drop events we already have, e.g. replayed after a reconnect.
+	if evs := cs.msgHistory[ch]; len(evs) > 0 && eventID(ev) != 0 && eventID(ev) <= eventID(evs[len(evs)-1]) {
+		return
 	}
-	if !found {
-		cs.channels = append(cs.channels, ch)
-		if cs.currentChannel == "" {
-			cs.currentChannel = ch
+	cs.msgHistory[ch] = append(cs.msgHistory[ch], ev)
+	cs.addChannelUnlocked(ch)
+
+	if ce := ev.GetChannelEvent(); ce.GetType() == pbService.ChannelEvent_TOPIC {
+		if st := cs.chanState[ch]; st != nil {
+			st.Topic = ce.GetTopic()
+			st.TopicSetBy = ce.GetActor()
+			st.TopicSetAt = ce.GetTimestamp()
+		}
+		if ch == cs.currentChannel {
+			fmt.Fprint(cs.out, "\0337")
+			cs.drawStatusBar()
+			fmt.Fprint(cs.out, "\0338")
 		}
 	}
 
@@ -272,7 +461,7 @@ func (cs *ClientState) handleMessage(msg *pbService.IRCMessage) {
 
 		// Move to bottom of scroll region
 		fmt.Fprintf(cs.out, "\033[%d;1H", cs.height-2)
-		fmt.Fprintf(cs.out, "\r\n[%s] <%s> %s", msg.GetTimestamp().AsTime().Format("15:04"), msg.GetSender(), msg.GetContent())
+		fmt.Fprintf(cs.out, "\r\n%s", formatEvent(ev, cs.timeFormat))
 
 		// Restore Cursor
 		fmt.Fprint(cs.out, "\0338")
@@ -284,10 +473,239 @@ func (cs *ClientState) handleMessage(msg *pbService.IRCMessage) {
 	}
 }
 
+// addChannelUnlocked adds ch to the channel list if it is new. Private
+// conversations get a window the same way when their first message arrives.
+func (cs *ClientState) addChannelUnlocked(ch string) {
+	for _, c := range cs.channels {
+		if c == ch {
+			return
+		}
+	}
+	cs.channels = append(cs.channels, ch)
+	if cs.currentChannel == "" {
+		cs.currentChannel = ch
+	}
+	if _, name := splitWindowKey(ch); !isChannel(name) {
+		cs.handleSystemMessage(&pbService.SystemMessage{Content: fmt.Sprintf("Opened query with %s (Ctrl-N/Ctrl-P to switch)", ch)})
+	}
+}
+
+// isChannel reports whether name is a channel rather than a nick.
+func isChannel(name string) bool {
+	return name != "" && strings.ContainsRune("#&+!", rune(name[0]))
+}
+
+// windowKey names the window of a channel or query: the channel itself on the
+// server's unnamed network, else "network/channel". These are the server's
+// history keys, so they can be used in last_seen as they are.
+func windowKey(network, channel string) string {
+	if network == "" {
+		return channel
+	}
+	return network + "/" + channel
+}
+
+// splitWindowKey undoes windowKey. Channels start with a prefix and nicks
+// can't contain "/", so a key with a "/" after something else is qualified.
+func splitWindowKey(key string) (network, channel string) {
+	if key == "" || isChannel(key) {
+		return "", key
+	}
+	if network, channel, ok := strings.Cut(key, "/"); ok {
+		return network, channel
+	}
+	return "", key
+}
+
+// setChannelState records the state of a channel sent by the server.
+func (cs *ClientState) setChannelState(st *pbService.ChannelState) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	key := windowKey(st.GetNetwork(), st.GetChannel())
+	cs.chanState[key] = st
+	cs.addChannelUnlocked(key)
+	if key == cs.currentChannel {
+		fmt.Fprint(cs.out, "\0337")
+		cs.drawStatusBar()
+		fmt.Fprint(cs.out, "\0338")
+	}
+}
+
+// showNames fetches the current member list of a channel and prints it.
+func (cs *ClientState) showNames(key string) {
+	cs.mu.RLock()
+	client := cs.client
+	cs.mu.RUnlock()
+	if client == nil || key == "" {
+		return
+	}
+
+	network, channel := splitWindowKey(key)
+	st, err := client.GetChannelState(context.Background(), &pbService.GetChannelStateRequest{Network: network, Channel: channel})
+	if err != nil {
+		cs.handleSystemMessage(&pbService.SystemMessage{Content: fmt.Sprintf("Failed to fetch names: %v", grpcStatusMessage(err))})
+		return
+	}
+
+	var names []string
+	for _, m := range st.GetMembers() {
+		names = append(names, m.GetPrefixes()+m.GetNick())
+	}
+	cs.setChannelState(st)
+	cs.handleSystemMessage(&pbService.SystemMessage{Content: fmt.Sprintf("%d users in %s: %s", len(names), key, strings.Join(names, " "))})
+}
+
+// showClients lists the clients attached to the server.
+func (cs *ClientState) showClients() {
+	cs.mu.RLock()
+	client := cs.client
+	cs.mu.RUnlock()
+	if client == nil {
+		return
+	}
+
+	resp, err := client.ListClients(context.Background(), &pbService.ListClientsRequest{})
+	if err != nil {
+		cs.handleSystemMessage(&pbService.SystemMessage{Content: fmt.Sprintf("Failed to list clients: %v", grpcStatusMessage(err))})
+		return
+	}
+
+	cs.handleSystemMessage(&pbService.SystemMessage{Content: fmt.Sprintf("%d clients attached", len(resp.GetClients()))})
+	for _, c := range resp.GetClients() {
+		cs.handleSystemMessage(&pbService.SystemMessage{Content: fmt.Sprintf("  %s from %s since %s (sent %d, dropped %d)",
+			c.GetIdentity(), c.GetAddress(), c.GetSince().AsTime().Local().Format("2006-01-02 15:04"), c.GetSent(), c.GetDropped())})
+	}
+}
+
+// formatEvent renders a scrollback line. Channel events are set apart from
+// chat with a "-!-" marker, like most IRC clients do.
+func formatEvent(ev *pbService.StreamEvent, layout string) string {
+	if msg := ev.GetMessage(); msg != nil {
+		ts := msg.GetTimestamp().AsTime().Format(layout)
+		switch msg.GetKind() {
+		case pbService.IRCMessage_ACTION:
+			return fmt.Sprintf("[%s] * %s %s", ts, msg.GetSender(), msg.GetContent())
+		case pbService.IRCMessage_NOTICE:
+			return fmt.Sprintf("[%s] -%s- %s", ts, msg.GetSender(), msg.GetContent())
+		case pbService.IRCMessage_CTCP:
+			return fmt.Sprintf("[%s] [CTCP %s] %s", ts, msg.GetSender(), msg.GetContent())
+		}
+		return fmt.Sprintf("[%s] <%s> %s", ts, msg.GetSender(), msg.GetContent())
+	}
+
+	ce := ev.GetChannelEvent()
+	var text string
+	switch ce.GetType() {
+	case pbService.ChannelEvent_JOIN:
+		text = fmt.Sprintf("%s has joined %s", ce.GetActor(), ce.GetChannel())
+	case pbService.ChannelEvent_PART:
+		text = fmt.Sprintf("%s has left %s", ce.GetActor(), ce.GetChannel())
+	case pbService.ChannelEvent_QUIT:
+		text = fmt.Sprintf("%s has quit", ce.GetActor())
+	case pbService.ChannelEvent_KICK:
+		text = fmt.Sprintf("%s was kicked from %s by %s", ce.GetTarget(), ce.GetChannel(), ce.GetActor())
+	case pbService.ChannelEvent_NICK:
+		text = fmt.Sprintf("%s is now known as %s", ce.GetOldNick(), ce.GetNewNick())
+	case pbService.ChannelEvent_TOPIC:
+		text = fmt.Sprintf("%s changed the topic to: %s", ce.GetActor(), ce.GetTopic())
+	case pbService.ChannelEvent_MODE:
+		text = fmt.Sprintf("mode/%s [%s] by %s", ce.GetChannel(), ce.GetMode(), ce.GetActor())
+	default:
+		text = fmt.Sprintf("%s: %s", ce.GetType(), ce.GetActor())
+	}
+	if ce.GetReason() != "" {
+		text += fmt.Sprintf(" (%s)", ce.GetReason())
+	}
+	return fmt.Sprintf("[%s] -!- %s", ce.GetTimestamp().AsTime().Format(layout), text)
+}
+
+// eventID returns the history ID of a message or channel event.
+func eventID(ev *pbService.StreamEvent) uint64 {
+	if msg := ev.GetMessage(); msg != nil {
+		return msg.GetId()
+	}
+	return ev.GetChannelEvent().GetId()
+}
+
+// handleSendAck reports sends the server could not deliver. Successful ones
+// already show up as the echoed message.
+func (cs *ClientState) handleSendAck(ack *pbService.SendMessageResponse) {
+	cs.mu.Lock()
+	target, ok := cs.pending[ack.GetRequestId()]
+	delete(cs.pending, ack.GetRequestId())
+	cs.mu.Unlock()
+
+	if !ack.GetSuccess() {
+		if !ok {
+			target = "server"
+		}
+		fmt.Fprintf(cs.out, "\r\n[SYSTEM] Failed to send to %s: %s", target, ack.GetError())
+	}
+}
+
 func (cs *ClientState) handleSystemMessage(msg *pbService.SystemMessage) {
+	if network := msg.GetNetwork(); network != "" {
+		fmt.Fprintf(cs.out, "\r\n[SYSTEM] %s: %s", network, msg.GetContent())
+		return
+	}
 	fmt.Fprintf(cs.out, "\r\n[SYSTEM] %s", msg.GetContent())
 }
 
+// fetchOlder asks the server for up to n events older than the oldest one we
+// have for the window key and prepends them to the local history.
+func (cs *ClientState) fetchOlder(key string, n int) {
+	cs.mu.RLock()
+	client := cs.client
+	var cursor uint64
+	if evs := cs.msgHistory[key]; len(evs) > 0 {
+		cursor = eventID(evs[0])
+	}
+	cs.mu.RUnlock()
+
+	if client == nil || key == "" {
+		return
+	}
+
+	network, channel := splitWindowKey(key)
+	resp, err := client.GetHistory(context.Background(), &pbService.GetHistoryRequest{
+		Network:   network,
+		Channel:   channel,
+		Cursor:    cursor,
+		Limit:     int32(n),
+		Direction: pbService.GetHistoryRequest_BACKWARD,
+	})
+	if err != nil {
+		cs.handleSystemMessage(&pbService.SystemMessage{Content: fmt.Sprintf("Failed to fetch history: %v", err)})
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	evs := resp.GetEvents()
+	if len(evs) == 0 {
+		// Servers that predate channel events only fill in messages.
+		for _, msg := range resp.GetMessages() {
+			evs = append(evs, &pbService.StreamEvent{Event: &pbService.StreamEvent_Message{Message: msg}})
+		}
+	}
+
+	// Another fetch may have raced us; only keep what is still older.
+	existing := cs.msgHistory[key]
+	var older []*pbService.StreamEvent
+	for _, ev := range evs {
+		if len(existing) == 0 || eventID(ev) < eventID(existing[0]) {
+			older = append(older, ev)
+		}
+	}
+	cs.msgHistory[key] = append(older, existing...)
+
+	if key == cs.currentChannel {
+		cs.redrawUnlocked()
+	}
+}
+
 func (cs *ClientState) nextChannel() {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -322,6 +740,57 @@ func (cs *ClientState) prevChannel() {
 	}
 }
 
+// networks returns the networks we have windows for, in window order.
+// Must be called with cs.mu held.
+func (cs *ClientState) networks() []string {
+	var nets []string
+	for _, key := range cs.channels {
+		if network, _ := splitWindowKey(key); !slices.Contains(nets, network) {
+			nets = append(nets, network)
+		}
+	}
+	return nets
+}
+
+// networkName shows the unnamed network as "-", as /network takes it.
+func networkName(network string) string {
+	if network == "" {
+		return "-"
+	}
+	return network
+}
+
+// showNetworks lists the networks, marking the current one. Must be called
+// with cs.mu held.
+func (cs *ClientState) showNetworks() {
+	current, _ := splitWindowKey(cs.currentChannel)
+	var names []string
+	for _, network := range cs.networks() {
+		name := networkName(network)
+		if network == current {
+			name = "*" + name
+		}
+		names = append(names, name)
+	}
+	cs.handleSystemMessage(&pbService.SystemMessage{Content: fmt.Sprintf("Networks: %s", strings.Join(names, " "))})
+}
+
+// switchNetwork shows the first window of a network. Must be called with
+// cs.mu held.
+func (cs *ClientState) switchNetwork(name string) {
+	if name == "-" {
+		name = ""
+	}
+	for _, key := range cs.channels {
+		if network, _ := splitWindowKey(key); network == name {
+			cs.currentChannel = key
+			cs.redrawUnlocked()
+			return
+		}
+	}
+	cs.handleSystemMessage(&pbService.SystemMessage{Content: fmt.Sprintf("No windows on network %s", networkName(name))})
+}
+
 func (cs *ClientState) updateSize() {
 	w, h, err := term.GetSize(int(os.Stdin.Fd()))
 	if err != nil {
@@ -342,7 +811,28 @@ func (cs *ClientState) drawStatusBar() {
 	fmt.Fprintf(cs.out, "\033[%d;1H", cs.height-1) // Move cursor
 	fmt.Fprintf(cs.out, "\033[7m")                 // Invert colors
 
-	status := fmt.Sprintf("[ Channel: %s ]", cs.currentChannel)
+	kind := "Channel"
+	if _, name := splitWindowKey(cs.currentChannel); name != "" && !isChannel(name) {
+		kind = "Query"
+	}
+	status := fmt.Sprintf("[ %s: %s ]", kind, cs.currentChannel)
+	st := cs.chanState[cs.currentChannel]
+	if st != nil {
+		status += fmt.Sprintf(" [ %d users ]", len(st.GetMembers()))
+	}
+	if cs.connStatus != "" {
+		status += fmt.Sprintf(" [ %s ]", cs.connStatus)
+	}
+	if queued := sumQueued(cs.queued); queued > 0 {
+		status += fmt.Sprintf(" [ %d queued ]", queued)
+	}
+	if st.GetTopic() != "" {
+		status += " " + st.GetTopic()
+	}
+	// The topic may be long; cut it off rather than wrap.
+	if r := []rune(status); cs.width > 0 && len(r) > cs.width {
+		status = string(r[:cs.width])
+	}
 	// Pad with spaces to width
 	for len(status) < cs.width {
 		status += " "
@@ -351,11 +841,43 @@ func (cs *ClientState) drawStatusBar() {
 	fmt.Fprintf(cs.out, "\033[0m") // Reset colors
 }
 
+// sumQueued returns the lines queued on all networks.
+func sumQueued(queued map[string]int32) int32 {
+	var n int32
+	for _, depth := range queued {
+		n += depth
+	}
+	return n
+}
+
 func (cs *ClientState) moveToInput() {
 	fmt.Fprintf(cs.out, "\033[%d;1H", cs.height)
 	// Reprint buffer
 	fmt.Fprint(cs.out, "\033[2K") // Clear line
-	fmt.Fprintf(cs.out, "> %s", string(cs.inputBuffer))
+	fmt.Fprintf(cs.out, "%s> %s", cs.prompt(), string(cs.inputBuffer))
+}
+
+// prompt names the bot's nick on the current window's network, once the
+// server has told us.
+func (cs *ClientState) prompt() string {
+	network, _ := splitWindowKey(cs.currentChannel)
+	if nick := cs.nicks[network]; nick != "" {
+		return "[" + nick + "] "
+	}
+	return ""
+}
+
+// setNick notes the bot's nick on a network and updates the prompt.
+func (cs *ClientState) setNick(network, nick string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.nicks[network] == nick {
+		return
+	}
+	cs.nicks[network] = nick
+	fmt.Fprint(cs.out, "\0337") // Save Cursor
+	cs.moveToInput()
+	fmt.Fprint(cs.out, "\0338") // Restore Cursor
 }
 
 func (cs *ClientState) redraw() {
@@ -374,18 +896,17 @@ func (cs *ClientState) redrawUnlocked() {
 	// Draw correct number of past messages in the scroll region
 	// The scroll region is 1 to height-2
 	// We should print the last (height-2) messages
-	msgs := cs.msgHistory[cs.currentChannel]
+	evs := cs.msgHistory[cs.currentChannel]
 	maxMsgs := cs.height - 2
 	start := 0
-	if len(msgs) > maxMsgs {
-		start = len(msgs) - maxMsgs
+	if len(evs) > maxMsgs {
+		start = len(evs) - maxMsgs
 	}
 
 	// Move to top
 	fmt.Fprint(cs.out, "\033[1;1H")
-	for i := start; i < len(msgs); i++ {
-		msg := msgs[i]
-		fmt.Fprintf(cs.out, "[%s] <%s> %s\r\n", msg.GetTimestamp().AsTime().Format("15:04"), msg.GetSender(), msg.GetContent())
+	for i := start; i < len(evs); i++ {
+		fmt.Fprintf(cs.out, "%s\r\n", formatEvent(evs[i], cs.timeFormat))
 	}
 
 	cs.moveToInput()
@@ -405,20 +926,45 @@ func (cs *ClientState) handleCommand(cmd string) {
 		}
 		cs.exitFunc(0)
 	case "/history":
-		// Request history for current channel
-		if cs.stream != nil {
-			go func() {
-				err := cs.stream.Send(&pbService.StreamRequest{
-					Request: &pbService.StreamRequest_Subscribe{
-						Subscribe: &pbService.SubscribeRequest{
-							GetHistory: true,
-						},
-					},
-				})
-				if err != nil {
-					// log
-				}
-			}()
+		// Fetch older messages for the current channel
+		// Usage: /history [count]
+		n := cs.historySize
+		if len(parts) > 1 {
+			if v, err := strconv.Atoi(parts[1]); err == nil && v > 0 {
+				n = v
+			}
+		}
+		go cs.fetchOlder(cs.currentChannel, n)
+	case "/me":
+		// Send an action to the current channel
+		// Usage: /me <action>
+		if text := strings.TrimSpace(strings.TrimPrefix(cmd, "/me")); text != "" {
+			cs.sendText(cs.currentChannel, text, pbService.IRCMessage_ACTION)
+		}
+	case "/notice":
+		// Usage: /notice <target> <text>
+		_, rest, _ := strings.Cut(cmd, " ")
+		target, text, _ := strings.Cut(strings.TrimLeft(rest, " "), " ")
+		text = strings.TrimLeft(text, " ")
+		if target == "" || text == "" {
+			return
+		}
+		// The target is on the current window's network.
+		network, _ := splitWindowKey(cs.currentChannel)
+		cs.sendText(windowKey(network, target), text, pbService.IRCMessage_NOTICE)
+	case "/names":
+		// List the members of the current channel
+		go cs.showNames(cs.currentChannel)
+	case "/clients":
+		// List the clients attached to the server
+		go cs.showClients()
+	case "/network":
+		// List networks, or switch to the first window of one
+		// Usage: /network [name], "-" for the unnamed network
+		if len(parts) > 1 {
+			cs.switchNetwork(parts[1])
+		} else {
+			cs.showNetworks()
 		}
 	case "/quit":
 		// Shutdown server
@@ -429,9 +975,9 @@ func (cs *ClientState) handleCommand(cmd string) {
 			return
 		}
 		password := parts[1]
-		if cs.stream != nil {
+		if stream := cs.stream; stream != nil {
 			go func() {
-				err := cs.stream.Send(&pbService.StreamRequest{
+				err := cs.send(stream, &pbService.StreamRequest{
 					Request: &pbService.StreamRequest_Quit{
 						Quit: &pbService.QuitRequest{
 							ShutdownServer: true,
@@ -1,38 +1,24 @@
 #!/bin/bash
+# Creates a CA, a server certificate for localhost and one client certificate
+# in certs/. See `bazel run //server -- certs -h` for more.
 set -e
 
-# Directory for certs
-mkdir -p certs
-cd certs
+CERTS="bazel run //server:server -- certs -dir $(pwd)/certs"
 
-# 1. Generate CA
-if [ ! -f "ca.crt" -a ! -f "ca.key" ]; then
-  echo "Generating CA..."
-  openssl genrsa -out ca.key 4096
-  openssl req -new -x509 -key ca.key -sha256 -subj '/C=US/ST=State/L=City/O=IRC-Bot-CA/CN=IRC-Bot-Root-CA' -days 3650 -out ca.crt
+if [ ! -f "certs/ca.crt" ] && [ ! -f "certs/ca.key" ]; then
+  $CERTS init
 else
   echo 'CA certs/keys already exist.'
 fi
 
-# 2. Generate Server Cert
-if [ ! -f "server.key" ] || [ ! -f "server.crt" ]; then
-  echo 'Generating Server Cert...'
-  openssl genrsa -out server.key 4096
-  openssl req -new -key server.key -out server.csr -subj '/C=US/ST=State/L=City/O=IRC-Bot-Server/CN=localhost'
-  # Sign Server Cert
-  openssl x509 -req -in server.csr -CA ca.crt -CAkey ca.key -CAcreateserial -out server.crt -days 365 -sha256 -extfile ../server.cnf
+if [ ! -f "certs/server.key" ] || [ ! -f "certs/server.crt" ]; then
+  $CERTS server localhost 127.0.0.1
 else
   echo 'Server certs already exist.'
 fi
 
-# 3. Generate Client Cert
-if [ ! -f "client.key" ] || [ ! -f "client.crt" ]; then
-CLIENT_CN="${1:-client_user}"
-echo "Generating Client Cert for CN=${CLIENT_CN}..."
-openssl genrsa -out client.key 4096
-openssl req -new -key client.key -out client.csr -subj "/C=US/ST=State/L=City/O=IRC-Bot-Client/CN=${CLIENT_CN}"
-# Sign Client Cert
-openssl x509 -req -in client.csr -CA ca.crt -CAkey ca.key -CAcreateserial -out client.crt -days 365 -sha256
+if [ ! -f "certs/client.key" ] || [ ! -f "certs/client.crt" ]; then
+  $CERTS client -out client "${1:-client_user}"
 else
   echo 'Client certs already exist.'
 fi
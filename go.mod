@@ -6,6 +6,7 @@ toolchain go1.24.4
 
 require (
 	github.com/lrstanley/girc v1.1.1
+	golang.org/x/crypto v0.46.0
 	golang.org/x/term v0.40.0
 	google.golang.org/grpc v1.79.1
 	google.golang.org/protobuf v1.36.11
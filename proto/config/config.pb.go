@@ -21,21 +21,338 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
-type IRCServer struct {
+type TLSVersion int32
+
+const (
+	TLSVersion_TLS_DEFAULT TLSVersion = 0 // TLS 1.2
+	TLSVersion_TLS_1_2     TLSVersion = 1
+	TLSVersion_TLS_1_3     TLSVersion = 2
+)
+
+// Enum value maps for TLSVersion.
+var (
+	TLSVersion_name = map[int32]string{
+		0: "TLS_DEFAULT",
+		1: "TLS_1_2",
+		2: "TLS_1_3",
+	}
+	TLSVersion_value = map[string]int32{
+		"TLS_DEFAULT": 0,
+		"TLS_1_2":     1,
+		"TLS_1_3":     2,
+	}
+)
+
+func (x TLSVersion) Enum() *TLSVersion {
+	p := new(TLSVersion)
+	*p = x
+	return p
+}
+
+func (x TLSVersion) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TLSVersion) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_config_config_proto_enumTypes[0].Descriptor()
+}
+
+func (TLSVersion) Type() protoreflect.EnumType {
+	return &file_proto_config_config_proto_enumTypes[0]
+}
+
+func (x TLSVersion) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TLSVersion.Descriptor instead.
+func (TLSVersion) EnumDescriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{0}
+}
+
+// Where a channel's history is kept.
+type HistoryStorage int32
+
+const (
+	HistoryStorage_HISTORY_MEMORY HistoryStorage = 0 // In-memory ring, lost on restart
+	HistoryStorage_HISTORY_DISK   HistoryStorage = 1 // Append-only segment files under Config.history_dir
+)
+
+// Enum value maps for HistoryStorage.
+var (
+	HistoryStorage_name = map[int32]string{
+		0: "HISTORY_MEMORY",
+		1: "HISTORY_DISK",
+	}
+	HistoryStorage_value = map[string]int32{
+		"HISTORY_MEMORY": 0,
+		"HISTORY_DISK":   1,
+	}
+)
+
+func (x HistoryStorage) Enum() *HistoryStorage {
+	p := new(HistoryStorage)
+	*p = x
+	return p
+}
+
+func (x HistoryStorage) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (HistoryStorage) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_config_config_proto_enumTypes[1].Descriptor()
+}
+
+func (HistoryStorage) Type() protoreflect.EnumType {
+	return &file_proto_config_config_proto_enumTypes[1]
+}
+
+func (x HistoryStorage) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use HistoryStorage.Descriptor instead.
+func (HistoryStorage) EnumDescriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{1}
+}
+
+// What to do when a client's outbound queue is full.
+type OverflowPolicy int32
+
+const (
+	OverflowPolicy_OVERFLOW_DROP_OLDEST OverflowPolicy = 0 // Discard the oldest queued event
+	OverflowPolicy_OVERFLOW_DISCONNECT  OverflowPolicy = 1 // Disconnect the client
+	OverflowPolicy_OVERFLOW_COALESCE    OverflowPolicy = 2 // Skip new events, then send a single "N messages skipped" notice
+)
+
+// Enum value maps for OverflowPolicy.
+var (
+	OverflowPolicy_name = map[int32]string{
+		0: "OVERFLOW_DROP_OLDEST",
+		1: "OVERFLOW_DISCONNECT",
+		2: "OVERFLOW_COALESCE",
+	}
+	OverflowPolicy_value = map[string]int32{
+		"OVERFLOW_DROP_OLDEST": 0,
+		"OVERFLOW_DISCONNECT":  1,
+		"OVERFLOW_COALESCE":    2,
+	}
+)
+
+func (x OverflowPolicy) Enum() *OverflowPolicy {
+	p := new(OverflowPolicy)
+	*p = x
+	return p
+}
+
+func (x OverflowPolicy) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (OverflowPolicy) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_config_config_proto_enumTypes[2].Descriptor()
+}
+
+func (OverflowPolicy) Type() protoreflect.EnumType {
+	return &file_proto_config_config_proto_enumTypes[2]
+}
+
+func (x OverflowPolicy) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use OverflowPolicy.Descriptor instead.
+func (OverflowPolicy) EnumDescriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{2}
+}
+
+type NickServ_Recover int32
+
+const (
+	NickServ_NONE   NickServ_Recover = 0
+	NickServ_GHOST  NickServ_Recover = 1 // Disconnect the other session, then take the nick
+	NickServ_REGAIN NickServ_Recover = 2 // Have NickServ move the nick over in one step
+)
+
+// Enum value maps for NickServ_Recover.
+var (
+	NickServ_Recover_name = map[int32]string{
+		0: "NONE",
+		1: "GHOST",
+		2: "REGAIN",
+	}
+	NickServ_Recover_value = map[string]int32{
+		"NONE":   0,
+		"GHOST":  1,
+		"REGAIN": 2,
+	}
+)
+
+func (x NickServ_Recover) Enum() *NickServ_Recover {
+	p := new(NickServ_Recover)
+	*p = x
+	return p
+}
+
+func (x NickServ_Recover) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (NickServ_Recover) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_config_config_proto_enumTypes[3].Descriptor()
+}
+
+func (NickServ_Recover) Type() protoreflect.EnumType {
+	return &file_proto_config_config_proto_enumTypes[3]
+}
+
+func (x NickServ_Recover) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use NickServ_Recover.Descriptor instead.
+func (NickServ_Recover) EnumDescriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{2, 0}
+}
+
+type SASL_Mechanism int32
+
+const (
+	SASL_PLAIN    SASL_Mechanism = 0
+	SASL_EXTERNAL SASL_Mechanism = 1 // CertFP: log in with the TLS client certificate
+)
+
+// Enum value maps for SASL_Mechanism.
+var (
+	SASL_Mechanism_name = map[int32]string{
+		0: "PLAIN",
+		1: "EXTERNAL",
+	}
+	SASL_Mechanism_value = map[string]int32{
+		"PLAIN":    0,
+		"EXTERNAL": 1,
+	}
+)
+
+func (x SASL_Mechanism) Enum() *SASL_Mechanism {
+	p := new(SASL_Mechanism)
+	*p = x
+	return p
+}
+
+func (x SASL_Mechanism) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SASL_Mechanism) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_config_config_proto_enumTypes[4].Descriptor()
+}
+
+func (SASL_Mechanism) Type() protoreflect.EnumType {
+	return &file_proto_config_config_proto_enumTypes[4]
+}
+
+func (x SASL_Mechanism) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SASL_Mechanism.Descriptor instead.
+func (SASL_Mechanism) EnumDescriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{4, 0}
+}
+
+type Endpoint struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
 	Port          int32                  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
-	UseTls        bool                   `protobuf:"varint,3,opt,name=use_tls,json=useTls,proto3" json:"use_tls,omitempty"`
-	Nick          string                 `protobuf:"bytes,4,opt,name=nick,proto3" json:"nick,omitempty"`
-	User          string                 `protobuf:"bytes,5,opt,name=user,proto3" json:"user,omitempty"`         // Username/ident
-	Password      string                 `protobuf:"bytes,6,opt,name=password,proto3" json:"password,omitempty"` // Server password if needed
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
+func (x *Endpoint) Reset() {
+	*x = Endpoint{}
+	mi := &file_proto_config_config_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Endpoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Endpoint) ProtoMessage() {}
+
+func (x *Endpoint) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Endpoint.ProtoReflect.Descriptor instead.
+func (*Endpoint) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Endpoint) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *Endpoint) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+type IRCServer struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	Host                  string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Port                  int32                  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	UseTls                bool                   `protobuf:"varint,3,opt,name=use_tls,json=useTls,proto3" json:"use_tls,omitempty"`
+	Nick                  string                 `protobuf:"bytes,4,opt,name=nick,proto3" json:"nick,omitempty"`
+	User                  string                 `protobuf:"bytes,5,opt,name=user,proto3" json:"user,omitempty"`                                                                     // Username/ident
+	Password              string                 `protobuf:"bytes,6,opt,name=password,proto3" json:"password,omitempty"`                                                             // Server password if needed
+	FallbackServers       []*Endpoint            `protobuf:"bytes,7,rep,name=fallback_servers,json=fallbackServers,proto3" json:"fallback_servers,omitempty"`                        // Tried in turn when host:port fails
+	ReconnectMinDelaySecs int32                  `protobuf:"varint,8,opt,name=reconnect_min_delay_secs,json=reconnectMinDelaySecs,proto3" json:"reconnect_min_delay_secs,omitempty"` // Default 5
+	ReconnectMaxDelaySecs int32                  `protobuf:"varint,9,opt,name=reconnect_max_delay_secs,json=reconnectMaxDelaySecs,proto3" json:"reconnect_max_delay_secs,omitempty"` // Default 300
+	Sasl                  *SASL                  `protobuf:"bytes,10,opt,name=sasl,proto3" json:"sasl,omitempty"`                                                                    // Account login; unset to connect without one
+	Tls                   *UpstreamTLS           `protobuf:"bytes,11,opt,name=tls,proto3" json:"tls,omitempty"`                                                                      // How to verify the server when use_tls is set
+	// Send messages that need several lines as one IRCv3 draft/multiline
+	// batch when the server supports it, so clients that understand it show
+	// them as a single message.
+	Multiline bool `protobuf:"varint,12,opt,name=multiline,proto3" json:"multiline,omitempty"`
+	// Flood control. Messages to IRC wait in a queue and go out at send_rate
+	// lines per second once the first send_burst lines have gone.
+	SendBurst int32   `protobuf:"varint,13,opt,name=send_burst,json=sendBurst,proto3" json:"send_burst,omitempty"` // Default 5
+	SendRate  float64 `protobuf:"fixed64,14,opt,name=send_rate,json=sendRate,proto3" json:"send_rate,omitempty"`   // Default 0.5
+	// Take turns between channels and nicks with lines waiting, instead of
+	// sending in order, so a long paste to one doesn't hold up the others.
+	SendFair bool `protobuf:"varint,15,opt,name=send_fair,json=sendFair,proto3" json:"send_fair,omitempty"`
+	// Nicks to try, in order, when nick is taken. After the last one, the bot
+	// makes up nicks within the server's nick length, and reconnects later if
+	// ten of those are refused too.
+	AltNicks []string `protobuf:"bytes,16,rep,name=alt_nicks,json=altNicks,proto3" json:"alt_nicks,omitempty"`
+	// While on another nick, how often to try to get nick back. Not used on
+	// servers with MONITOR, which say when nick is free. Default 60.
+	NickRegainIntervalSecs int32     `protobuf:"varint,17,opt,name=nick_regain_interval_secs,json=nickRegainIntervalSecs,proto3" json:"nick_regain_interval_secs,omitempty"`
+	Nickserv               *NickServ `protobuf:"bytes,18,opt,name=nickserv,proto3" json:"nickserv,omitempty"` // Log in to NickServ; unset if not needed
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
 func (x *IRCServer) Reset() {
 	*x = IRCServer{}
-	mi := &file_proto_config_config_proto_msgTypes[0]
+	mi := &file_proto_config_config_proto_msgTypes[1]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -47,7 +364,7 @@ func (x *IRCServer) String() string {
 func (*IRCServer) ProtoMessage() {}
 
 func (x *IRCServer) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_config_config_proto_msgTypes[0]
+	mi := &file_proto_config_config_proto_msgTypes[1]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -60,7 +377,7 @@ func (x *IRCServer) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use IRCServer.ProtoReflect.Descriptor instead.
 func (*IRCServer) Descriptor() ([]byte, []int) {
-	return file_proto_config_config_proto_rawDescGZIP(), []int{0}
+	return file_proto_config_config_proto_rawDescGZIP(), []int{1}
 }
 
 func (x *IRCServer) GetHost() string {
@@ -70,65 +387,770 @@ func (x *IRCServer) GetHost() string {
 	return ""
 }
 
-func (x *IRCServer) GetPort() int32 {
+func (x *IRCServer) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *IRCServer) GetUseTls() bool {
+	if x != nil {
+		return x.UseTls
+	}
+	return false
+}
+
+func (x *IRCServer) GetNick() string {
+	if x != nil {
+		return x.Nick
+	}
+	return ""
+}
+
+func (x *IRCServer) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *IRCServer) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *IRCServer) GetFallbackServers() []*Endpoint {
+	if x != nil {
+		return x.FallbackServers
+	}
+	return nil
+}
+
+func (x *IRCServer) GetReconnectMinDelaySecs() int32 {
+	if x != nil {
+		return x.ReconnectMinDelaySecs
+	}
+	return 0
+}
+
+func (x *IRCServer) GetReconnectMaxDelaySecs() int32 {
+	if x != nil {
+		return x.ReconnectMaxDelaySecs
+	}
+	return 0
+}
+
+func (x *IRCServer) GetSasl() *SASL {
+	if x != nil {
+		return x.Sasl
+	}
+	return nil
+}
+
+func (x *IRCServer) GetTls() *UpstreamTLS {
+	if x != nil {
+		return x.Tls
+	}
+	return nil
+}
+
+func (x *IRCServer) GetMultiline() bool {
+	if x != nil {
+		return x.Multiline
+	}
+	return false
+}
+
+func (x *IRCServer) GetSendBurst() int32 {
+	if x != nil {
+		return x.SendBurst
+	}
+	return 0
+}
+
+func (x *IRCServer) GetSendRate() float64 {
+	if x != nil {
+		return x.SendRate
+	}
+	return 0
+}
+
+func (x *IRCServer) GetSendFair() bool {
+	if x != nil {
+		return x.SendFair
+	}
+	return false
+}
+
+func (x *IRCServer) GetAltNicks() []string {
+	if x != nil {
+		return x.AltNicks
+	}
+	return nil
+}
+
+func (x *IRCServer) GetNickRegainIntervalSecs() int32 {
+	if x != nil {
+		return x.NickRegainIntervalSecs
+	}
+	return 0
+}
+
+func (x *IRCServer) GetNickserv() *NickServ {
+	if x != nil {
+		return x.Nickserv
+	}
+	return nil
+}
+
+// Login to the network's NickServ, for networks or accounts without SASL.
+// The bot identifies after connecting, and can have a session holding its
+// nick (e.g. its own, not yet timed out) let go of it.
+type NickServ struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Password      string                 `protobuf:"bytes,1,opt,name=password,proto3" json:"password,omitempty"`
+	Account       string                 `protobuf:"bytes,2,opt,name=account,proto3" json:"account,omitempty"` // Default: nick
+	Recover       NickServ_Recover       `protobuf:"varint,3,opt,name=recover,proto3,enum=config.NickServ_Recover" json:"recover,omitempty"`
+	Service       string                 `protobuf:"bytes,4,opt,name=service,proto3" json:"service,omitempty"` // Default "NickServ"
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NickServ) Reset() {
+	*x = NickServ{}
+	mi := &file_proto_config_config_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NickServ) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NickServ) ProtoMessage() {}
+
+func (x *NickServ) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NickServ.ProtoReflect.Descriptor instead.
+func (*NickServ) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *NickServ) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *NickServ) GetAccount() string {
+	if x != nil {
+		return x.Account
+	}
+	return ""
+}
+
+func (x *NickServ) GetRecover() NickServ_Recover {
+	if x != nil {
+		return x.Recover
+	}
+	return NickServ_NONE
+}
+
+func (x *NickServ) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+// Trust settings for the IRC server's certificate. By default it must chain
+// to a system root and match the host name.
+type UpstreamTLS struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	CaFile string                 `protobuf:"bytes,1,opt,name=ca_file,json=caFile,proto3" json:"ca_file,omitempty"` // Trust only these CAs (PEM), e.g. for a self-signed network
+	// SHA-256 fingerprints of accepted server certificates, in hex (colons
+	// optional). If set, a certificate matching one of them is accepted
+	// without any other checks, and no other certificate is.
+	Fingerprints       []string   `protobuf:"bytes,2,rep,name=fingerprints,proto3" json:"fingerprints,omitempty"`
+	InsecureSkipVerify bool       `protobuf:"varint,3,opt,name=insecure_skip_verify,json=insecureSkipVerify,proto3" json:"insecure_skip_verify,omitempty"` // Accept any certificate. Not recommended.
+	MinVersion         TLSVersion `protobuf:"varint,4,opt,name=min_version,json=minVersion,proto3,enum=config.TLSVersion" json:"min_version,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *UpstreamTLS) Reset() {
+	*x = UpstreamTLS{}
+	mi := &file_proto_config_config_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpstreamTLS) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpstreamTLS) ProtoMessage() {}
+
+func (x *UpstreamTLS) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpstreamTLS.ProtoReflect.Descriptor instead.
+func (*UpstreamTLS) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UpstreamTLS) GetCaFile() string {
+	if x != nil {
+		return x.CaFile
+	}
+	return ""
+}
+
+func (x *UpstreamTLS) GetFingerprints() []string {
+	if x != nil {
+		return x.Fingerprints
+	}
+	return nil
+}
+
+func (x *UpstreamTLS) GetInsecureSkipVerify() bool {
+	if x != nil {
+		return x.InsecureSkipVerify
+	}
+	return false
+}
+
+func (x *UpstreamTLS) GetMinVersion() TLSVersion {
+	if x != nil {
+		return x.MinVersion
+	}
+	return TLSVersion_TLS_DEFAULT
+}
+
+// SASL account login for the upstream connection.
+type SASL struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Mechanism SASL_Mechanism         `protobuf:"varint,1,opt,name=mechanism,proto3,enum=config.SASL_Mechanism" json:"mechanism,omitempty"`
+	Username  string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`                 // PLAIN
+	Password  string                 `protobuf:"bytes,3,opt,name=password,proto3" json:"password,omitempty"`                 // PLAIN
+	CertFile  string                 `protobuf:"bytes,4,opt,name=cert_file,json=certFile,proto3" json:"cert_file,omitempty"` // EXTERNAL: client certificate (PEM)
+	KeyFile   string                 `protobuf:"bytes,5,opt,name=key_file,json=keyFile,proto3" json:"key_file,omitempty"`    // EXTERNAL: its private key (PEM)
+	// Stop connecting if authentication fails. By default the bot reconnects
+	// and carries on without logging in.
+	AbortOnFailure bool `protobuf:"varint,6,opt,name=abort_on_failure,json=abortOnFailure,proto3" json:"abort_on_failure,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *SASL) Reset() {
+	*x = SASL{}
+	mi := &file_proto_config_config_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SASL) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SASL) ProtoMessage() {}
+
+func (x *SASL) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SASL.ProtoReflect.Descriptor instead.
+func (*SASL) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SASL) GetMechanism() SASL_Mechanism {
+	if x != nil {
+		return x.Mechanism
+	}
+	return SASL_PLAIN
+}
+
+func (x *SASL) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *SASL) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *SASL) GetCertFile() string {
+	if x != nil {
+		return x.CertFile
+	}
+	return ""
+}
+
+func (x *SASL) GetKeyFile() string {
+	if x != nil {
+		return x.KeyFile
+	}
+	return ""
+}
+
+func (x *SASL) GetAbortOnFailure() bool {
+	if x != nil {
+		return x.AbortOnFailure
+	}
+	return false
+}
+
+type Channel struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`                                        // Channel key/password
+	HistoryLimit  int32                  `protobuf:"varint,3,opt,name=history_limit,json=historyLimit,proto3" json:"history_limit,omitempty"` // Number of messages to keep in history
+	Storage       HistoryStorage         `protobuf:"varint,4,opt,name=storage,proto3,enum=config.HistoryStorage" json:"storage,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Channel) Reset() {
+	*x = Channel{}
+	mi := &file_proto_config_config_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Channel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Channel) ProtoMessage() {}
+
+func (x *Channel) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Channel.ProtoReflect.Descriptor instead.
+func (*Channel) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Channel) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Channel) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Channel) GetHistoryLimit() int32 {
+	if x != nil {
+		return x.HistoryLimit
+	}
+	return 0
+}
+
+func (x *Channel) GetStorage() HistoryStorage {
+	if x != nil {
+		return x.Storage
+	}
+	return HistoryStorage_HISTORY_MEMORY
+}
+
+type TLS struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CaFile         string                 `protobuf:"bytes,1,opt,name=ca_file,json=caFile,proto3" json:"ca_file,omitempty"`
+	CertFile       string                 `protobuf:"bytes,2,opt,name=cert_file,json=certFile,proto3" json:"cert_file,omitempty"`                     // Server cert
+	KeyFile        string                 `protobuf:"bytes,3,opt,name=key_file,json=keyFile,proto3" json:"key_file,omitempty"`                        // Server key
+	ClientCn       string                 `protobuf:"bytes,4,opt,name=client_cn,json=clientCn,proto3" json:"client_cn,omitempty"`                     // Expected CN for client (server-side check); same as an allowed_clients entry with only cn
+	ClientCertFile string                 `protobuf:"bytes,5,opt,name=client_cert_file,json=clientCertFile,proto3" json:"client_cert_file,omitempty"` // Client cert
+	ClientKeyFile  string                 `protobuf:"bytes,6,opt,name=client_key_file,json=clientKeyFile,proto3" json:"client_key_file,omitempty"`    // Client key
+	// Client certificates the server accepts, besides client_cn. With neither
+	// set, any certificate signed by ca_file is accepted.
+	AllowedClients []*ClientIdentity `protobuf:"bytes,7,rep,name=allowed_clients,json=allowedClients,proto3" json:"allowed_clients,omitempty"`
+	// Revoked client certificates: a CRL signed by the CA (PEM or DER), and
+	// SHA-256 fingerprints in hex. All TLS files are read again on SIGHUP, and
+	// clients whose certificate is no longer accepted are disconnected.
+	CrlFile             string   `protobuf:"bytes,8,opt,name=crl_file,json=crlFile,proto3" json:"crl_file,omitempty"`
+	RevokedFingerprints []string `protobuf:"bytes,9,rep,name=revoked_fingerprints,json=revokedFingerprints,proto3" json:"revoked_fingerprints,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *TLS) Reset() {
+	*x = TLS{}
+	mi := &file_proto_config_config_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TLS) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TLS) ProtoMessage() {}
+
+func (x *TLS) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TLS.ProtoReflect.Descriptor instead.
+func (*TLS) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TLS) GetCaFile() string {
+	if x != nil {
+		return x.CaFile
+	}
+	return ""
+}
+
+func (x *TLS) GetCertFile() string {
+	if x != nil {
+		return x.CertFile
+	}
+	return ""
+}
+
+func (x *TLS) GetKeyFile() string {
+	if x != nil {
+		return x.KeyFile
+	}
+	return ""
+}
+
+func (x *TLS) GetClientCn() string {
+	if x != nil {
+		return x.ClientCn
+	}
+	return ""
+}
+
+func (x *TLS) GetClientCertFile() string {
+	if x != nil {
+		return x.ClientCertFile
+	}
+	return ""
+}
+
+func (x *TLS) GetClientKeyFile() string {
+	if x != nil {
+		return x.ClientKeyFile
+	}
+	return ""
+}
+
+func (x *TLS) GetAllowedClients() []*ClientIdentity {
+	if x != nil {
+		return x.AllowedClients
+	}
+	return nil
+}
+
+func (x *TLS) GetCrlFile() string {
+	if x != nil {
+		return x.CrlFile
+	}
+	return ""
+}
+
+func (x *TLS) GetRevokedFingerprints() []string {
+	if x != nil {
+		return x.RevokedFingerprints
+	}
+	return nil
+}
+
+// A client certificate the server accepts. Every field that is set must
+// match.
+type ClientIdentity struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`                   // Who this is, for logs and the client list; defaults to the CN
+	Cn            string                 `protobuf:"bytes,2,opt,name=cn,proto3" json:"cn,omitempty"`                       // Subject common name
+	DnsSan        string                 `protobuf:"bytes,3,opt,name=dns_san,json=dnsSan,proto3" json:"dns_san,omitempty"` // A DNS subject alternative name
+	UriSan        string                 `protobuf:"bytes,4,opt,name=uri_san,json=uriSan,proto3" json:"uri_san,omitempty"` // A URI subject alternative name, e.g. "spiffe://home/laptop"
+	Fingerprint   string                 `protobuf:"bytes,5,opt,name=fingerprint,proto3" json:"fingerprint,omitempty"`     // SHA-256 of the certificate, in hex (colons optional)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClientIdentity) Reset() {
+	*x = ClientIdentity{}
+	mi := &file_proto_config_config_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClientIdentity) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientIdentity) ProtoMessage() {}
+
+func (x *ClientIdentity) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientIdentity.ProtoReflect.Descriptor instead.
+func (*ClientIdentity) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ClientIdentity) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ClientIdentity) GetCn() string {
+	if x != nil {
+		return x.Cn
+	}
+	return ""
+}
+
+func (x *ClientIdentity) GetDnsSan() string {
+	if x != nil {
+		return x.DnsSan
+	}
+	return ""
+}
+
+func (x *ClientIdentity) GetUriSan() string {
+	if x != nil {
+		return x.UriSan
+	}
+	return ""
+}
+
+func (x *ClientIdentity) GetFingerprint() string {
+	if x != nil {
+		return x.Fingerprint
+	}
+	return ""
+}
+
+type Service struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Port  int32                  `protobuf:"varint,1,opt,name=port,proto3" json:"port,omitempty"`
+	// Deprecated: use global tls config
+	CertFile string `protobuf:"bytes,2,opt,name=cert_file,json=certFile,proto3" json:"cert_file,omitempty"`
+	KeyFile  string `protobuf:"bytes,3,opt,name=key_file,json=keyFile,proto3" json:"key_file,omitempty"`
+	// Bearer token clients must send. The client sends the one in its own
+	// config. Leave unset, with no client_tokens, to accept any client.
+	ClientPasskey    string         `protobuf:"bytes,4,opt,name=client_passkey,json=clientPasskey,proto3" json:"client_passkey,omitempty"`
+	Host             string         `protobuf:"bytes,5,opt,name=host,proto3" json:"host,omitempty"`
+	ShutdownPassword string         `protobuf:"bytes,6,opt,name=shutdown_password,json=shutdownPassword,proto3" json:"shutdown_password,omitempty"`
+	ClientQueueSize  int32          `protobuf:"varint,7,opt,name=client_queue_size,json=clientQueueSize,proto3" json:"client_queue_size,omitempty"` // Events buffered per client (default 256)
+	OverflowPolicy   OverflowPolicy `protobuf:"varint,8,opt,name=overflow_policy,json=overflowPolicy,proto3,enum=config.OverflowPolicy" json:"overflow_policy,omitempty"`
+	// How fast each client may send messages: client_send_rate per second
+	// after a burst of client_send_burst. Messages beyond that are refused.
+	// Clients are told apart by certificate or token, else by IP address.
+	ClientSendBurst int32   `protobuf:"varint,9,opt,name=client_send_burst,json=clientSendBurst,proto3" json:"client_send_burst,omitempty"` // Default 10
+	ClientSendRate  float64 `protobuf:"fixed64,10,opt,name=client_send_rate,json=clientSendRate,proto3" json:"client_send_rate,omitempty"`  // Default 1
+	// Further accepted tokens, each for one client, stored as bcrypt hashes.
+	// Generate a hash with `server -hash-token`.
+	ClientTokens  []*ClientToken `protobuf:"bytes,11,rep,name=client_tokens,json=clientTokens,proto3" json:"client_tokens,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Service) Reset() {
+	*x = Service{}
+	mi := &file_proto_config_config_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Service) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Service) ProtoMessage() {}
+
+func (x *Service) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Service.ProtoReflect.Descriptor instead.
+func (*Service) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Service) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *Service) GetCertFile() string {
+	if x != nil {
+		return x.CertFile
+	}
+	return ""
+}
+
+func (x *Service) GetKeyFile() string {
+	if x != nil {
+		return x.KeyFile
+	}
+	return ""
+}
+
+func (x *Service) GetClientPasskey() string {
+	if x != nil {
+		return x.ClientPasskey
+	}
+	return ""
+}
+
+func (x *Service) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *Service) GetShutdownPassword() string {
+	if x != nil {
+		return x.ShutdownPassword
+	}
+	return ""
+}
+
+func (x *Service) GetClientQueueSize() int32 {
 	if x != nil {
-		return x.Port
+		return x.ClientQueueSize
 	}
 	return 0
 }
 
-func (x *IRCServer) GetUseTls() bool {
+func (x *Service) GetOverflowPolicy() OverflowPolicy {
 	if x != nil {
-		return x.UseTls
+		return x.OverflowPolicy
 	}
-	return false
+	return OverflowPolicy_OVERFLOW_DROP_OLDEST
 }
 
-func (x *IRCServer) GetNick() string {
+func (x *Service) GetClientSendBurst() int32 {
 	if x != nil {
-		return x.Nick
+		return x.ClientSendBurst
 	}
-	return ""
+	return 0
 }
 
-func (x *IRCServer) GetUser() string {
+func (x *Service) GetClientSendRate() float64 {
 	if x != nil {
-		return x.User
+		return x.ClientSendRate
 	}
-	return ""
+	return 0
 }
 
-func (x *IRCServer) GetPassword() string {
+func (x *Service) GetClientTokens() []*ClientToken {
 	if x != nil {
-		return x.Password
+		return x.ClientTokens
 	}
-	return ""
+	return nil
 }
 
-type Channel struct {
+type ClientToken struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Key           string                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`                                        // Channel key/password
-	HistoryLimit  int32                  `protobuf:"varint,3,opt,name=history_limit,json=historyLimit,proto3" json:"history_limit,omitempty"` // Number of messages to keep in history
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"` // Who the token was given to; shown in logs
+	BcryptHash    string                 `protobuf:"bytes,2,opt,name=bcrypt_hash,json=bcryptHash,proto3" json:"bcrypt_hash,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Channel) Reset() {
-	*x = Channel{}
-	mi := &file_proto_config_config_proto_msgTypes[1]
+func (x *ClientToken) Reset() {
+	*x = ClientToken{}
+	mi := &file_proto_config_config_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Channel) String() string {
+func (x *ClientToken) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Channel) ProtoMessage() {}
+func (*ClientToken) ProtoMessage() {}
 
-func (x *Channel) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_config_config_proto_msgTypes[1]
+func (x *ClientToken) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -139,59 +1161,62 @@ func (x *Channel) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Channel.ProtoReflect.Descriptor instead.
-func (*Channel) Descriptor() ([]byte, []int) {
-	return file_proto_config_config_proto_rawDescGZIP(), []int{1}
+// Deprecated: Use ClientToken.ProtoReflect.Descriptor instead.
+func (*ClientToken) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{9}
 }
 
-func (x *Channel) GetName() string {
+func (x *ClientToken) GetName() string {
 	if x != nil {
 		return x.Name
 	}
 	return ""
 }
 
-func (x *Channel) GetKey() string {
+func (x *ClientToken) GetBcryptHash() string {
 	if x != nil {
-		return x.Key
+		return x.BcryptHash
 	}
 	return ""
 }
 
-func (x *Channel) GetHistoryLimit() int32 {
-	if x != nil {
-		return x.HistoryLimit
-	}
-	return 0
-}
-
-type TLS struct {
-	state          protoimpl.MessageState `protogen:"open.v1"`
-	CaFile         string                 `protobuf:"bytes,1,opt,name=ca_file,json=caFile,proto3" json:"ca_file,omitempty"`
-	CertFile       string                 `protobuf:"bytes,2,opt,name=cert_file,json=certFile,proto3" json:"cert_file,omitempty"`                     // Server cert
-	KeyFile        string                 `protobuf:"bytes,3,opt,name=key_file,json=keyFile,proto3" json:"key_file,omitempty"`                        // Server key
-	ClientCn       string                 `protobuf:"bytes,4,opt,name=client_cn,json=clientCn,proto3" json:"client_cn,omitempty"`                     // Expected CN for client (server-side check)
-	ClientCertFile string                 `protobuf:"bytes,5,opt,name=client_cert_file,json=clientCertFile,proto3" json:"client_cert_file,omitempty"` // Client cert
-	ClientKeyFile  string                 `protobuf:"bytes,6,opt,name=client_key_file,json=clientKeyFile,proto3" json:"client_key_file,omitempty"`    // Client key
-	unknownFields  protoimpl.UnknownFields
-	sizeCache      protoimpl.SizeCache
+type Config struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// A single network, with no name. Use networks for more than one.
+	Irc        *IRCServer `protobuf:"bytes,1,opt,name=irc,proto3" json:"irc,omitempty"`
+	Channels   []*Channel `protobuf:"bytes,2,rep,name=channels,proto3" json:"channels,omitempty"`
+	Service    *Service   `protobuf:"bytes,3,opt,name=service,proto3" json:"service,omitempty"`
+	Tls        *TLS       `protobuf:"bytes,4,opt,name=tls,proto3" json:"tls,omitempty"`
+	HistoryDir string     `protobuf:"bytes,5,opt,name=history_dir,json=historyDir,proto3" json:"history_dir,omitempty"` // Directory for on-disk history (default "history")
+	// History of private conversations (queries). A query's buffer is created
+	// when the first message to or from that nick arrives.
+	QueryHistoryLimit int32          `protobuf:"varint,6,opt,name=query_history_limit,json=queryHistoryLimit,proto3" json:"query_history_limit,omitempty"` // Default 100
+	QueryStorage      HistoryStorage `protobuf:"varint,7,opt,name=query_storage,json=queryStorage,proto3,enum=config.HistoryStorage" json:"query_storage,omitempty"`
+	// Query buffers open at once (default 100). To make room for another, the
+	// one used least recently is closed; on disk its history stays.
+	MaxQueries    int32         `protobuf:"varint,11,opt,name=max_queries,json=maxQueries,proto3" json:"max_queries,omitempty"`
+	Client        *ClientConfig `protobuf:"bytes,8,opt,name=client,proto3" json:"client,omitempty"` // Only read by the client
+	Networks      []*Network    `protobuf:"bytes,9,rep,name=networks,proto3" json:"networks,omitempty"`
+	IrcListener   *IRCListener  `protobuf:"bytes,10,opt,name=irc_listener,json=ircListener,proto3" json:"irc_listener,omitempty"` // Off if unset
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *TLS) Reset() {
-	*x = TLS{}
-	mi := &file_proto_config_config_proto_msgTypes[2]
+func (x *Config) Reset() {
+	*x = Config{}
+	mi := &file_proto_config_config_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *TLS) String() string {
+func (x *Config) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*TLS) ProtoMessage() {}
+func (*Config) ProtoMessage() {}
 
-func (x *TLS) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_config_config_proto_msgTypes[2]
+func (x *Config) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -202,81 +1227,117 @@ func (x *TLS) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use TLS.ProtoReflect.Descriptor instead.
-func (*TLS) Descriptor() ([]byte, []int) {
-	return file_proto_config_config_proto_rawDescGZIP(), []int{2}
+// Deprecated: Use Config.ProtoReflect.Descriptor instead.
+func (*Config) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{10}
 }
 
-func (x *TLS) GetCaFile() string {
+func (x *Config) GetIrc() *IRCServer {
 	if x != nil {
-		return x.CaFile
+		return x.Irc
 	}
-	return ""
+	return nil
 }
 
-func (x *TLS) GetCertFile() string {
+func (x *Config) GetChannels() []*Channel {
 	if x != nil {
-		return x.CertFile
+		return x.Channels
 	}
-	return ""
+	return nil
 }
 
-func (x *TLS) GetKeyFile() string {
+func (x *Config) GetService() *Service {
 	if x != nil {
-		return x.KeyFile
+		return x.Service
 	}
-	return ""
+	return nil
 }
 
-func (x *TLS) GetClientCn() string {
+func (x *Config) GetTls() *TLS {
 	if x != nil {
-		return x.ClientCn
+		return x.Tls
 	}
-	return ""
+	return nil
 }
 
-func (x *TLS) GetClientCertFile() string {
+func (x *Config) GetHistoryDir() string {
 	if x != nil {
-		return x.ClientCertFile
+		return x.HistoryDir
 	}
 	return ""
 }
 
-func (x *TLS) GetClientKeyFile() string {
+func (x *Config) GetQueryHistoryLimit() int32 {
 	if x != nil {
-		return x.ClientKeyFile
+		return x.QueryHistoryLimit
 	}
-	return ""
+	return 0
 }
 
-type Service struct {
-	state protoimpl.MessageState `protogen:"open.v1"`
-	Port  int32                  `protobuf:"varint,1,opt,name=port,proto3" json:"port,omitempty"`
-	// Deprecated: use global tls config
-	CertFile         string `protobuf:"bytes,2,opt,name=cert_file,json=certFile,proto3" json:"cert_file,omitempty"`
-	KeyFile          string `protobuf:"bytes,3,opt,name=key_file,json=keyFile,proto3" json:"key_file,omitempty"`
-	ClientPasskey    string `protobuf:"bytes,4,opt,name=client_passkey,json=clientPasskey,proto3" json:"client_passkey,omitempty"` // Simple auth for now
-	Host             string `protobuf:"bytes,5,opt,name=host,proto3" json:"host,omitempty"`
-	ShutdownPassword string `protobuf:"bytes,6,opt,name=shutdown_password,json=shutdownPassword,proto3" json:"shutdown_password,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+func (x *Config) GetQueryStorage() HistoryStorage {
+	if x != nil {
+		return x.QueryStorage
+	}
+	return HistoryStorage_HISTORY_MEMORY
 }
 
-func (x *Service) Reset() {
-	*x = Service{}
-	mi := &file_proto_config_config_proto_msgTypes[3]
+func (x *Config) GetMaxQueries() int32 {
+	if x != nil {
+		return x.MaxQueries
+	}
+	return 0
+}
+
+func (x *Config) GetClient() *ClientConfig {
+	if x != nil {
+		return x.Client
+	}
+	return nil
+}
+
+func (x *Config) GetNetworks() []*Network {
+	if x != nil {
+		return x.Networks
+	}
+	return nil
+}
+
+func (x *Config) GetIrcListener() *IRCListener {
+	if x != nil {
+		return x.IrcListener
+	}
+	return nil
+}
+
+// A listener for ordinary IRC clients (irssi, WeeChat, HexChat...). They log
+// in with PASS and a client token (service.client_passkey or client_tokens),
+// and pick a network with a username of "name/network"; without one they get
+// the unnamed network, or the only one there is.
+type IRCListener struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Host          string                 `protobuf:"bytes,1,opt,name=host,proto3" json:"host,omitempty"`
+	Port          int32                  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`                   // Default 6697 with TLS, 6667 without
+	UseTls        bool                   `protobuf:"varint,3,opt,name=use_tls,json=useTls,proto3" json:"use_tls,omitempty"` // Serve TLS with the tls section's server certificate
+	Playback      int32                  `protobuf:"varint,4,opt,name=playback,proto3" json:"playback,omitempty"`           // Messages per channel replayed on attach (default 50)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IRCListener) Reset() {
+	*x = IRCListener{}
+	mi := &file_proto_config_config_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Service) String() string {
+func (x *IRCListener) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Service) ProtoMessage() {}
+func (*IRCListener) ProtoMessage() {}
 
-func (x *Service) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_config_config_proto_msgTypes[3]
+func (x *IRCListener) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -287,78 +1348,135 @@ func (x *Service) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Service.ProtoReflect.Descriptor instead.
-func (*Service) Descriptor() ([]byte, []int) {
-	return file_proto_config_config_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use IRCListener.ProtoReflect.Descriptor instead.
+func (*IRCListener) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{11}
 }
 
-func (x *Service) GetPort() int32 {
+func (x *IRCListener) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *IRCListener) GetPort() int32 {
 	if x != nil {
 		return x.Port
 	}
 	return 0
 }
 
-func (x *Service) GetCertFile() string {
+func (x *IRCListener) GetUseTls() bool {
 	if x != nil {
-		return x.CertFile
+		return x.UseTls
 	}
-	return ""
+	return false
 }
 
-func (x *Service) GetKeyFile() string {
+func (x *IRCListener) GetPlayback() int32 {
 	if x != nil {
-		return x.KeyFile
+		return x.Playback
 	}
-	return ""
+	return 0
 }
 
-func (x *Service) GetClientPasskey() string {
+// An IRC network the bouncer stays connected to, with its own identity and
+// channels.
+type Network struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Short name, e.g. "libera". Clients see channels as "libera/#channel".
+	// It can't contain "/" or start with a channel prefix or "_".
+	Name          string     `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Irc           *IRCServer `protobuf:"bytes,2,opt,name=irc,proto3" json:"irc,omitempty"`
+	Channels      []*Channel `protobuf:"bytes,3,rep,name=channels,proto3" json:"channels,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Network) Reset() {
+	*x = Network{}
+	mi := &file_proto_config_config_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Network) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Network) ProtoMessage() {}
+
+func (x *Network) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[12]
 	if x != nil {
-		return x.ClientPasskey
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return ""
+	return mi.MessageOf(x)
 }
 
-func (x *Service) GetHost() string {
+// Deprecated: Use Network.ProtoReflect.Descriptor instead.
+func (*Network) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Network) GetName() string {
 	if x != nil {
-		return x.Host
+		return x.Name
 	}
 	return ""
 }
 
-func (x *Service) GetShutdownPassword() string {
+func (x *Network) GetIrc() *IRCServer {
 	if x != nil {
-		return x.ShutdownPassword
+		return x.Irc
 	}
-	return ""
+	return nil
 }
 
-type Config struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Irc           *IRCServer             `protobuf:"bytes,1,opt,name=irc,proto3" json:"irc,omitempty"`
-	Channels      []*Channel             `protobuf:"bytes,2,rep,name=channels,proto3" json:"channels,omitempty"`
-	Service       *Service               `protobuf:"bytes,3,opt,name=service,proto3" json:"service,omitempty"`
-	Tls           *TLS                   `protobuf:"bytes,4,opt,name=tls,proto3" json:"tls,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+func (x *Network) GetChannels() []*Channel {
+	if x != nil {
+		return x.Channels
+	}
+	return nil
 }
 
-func (x *Config) Reset() {
-	*x = Config{}
-	mi := &file_proto_config_config_proto_msgTypes[4]
+// How the client reaches the server, and how it looks. Unset fields fall back
+// to the server's sections of the same file, so one file can serve both.
+type ClientConfig struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ServerAddress   string                 `protobuf:"bytes,1,opt,name=server_address,json=serverAddress,proto3" json:"server_address,omitempty"`       // host:port; default service.host and service.port, or localhost:50051
+	ServerName      string                 `protobuf:"bytes,2,opt,name=server_name,json=serverName,proto3" json:"server_name,omitempty"`                // Name to verify the server's certificate against; default the host of server_address
+	CaFile          string                 `protobuf:"bytes,3,opt,name=ca_file,json=caFile,proto3" json:"ca_file,omitempty"`                            // Default tls.ca_file
+	CertFile        string                 `protobuf:"bytes,4,opt,name=cert_file,json=certFile,proto3" json:"cert_file,omitempty"`                      // Default tls.client_cert_file
+	KeyFile         string                 `protobuf:"bytes,5,opt,name=key_file,json=keyFile,proto3" json:"key_file,omitempty"`                         // Default tls.client_key_file
+	Token           string                 `protobuf:"bytes,6,opt,name=token,proto3" json:"token,omitempty"`                                            // Bearer token; default service.client_passkey
+	InitialHistory  int32                  `protobuf:"varint,7,opt,name=initial_history,json=initialHistory,proto3" json:"initial_history,omitempty"`   // Messages per channel fetched on connect (default 50)
+	TimestampFormat string                 `protobuf:"bytes,8,opt,name=timestamp_format,json=timestampFormat,proto3" json:"timestamp_format,omitempty"` // Go time layout for scrollback (default "15:04")
+	StartChannel    string                 `protobuf:"bytes,9,opt,name=start_channel,json=startChannel,proto3" json:"start_channel,omitempty"`          // Channel shown first; default the first configured channel
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ClientConfig) Reset() {
+	*x = ClientConfig{}
+	mi := &file_proto_config_config_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Config) String() string {
+func (x *ClientConfig) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Config) ProtoMessage() {}
+func (*ClientConfig) ProtoMessage() {}
 
-func (x *Config) ProtoReflect() protoreflect.Message {
-	mi := &file_proto_config_config_proto_msgTypes[4]
+func (x *ClientConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_config_config_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -369,37 +1487,72 @@ func (x *Config) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Config.ProtoReflect.Descriptor instead.
-func (*Config) Descriptor() ([]byte, []int) {
-	return file_proto_config_config_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use ClientConfig.ProtoReflect.Descriptor instead.
+func (*ClientConfig) Descriptor() ([]byte, []int) {
+	return file_proto_config_config_proto_rawDescGZIP(), []int{13}
 }
 
-func (x *Config) GetIrc() *IRCServer {
+func (x *ClientConfig) GetServerAddress() string {
 	if x != nil {
-		return x.Irc
+		return x.ServerAddress
 	}
-	return nil
+	return ""
 }
 
-func (x *Config) GetChannels() []*Channel {
+func (x *ClientConfig) GetServerName() string {
 	if x != nil {
-		return x.Channels
+		return x.ServerName
 	}
-	return nil
+	return ""
 }
 
-func (x *Config) GetService() *Service {
+func (x *ClientConfig) GetCaFile() string {
 	if x != nil {
-		return x.Service
+		return x.CaFile
 	}
-	return nil
+	return ""
 }
 
-func (x *Config) GetTls() *TLS {
+func (x *ClientConfig) GetCertFile() string {
 	if x != nil {
-		return x.Tls
+		return x.CertFile
 	}
-	return nil
+	return ""
+}
+
+func (x *ClientConfig) GetKeyFile() string {
+	if x != nil {
+		return x.KeyFile
+	}
+	return ""
+}
+
+func (x *ClientConfig) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *ClientConfig) GetInitialHistory() int32 {
+	if x != nil {
+		return x.InitialHistory
+	}
+	return 0
+}
+
+func (x *ClientConfig) GetTimestampFormat() string {
+	if x != nil {
+		return x.TimestampFormat
+	}
+	return ""
+}
+
+func (x *ClientConfig) GetStartChannel() string {
+	if x != nil {
+		return x.StartChannel
+	}
+	return ""
 }
 
 var File_proto_config_config_proto protoreflect.FileDescriptor
@@ -407,59 +1560,240 @@ var File_proto_config_config_proto protoreflect.FileDescriptor
 var file_proto_config_config_proto_rawDesc = string([]byte{
 	0x0a, 0x19, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2f, 0x63,
 	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x06, 0x63, 0x6f, 0x6e,
-	0x66, 0x69, 0x67, 0x22, 0x90, 0x01, 0x0a, 0x09, 0x49, 0x52, 0x43, 0x53, 0x65, 0x72, 0x76, 0x65,
-	0x72, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x05, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x75, 0x73, 0x65,
-	0x5f, 0x74, 0x6c, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x75, 0x73, 0x65, 0x54,
-	0x6c, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x69, 0x63, 0x6b, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x04, 0x6e, 0x69, 0x63, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x75, 0x73, 0x65, 0x72, 0x18, 0x05,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x73, 0x65, 0x72, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x61,
-	0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70, 0x61,
-	0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x22, 0x54, 0x0a, 0x07, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65,
-	0x6c, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
-	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x23, 0x0a, 0x0d, 0x68, 0x69, 0x73, 0x74, 0x6f,
-	0x72, 0x79, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c,
-	0x68, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x22, 0xc5, 0x01, 0x0a,
-	0x03, 0x54, 0x4c, 0x53, 0x12, 0x17, 0x0a, 0x07, 0x63, 0x61, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x61, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x1b, 0x0a,
-	0x09, 0x63, 0x65, 0x72, 0x74, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x08, 0x63, 0x65, 0x72, 0x74, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x6b, 0x65,
-	0x79, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6b, 0x65,
-	0x79, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f,
-	0x63, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74,
-	0x43, 0x6e, 0x12, 0x28, 0x0a, 0x10, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x63, 0x65, 0x72,
-	0x74, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x63, 0x6c,
-	0x69, 0x65, 0x6e, 0x74, 0x43, 0x65, 0x72, 0x74, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x26, 0x0a, 0x0f,
-	0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x6b, 0x65, 0x79, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18,
-	0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x4b, 0x65, 0x79,
-	0x46, 0x69, 0x6c, 0x65, 0x22, 0xbd, 0x01, 0x0a, 0x07, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
-	0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04,
-	0x70, 0x6f, 0x72, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x65, 0x72, 0x74, 0x5f, 0x66, 0x69, 0x6c,
-	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x65, 0x72, 0x74, 0x46, 0x69, 0x6c,
-	0x65, 0x12, 0x19, 0x0a, 0x08, 0x6b, 0x65, 0x79, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x03, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x07, 0x6b, 0x65, 0x79, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x25, 0x0a, 0x0e,
-	0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x70, 0x61, 0x73, 0x73, 0x6b, 0x65, 0x79, 0x18, 0x04,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x50, 0x61, 0x73, 0x73,
-	0x6b, 0x65, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x2b, 0x0a, 0x11, 0x73, 0x68, 0x75, 0x74, 0x64,
-	0x6f, 0x77, 0x6e, 0x5f, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x06, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x10, 0x73, 0x68, 0x75, 0x74, 0x64, 0x6f, 0x77, 0x6e, 0x50, 0x61, 0x73, 0x73,
-	0x77, 0x6f, 0x72, 0x64, 0x22, 0xa4, 0x01, 0x0a, 0x06, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12,
-	0x23, 0x0a, 0x03, 0x69, 0x72, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x63,
+	0x66, 0x69, 0x67, 0x22, 0x32, 0x0a, 0x08, 0x45, 0x6e, 0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x12,
+	0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x68,
+	0x6f, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x22, 0x85, 0x05, 0x0a, 0x09, 0x49, 0x52, 0x43, 0x53,
+	0x65, 0x72, 0x76, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72,
+	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x17, 0x0a,
+	0x07, 0x75, 0x73, 0x65, 0x5f, 0x74, 0x6c, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06,
+	0x75, 0x73, 0x65, 0x54, 0x6c, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x69, 0x63, 0x6b, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x69, 0x63, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x75, 0x73,
+	0x65, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x73, 0x65, 0x72, 0x12, 0x1a,
+	0x0a, 0x08, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x12, 0x3b, 0x0a, 0x10, 0x66, 0x61,
+	0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x73, 0x18, 0x07,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x45, 0x6e,
+	0x64, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x52, 0x0f, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b,
+	0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x73, 0x12, 0x37, 0x0a, 0x18, 0x72, 0x65, 0x63, 0x6f, 0x6e,
+	0x6e, 0x65, 0x63, 0x74, 0x5f, 0x6d, 0x69, 0x6e, 0x5f, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x5f, 0x73,
+	0x65, 0x63, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x05, 0x52, 0x15, 0x72, 0x65, 0x63, 0x6f, 0x6e,
+	0x6e, 0x65, 0x63, 0x74, 0x4d, 0x69, 0x6e, 0x44, 0x65, 0x6c, 0x61, 0x79, 0x53, 0x65, 0x63, 0x73,
+	0x12, 0x37, 0x0a, 0x18, 0x72, 0x65, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x5f, 0x6d, 0x61,
+	0x78, 0x5f, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x5f, 0x73, 0x65, 0x63, 0x73, 0x18, 0x09, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x15, 0x72, 0x65, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x4d, 0x61, 0x78,
+	0x44, 0x65, 0x6c, 0x61, 0x79, 0x53, 0x65, 0x63, 0x73, 0x12, 0x20, 0x0a, 0x04, 0x73, 0x61, 0x73,
+	0x6c, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x2e, 0x53, 0x41, 0x53, 0x4c, 0x52, 0x04, 0x73, 0x61, 0x73, 0x6c, 0x12, 0x25, 0x0a, 0x03, 0x74,
+	0x6c, 0x73, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69,
+	0x67, 0x2e, 0x55, 0x70, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x54, 0x4c, 0x53, 0x52, 0x03, 0x74,
+	0x6c, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x6c, 0x69, 0x6e, 0x65, 0x18,
+	0x0c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x6d, 0x75, 0x6c, 0x74, 0x69, 0x6c, 0x69, 0x6e, 0x65,
+	0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x65, 0x6e, 0x64, 0x5f, 0x62, 0x75, 0x72, 0x73, 0x74, 0x18, 0x0d,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x73, 0x65, 0x6e, 0x64, 0x42, 0x75, 0x72, 0x73, 0x74, 0x12,
+	0x1b, 0x0a, 0x09, 0x73, 0x65, 0x6e, 0x64, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x18, 0x0e, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x08, 0x73, 0x65, 0x6e, 0x64, 0x52, 0x61, 0x74, 0x65, 0x12, 0x1b, 0x0a, 0x09,
+	0x73, 0x65, 0x6e, 0x64, 0x5f, 0x66, 0x61, 0x69, 0x72, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x08, 0x73, 0x65, 0x6e, 0x64, 0x46, 0x61, 0x69, 0x72, 0x12, 0x1b, 0x0a, 0x09, 0x61, 0x6c, 0x74,
+	0x5f, 0x6e, 0x69, 0x63, 0x6b, 0x73, 0x18, 0x10, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x61, 0x6c,
+	0x74, 0x4e, 0x69, 0x63, 0x6b, 0x73, 0x12, 0x39, 0x0a, 0x19, 0x6e, 0x69, 0x63, 0x6b, 0x5f, 0x72,
+	0x65, 0x67, 0x61, 0x69, 0x6e, 0x5f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x5f, 0x73,
+	0x65, 0x63, 0x73, 0x18, 0x11, 0x20, 0x01, 0x28, 0x05, 0x52, 0x16, 0x6e, 0x69, 0x63, 0x6b, 0x52,
+	0x65, 0x67, 0x61, 0x69, 0x6e, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x53, 0x65, 0x63,
+	0x73, 0x12, 0x2c, 0x0a, 0x08, 0x6e, 0x69, 0x63, 0x6b, 0x73, 0x65, 0x72, 0x76, 0x18, 0x12, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x4e, 0x69, 0x63,
+	0x6b, 0x53, 0x65, 0x72, 0x76, 0x52, 0x08, 0x6e, 0x69, 0x63, 0x6b, 0x73, 0x65, 0x72, 0x76, 0x22,
+	0xba, 0x01, 0x0a, 0x08, 0x4e, 0x69, 0x63, 0x6b, 0x53, 0x65, 0x72, 0x76, 0x12, 0x1a, 0x0a, 0x08,
+	0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08,
+	0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x63, 0x63, 0x6f,
+	0x75, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x63, 0x63, 0x6f, 0x75,
+	0x6e, 0x74, 0x12, 0x32, 0x0a, 0x07, 0x72, 0x65, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0e, 0x32, 0x18, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x4e, 0x69, 0x63,
+	0x6b, 0x53, 0x65, 0x72, 0x76, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x52, 0x07, 0x72,
+	0x65, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63,
+	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65,
+	0x22, 0x2a, 0x0a, 0x07, 0x52, 0x65, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x12, 0x08, 0x0a, 0x04, 0x4e,
+	0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x47, 0x48, 0x4f, 0x53, 0x54, 0x10, 0x01,
+	0x12, 0x0a, 0x0a, 0x06, 0x52, 0x45, 0x47, 0x41, 0x49, 0x4e, 0x10, 0x02, 0x22, 0xb1, 0x01, 0x0a,
+	0x0b, 0x55, 0x70, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x54, 0x4c, 0x53, 0x12, 0x17, 0x0a, 0x07,
+	0x63, 0x61, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63,
+	0x61, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x66, 0x69, 0x6e, 0x67, 0x65, 0x72, 0x70,
+	0x72, 0x69, 0x6e, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0c, 0x66, 0x69, 0x6e,
+	0x67, 0x65, 0x72, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x73, 0x12, 0x30, 0x0a, 0x14, 0x69, 0x6e, 0x73,
+	0x65, 0x63, 0x75, 0x72, 0x65, 0x5f, 0x73, 0x6b, 0x69, 0x70, 0x5f, 0x76, 0x65, 0x72, 0x69, 0x66,
+	0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x12, 0x69, 0x6e, 0x73, 0x65, 0x63, 0x75, 0x72,
+	0x65, 0x53, 0x6b, 0x69, 0x70, 0x56, 0x65, 0x72, 0x69, 0x66, 0x79, 0x12, 0x33, 0x0a, 0x0b, 0x6d,
+	0x69, 0x6e, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x12, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x54, 0x4c, 0x53, 0x56, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x52, 0x0a, 0x6d, 0x69, 0x6e, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e,
+	0x22, 0xfc, 0x01, 0x0a, 0x04, 0x53, 0x41, 0x53, 0x4c, 0x12, 0x34, 0x0a, 0x09, 0x6d, 0x65, 0x63,
+	0x68, 0x61, 0x6e, 0x69, 0x73, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x16, 0x2e, 0x63,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x53, 0x41, 0x53, 0x4c, 0x2e, 0x4d, 0x65, 0x63, 0x68, 0x61,
+	0x6e, 0x69, 0x73, 0x6d, 0x52, 0x09, 0x6d, 0x65, 0x63, 0x68, 0x61, 0x6e, 0x69, 0x73, 0x6d, 0x12,
+	0x1a, 0x0a, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x75, 0x73, 0x65, 0x72, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x70,
+	0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x70,
+	0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x65, 0x72, 0x74, 0x5f,
+	0x66, 0x69, 0x6c, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x65, 0x72, 0x74,
+	0x46, 0x69, 0x6c, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x6b, 0x65, 0x79, 0x5f, 0x66, 0x69, 0x6c, 0x65,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6b, 0x65, 0x79, 0x46, 0x69, 0x6c, 0x65, 0x12,
+	0x28, 0x0a, 0x10, 0x61, 0x62, 0x6f, 0x72, 0x74, 0x5f, 0x6f, 0x6e, 0x5f, 0x66, 0x61, 0x69, 0x6c,
+	0x75, 0x72, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x61, 0x62, 0x6f, 0x72, 0x74,
+	0x4f, 0x6e, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x22, 0x24, 0x0a, 0x09, 0x4d, 0x65, 0x63,
+	0x68, 0x61, 0x6e, 0x69, 0x73, 0x6d, 0x12, 0x09, 0x0a, 0x05, 0x50, 0x4c, 0x41, 0x49, 0x4e, 0x10,
+	0x00, 0x12, 0x0c, 0x0a, 0x08, 0x45, 0x58, 0x54, 0x45, 0x52, 0x4e, 0x41, 0x4c, 0x10, 0x01, 0x22,
+	0x86, 0x01, 0x0a, 0x07, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x6e,
+	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12,
+	0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65,
+	0x79, 0x12, 0x23, 0x0a, 0x0d, 0x68, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x5f, 0x6c, 0x69, 0x6d,
+	0x69, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x68, 0x69, 0x73, 0x74, 0x6f, 0x72,
+	0x79, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x30, 0x0a, 0x07, 0x73, 0x74, 0x6f, 0x72, 0x61, 0x67,
+	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x16, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x2e, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x53, 0x74, 0x6f, 0x72, 0x61, 0x67, 0x65, 0x52,
+	0x07, 0x73, 0x74, 0x6f, 0x72, 0x61, 0x67, 0x65, 0x22, 0xd4, 0x02, 0x0a, 0x03, 0x54, 0x4c, 0x53,
+	0x12, 0x17, 0x0a, 0x07, 0x63, 0x61, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x63, 0x61, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x65, 0x72,
+	0x74, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x65,
+	0x72, 0x74, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x6b, 0x65, 0x79, 0x5f, 0x66, 0x69,
+	0x6c, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6b, 0x65, 0x79, 0x46, 0x69, 0x6c,
+	0x65, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x63, 0x6e, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x43, 0x6e, 0x12, 0x28,
+	0x0a, 0x10, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x63, 0x65, 0x72, 0x74, 0x5f, 0x66, 0x69,
+	0x6c, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74,
+	0x43, 0x65, 0x72, 0x74, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x26, 0x0a, 0x0f, 0x63, 0x6c, 0x69, 0x65,
+	0x6e, 0x74, 0x5f, 0x6b, 0x65, 0x79, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0d, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x4b, 0x65, 0x79, 0x46, 0x69, 0x6c, 0x65,
+	0x12, 0x3f, 0x0a, 0x0f, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x5f, 0x63, 0x6c, 0x69, 0x65,
+	0x6e, 0x74, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x63, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74,
+	0x79, 0x52, 0x0e, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74,
+	0x73, 0x12, 0x19, 0x0a, 0x08, 0x63, 0x72, 0x6c, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x08, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x72, 0x6c, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x31, 0x0a, 0x14,
+	0x72, 0x65, 0x76, 0x6f, 0x6b, 0x65, 0x64, 0x5f, 0x66, 0x69, 0x6e, 0x67, 0x65, 0x72, 0x70, 0x72,
+	0x69, 0x6e, 0x74, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x09, 0x52, 0x13, 0x72, 0x65, 0x76, 0x6f,
+	0x6b, 0x65, 0x64, 0x46, 0x69, 0x6e, 0x67, 0x65, 0x72, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x73, 0x22,
+	0x88, 0x01, 0x0a, 0x0e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69,
+	0x74, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x63, 0x6e, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x02, 0x63, 0x6e, 0x12, 0x17, 0x0a, 0x07, 0x64, 0x6e, 0x73, 0x5f, 0x73, 0x61,
+	0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x64, 0x6e, 0x73, 0x53, 0x61, 0x6e, 0x12,
+	0x17, 0x0a, 0x07, 0x75, 0x72, 0x69, 0x5f, 0x73, 0x61, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x75, 0x72, 0x69, 0x53, 0x61, 0x6e, 0x12, 0x20, 0x0a, 0x0b, 0x66, 0x69, 0x6e, 0x67,
+	0x65, 0x72, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x66,
+	0x69, 0x6e, 0x67, 0x65, 0x72, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x22, 0xba, 0x03, 0x0a, 0x07, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x65,
+	0x72, 0x74, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63,
+	0x65, 0x72, 0x74, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x19, 0x0a, 0x08, 0x6b, 0x65, 0x79, 0x5f, 0x66,
+	0x69, 0x6c, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6b, 0x65, 0x79, 0x46, 0x69,
+	0x6c, 0x65, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x70, 0x61, 0x73,
+	0x73, 0x6b, 0x65, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6c, 0x69, 0x65,
+	0x6e, 0x74, 0x50, 0x61, 0x73, 0x73, 0x6b, 0x65, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73,
+	0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x2b, 0x0a,
+	0x11, 0x73, 0x68, 0x75, 0x74, 0x64, 0x6f, 0x77, 0x6e, 0x5f, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f,
+	0x72, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x73, 0x68, 0x75, 0x74, 0x64, 0x6f,
+	0x77, 0x6e, 0x50, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64, 0x12, 0x2a, 0x0a, 0x11, 0x63, 0x6c,
+	0x69, 0x65, 0x6e, 0x74, 0x5f, 0x71, 0x75, 0x65, 0x75, 0x65, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0f, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x51, 0x75, 0x65,
+	0x75, 0x65, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x3f, 0x0a, 0x0f, 0x6f, 0x76, 0x65, 0x72, 0x66, 0x6c,
+	0x6f, 0x77, 0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x16, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x4f, 0x76, 0x65, 0x72, 0x66, 0x6c, 0x6f,
+	0x77, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x0e, 0x6f, 0x76, 0x65, 0x72, 0x66, 0x6c, 0x6f,
+	0x77, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x2a, 0x0a, 0x11, 0x63, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x5f, 0x73, 0x65, 0x6e, 0x64, 0x5f, 0x62, 0x75, 0x72, 0x73, 0x74, 0x18, 0x09, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x0f, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x53, 0x65, 0x6e, 0x64, 0x42, 0x75,
+	0x72, 0x73, 0x74, 0x12, 0x28, 0x0a, 0x10, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x73, 0x65,
+	0x6e, 0x64, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0e, 0x63,
+	0x6c, 0x69, 0x65, 0x6e, 0x74, 0x53, 0x65, 0x6e, 0x64, 0x52, 0x61, 0x74, 0x65, 0x12, 0x38, 0x0a,
+	0x0d, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x18, 0x0b,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x43, 0x6c,
+	0x69, 0x65, 0x6e, 0x74, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x52, 0x0c, 0x63, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x73, 0x22, 0x42, 0x0a, 0x0b, 0x43, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x62, 0x63,
+	0x72, 0x79, 0x70, 0x74, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0a, 0x62, 0x63, 0x72, 0x79, 0x70, 0x74, 0x48, 0x61, 0x73, 0x68, 0x22, 0xe6, 0x03, 0x0a, 0x06,
+	0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x23, 0x0a, 0x03, 0x69, 0x72, 0x63, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x49, 0x52, 0x43,
+	0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x52, 0x03, 0x69, 0x72, 0x63, 0x12, 0x2b, 0x0a, 0x08, 0x63,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e,
+	0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x08,
+	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73, 0x12, 0x29, 0x0a, 0x07, 0x73, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x63, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x2e, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x52, 0x07, 0x73, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x12, 0x1d, 0x0a, 0x03, 0x74, 0x6c, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x0b, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x54, 0x4c, 0x53, 0x52, 0x03, 0x74,
+	0x6c, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x68, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x5f, 0x64, 0x69,
+	0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x68, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79,
+	0x44, 0x69, 0x72, 0x12, 0x2e, 0x0a, 0x13, 0x71, 0x75, 0x65, 0x72, 0x79, 0x5f, 0x68, 0x69, 0x73,
+	0x74, 0x6f, 0x72, 0x79, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x11, 0x71, 0x75, 0x65, 0x72, 0x79, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x4c, 0x69,
+	0x6d, 0x69, 0x74, 0x12, 0x3b, 0x0a, 0x0d, 0x71, 0x75, 0x65, 0x72, 0x79, 0x5f, 0x73, 0x74, 0x6f,
+	0x72, 0x61, 0x67, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x16, 0x2e, 0x63, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x2e, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x53, 0x74, 0x6f, 0x72, 0x61,
+	0x67, 0x65, 0x52, 0x0c, 0x71, 0x75, 0x65, 0x72, 0x79, 0x53, 0x74, 0x6f, 0x72, 0x61, 0x67, 0x65,
+	0x12, 0x1f, 0x0a, 0x0b, 0x6d, 0x61, 0x78, 0x5f, 0x71, 0x75, 0x65, 0x72, 0x69, 0x65, 0x73, 0x18,
+	0x0b, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0a, 0x6d, 0x61, 0x78, 0x51, 0x75, 0x65, 0x72, 0x69, 0x65,
+	0x73, 0x12, 0x2c, 0x0a, 0x06, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x18, 0x08, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x14, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x52, 0x06, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x12,
+	0x2b, 0x0a, 0x08, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x0f, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x4e, 0x65, 0x74, 0x77, 0x6f,
+	0x72, 0x6b, 0x52, 0x08, 0x6e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x73, 0x12, 0x36, 0x0a, 0x0c,
+	0x69, 0x72, 0x63, 0x5f, 0x6c, 0x69, 0x73, 0x74, 0x65, 0x6e, 0x65, 0x72, 0x18, 0x0a, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x13, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x49, 0x52, 0x43, 0x4c,
+	0x69, 0x73, 0x74, 0x65, 0x6e, 0x65, 0x72, 0x52, 0x0b, 0x69, 0x72, 0x63, 0x4c, 0x69, 0x73, 0x74,
+	0x65, 0x6e, 0x65, 0x72, 0x22, 0x6a, 0x0a, 0x0b, 0x49, 0x52, 0x43, 0x4c, 0x69, 0x73, 0x74, 0x65,
+	0x6e, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x75,
+	0x73, 0x65, 0x5f, 0x74, 0x6c, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x75, 0x73,
+	0x65, 0x54, 0x6c, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x6c, 0x61, 0x79, 0x62, 0x61, 0x63, 0x6b,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x70, 0x6c, 0x61, 0x79, 0x62, 0x61, 0x63, 0x6b,
+	0x22, 0x6f, 0x0a, 0x07, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x6e,
+	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12,
+	0x23, 0x0a, 0x03, 0x69, 0x72, 0x63, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x63,
 	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x49, 0x52, 0x43, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x52,
 	0x03, 0x69, 0x72, 0x63, 0x12, 0x2b, 0x0a, 0x08, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73,
-	0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e,
+	0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e,
 	0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x08, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
-	0x73, 0x12, 0x29, 0x0a, 0x07, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01,
-	0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x53, 0x65, 0x72, 0x76,
-	0x69, 0x63, 0x65, 0x52, 0x07, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x1d, 0x0a, 0x03,
-	0x74, 0x6c, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x63, 0x6f, 0x6e, 0x66,
-	0x69, 0x67, 0x2e, 0x54, 0x4c, 0x53, 0x52, 0x03, 0x74, 0x6c, 0x73, 0x42, 0x29, 0x5a, 0x27, 0x67,
-	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6d, 0x6f, 0x72, 0x72, 0x6f, 0x77,
-	0x63, 0x2f, 0x69, 0x72, 0x63, 0x2d, 0x62, 0x6f, 0x74, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f,
-	0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x73, 0x22, 0xb6, 0x02, 0x0a, 0x0c, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x12, 0x25, 0x0a, 0x0e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x5f, 0x61, 0x64, 0x64,
+	0x72, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x73, 0x65, 0x72, 0x76,
+	0x65, 0x72, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x73, 0x65, 0x72,
+	0x76, 0x65, 0x72, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a,
+	0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x63, 0x61,
+	0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x63, 0x61, 0x46,
+	0x69, 0x6c, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x63, 0x65, 0x72, 0x74, 0x5f, 0x66, 0x69, 0x6c, 0x65,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x65, 0x72, 0x74, 0x46, 0x69, 0x6c, 0x65,
+	0x12, 0x19, 0x0a, 0x08, 0x6b, 0x65, 0x79, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x6b, 0x65, 0x79, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x74,
+	0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x6b, 0x65,
+	0x6e, 0x12, 0x27, 0x0a, 0x0f, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x61, 0x6c, 0x5f, 0x68, 0x69, 0x73,
+	0x74, 0x6f, 0x72, 0x79, 0x18, 0x07, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0e, 0x69, 0x6e, 0x69, 0x74,
+	0x69, 0x61, 0x6c, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x29, 0x0a, 0x10, 0x74, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x5f, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x46,
+	0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x23, 0x0a, 0x0d, 0x73, 0x74, 0x61, 0x72, 0x74, 0x5f, 0x63,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x73, 0x74,
+	0x61, 0x72, 0x74, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x2a, 0x37, 0x0a, 0x0a, 0x54, 0x4c,
+	0x53, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x0f, 0x0a, 0x0b, 0x54, 0x4c, 0x53, 0x5f,
+	0x44, 0x45, 0x46, 0x41, 0x55, 0x4c, 0x54, 0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x54, 0x4c, 0x53,
+	0x5f, 0x31, 0x5f, 0x32, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x54, 0x4c, 0x53, 0x5f, 0x31, 0x5f,
+	0x33, 0x10, 0x02, 0x2a, 0x36, 0x0a, 0x0e, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x53, 0x74,
+	0x6f, 0x72, 0x61, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x0e, 0x48, 0x49, 0x53, 0x54, 0x4f, 0x52, 0x59,
+	0x5f, 0x4d, 0x45, 0x4d, 0x4f, 0x52, 0x59, 0x10, 0x00, 0x12, 0x10, 0x0a, 0x0c, 0x48, 0x49, 0x53,
+	0x54, 0x4f, 0x52, 0x59, 0x5f, 0x44, 0x49, 0x53, 0x4b, 0x10, 0x01, 0x2a, 0x5a, 0x0a, 0x0e, 0x4f,
+	0x76, 0x65, 0x72, 0x66, 0x6c, 0x6f, 0x77, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x18, 0x0a,
+	0x14, 0x4f, 0x56, 0x45, 0x52, 0x46, 0x4c, 0x4f, 0x57, 0x5f, 0x44, 0x52, 0x4f, 0x50, 0x5f, 0x4f,
+	0x4c, 0x44, 0x45, 0x53, 0x54, 0x10, 0x00, 0x12, 0x17, 0x0a, 0x13, 0x4f, 0x56, 0x45, 0x52, 0x46,
+	0x4c, 0x4f, 0x57, 0x5f, 0x44, 0x49, 0x53, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x10, 0x01,
+	0x12, 0x15, 0x0a, 0x11, 0x4f, 0x56, 0x45, 0x52, 0x46, 0x4c, 0x4f, 0x57, 0x5f, 0x43, 0x4f, 0x41,
+	0x4c, 0x45, 0x53, 0x43, 0x45, 0x10, 0x02, 0x42, 0x29, 0x5a, 0x27, 0x67, 0x69, 0x74, 0x68, 0x75,
+	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6d, 0x6f, 0x72, 0x72, 0x6f, 0x77, 0x63, 0x2f, 0x69, 0x72,
+	0x63, 0x2d, 0x62, 0x6f, 0x74, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x63, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 })
 
 var (
@@ -474,24 +1808,56 @@ func file_proto_config_config_proto_rawDescGZIP() []byte {
 	return file_proto_config_config_proto_rawDescData
 }
 
-var file_proto_config_config_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_proto_config_config_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
+var file_proto_config_config_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
 var file_proto_config_config_proto_goTypes = []any{
-	(*IRCServer)(nil), // 0: config.IRCServer
-	(*Channel)(nil),   // 1: config.Channel
-	(*TLS)(nil),       // 2: config.TLS
-	(*Service)(nil),   // 3: config.Service
-	(*Config)(nil),    // 4: config.Config
+	(TLSVersion)(0),        // 0: config.TLSVersion
+	(HistoryStorage)(0),    // 1: config.HistoryStorage
+	(OverflowPolicy)(0),    // 2: config.OverflowPolicy
+	(NickServ_Recover)(0),  // 3: config.NickServ.Recover
+	(SASL_Mechanism)(0),    // 4: config.SASL.Mechanism
+	(*Endpoint)(nil),       // 5: config.Endpoint
+	(*IRCServer)(nil),      // 6: config.IRCServer
+	(*NickServ)(nil),       // 7: config.NickServ
+	(*UpstreamTLS)(nil),    // 8: config.UpstreamTLS
+	(*SASL)(nil),           // 9: config.SASL
+	(*Channel)(nil),        // 10: config.Channel
+	(*TLS)(nil),            // 11: config.TLS
+	(*ClientIdentity)(nil), // 12: config.ClientIdentity
+	(*Service)(nil),        // 13: config.Service
+	(*ClientToken)(nil),    // 14: config.ClientToken
+	(*Config)(nil),         // 15: config.Config
+	(*IRCListener)(nil),    // 16: config.IRCListener
+	(*Network)(nil),        // 17: config.Network
+	(*ClientConfig)(nil),   // 18: config.ClientConfig
 }
 var file_proto_config_config_proto_depIdxs = []int32{
-	0, // 0: config.Config.irc:type_name -> config.IRCServer
-	1, // 1: config.Config.channels:type_name -> config.Channel
-	3, // 2: config.Config.service:type_name -> config.Service
-	2, // 3: config.Config.tls:type_name -> config.TLS
-	4, // [4:4] is the sub-list for method output_type
-	4, // [4:4] is the sub-list for method input_type
-	4, // [4:4] is the sub-list for extension type_name
-	4, // [4:4] is the sub-list for extension extendee
-	0, // [0:4] is the sub-list for field type_name
+	5,  // 0: config.IRCServer.fallback_servers:type_name -> config.Endpoint
+	9,  // 1: config.IRCServer.sasl:type_name -> config.SASL
+	8,  // 2: config.IRCServer.tls:type_name -> config.UpstreamTLS
+	7,  // 3: config.IRCServer.nickserv:type_name -> config.NickServ
+	3,  // 4: config.NickServ.recover:type_name -> config.NickServ.Recover
+	0,  // 5: config.UpstreamTLS.min_version:type_name -> config.TLSVersion
+	4,  // 6: config.SASL.mechanism:type_name -> config.SASL.Mechanism
+	1,  // 7: config.Channel.storage:type_name -> config.HistoryStorage
+	12, // 8: config.TLS.allowed_clients:type_name -> config.ClientIdentity
+	2,  // 9: config.Service.overflow_policy:type_name -> config.OverflowPolicy
+	14, // 10: config.Service.client_tokens:type_name -> config.ClientToken
+	6,  // 11: config.Config.irc:type_name -> config.IRCServer
+	10, // 12: config.Config.channels:type_name -> config.Channel
+	13, // 13: config.Config.service:type_name -> config.Service
+	11, // 14: config.Config.tls:type_name -> config.TLS
+	1,  // 15: config.Config.query_storage:type_name -> config.HistoryStorage
+	18, // 16: config.Config.client:type_name -> config.ClientConfig
+	17, // 17: config.Config.networks:type_name -> config.Network
+	16, // 18: config.Config.irc_listener:type_name -> config.IRCListener
+	6,  // 19: config.Network.irc:type_name -> config.IRCServer
+	10, // 20: config.Network.channels:type_name -> config.Channel
+	21, // [21:21] is the sub-list for method output_type
+	21, // [21:21] is the sub-list for method input_type
+	21, // [21:21] is the sub-list for extension type_name
+	21, // [21:21] is the sub-list for extension extendee
+	0,  // [0:21] is the sub-list for field type_name
 }
 
 func init() { file_proto_config_config_proto_init() }
@@ -504,13 +1870,14 @@ func file_proto_config_config_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_config_config_proto_rawDesc), len(file_proto_config_config_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   5,
+			NumEnums:      5,
+			NumMessages:   14,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_proto_config_config_proto_goTypes,
 		DependencyIndexes: file_proto_config_config_proto_depIdxs,
+		EnumInfos:         file_proto_config_config_proto_enumTypes,
 		MessageInfos:      file_proto_config_config_proto_msgTypes,
 	}.Build()
 	File_proto_config_config_proto = out.File
@@ -19,8 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion8
 
 const (
-	IRCService_StreamMessages_FullMethodName = "/service.IRCService/StreamMessages"
-	IRCService_SendMessage_FullMethodName    = "/service.IRCService/SendMessage"
+	IRCService_StreamMessages_FullMethodName  = "/service.IRCService/StreamMessages"
+	IRCService_SendMessage_FullMethodName     = "/service.IRCService/SendMessage"
+	IRCService_GetHistory_FullMethodName      = "/service.IRCService/GetHistory"
+	IRCService_GetChannelState_FullMethodName = "/service.IRCService/GetChannelState"
+	IRCService_ListClients_FullMethodName     = "/service.IRCService/ListClients"
 )
 
 // IRCServiceClient is the client API for IRCService service.
@@ -32,6 +35,12 @@ type IRCServiceClient interface {
 	StreamMessages(ctx context.Context, opts ...grpc.CallOption) (IRCService_StreamMessagesClient, error)
 	// Sends a message to a channel.
 	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error)
+	// Pages through a channel's history from a message ID cursor.
+	GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (*GetHistoryResponse, error)
+	// Returns the topic, members and modes of a channel the bot is in.
+	GetChannelState(ctx context.Context, in *GetChannelStateRequest, opts ...grpc.CallOption) (*ChannelState, error)
+	// Lists the clients attached with StreamMessages.
+	ListClients(ctx context.Context, in *ListClientsRequest, opts ...grpc.CallOption) (*ListClientsResponse, error)
 }
 
 type iRCServiceClient struct {
@@ -84,6 +93,36 @@ func (c *iRCServiceClient) SendMessage(ctx context.Context, in *SendMessageReque
 	return out, nil
 }
 
+func (c *iRCServiceClient) GetHistory(ctx context.Context, in *GetHistoryRequest, opts ...grpc.CallOption) (*GetHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetHistoryResponse)
+	err := c.cc.Invoke(ctx, IRCService_GetHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iRCServiceClient) GetChannelState(ctx context.Context, in *GetChannelStateRequest, opts ...grpc.CallOption) (*ChannelState, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChannelState)
+	err := c.cc.Invoke(ctx, IRCService_GetChannelState_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iRCServiceClient) ListClients(ctx context.Context, in *ListClientsRequest, opts ...grpc.CallOption) (*ListClientsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListClientsResponse)
+	err := c.cc.Invoke(ctx, IRCService_ListClients_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // IRCServiceServer is the server API for IRCService service.
 // All implementations must embed UnimplementedIRCServiceServer
 // for forward compatibility
@@ -93,6 +132,12 @@ type IRCServiceServer interface {
 	StreamMessages(IRCService_StreamMessagesServer) error
 	// Sends a message to a channel.
 	SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error)
+	// Pages through a channel's history from a message ID cursor.
+	GetHistory(context.Context, *GetHistoryRequest) (*GetHistoryResponse, error)
+	// Returns the topic, members and modes of a channel the bot is in.
+	GetChannelState(context.Context, *GetChannelStateRequest) (*ChannelState, error)
+	// Lists the clients attached with StreamMessages.
+	ListClients(context.Context, *ListClientsRequest) (*ListClientsResponse, error)
 	mustEmbedUnimplementedIRCServiceServer()
 }
 
@@ -106,6 +151,15 @@ func (UnimplementedIRCServiceServer) StreamMessages(IRCService_StreamMessagesSer
 func (UnimplementedIRCServiceServer) SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
 }
+func (UnimplementedIRCServiceServer) GetHistory(context.Context, *GetHistoryRequest) (*GetHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHistory not implemented")
+}
+func (UnimplementedIRCServiceServer) GetChannelState(context.Context, *GetChannelStateRequest) (*ChannelState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChannelState not implemented")
+}
+func (UnimplementedIRCServiceServer) ListClients(context.Context, *ListClientsRequest) (*ListClientsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListClients not implemented")
+}
 func (UnimplementedIRCServiceServer) mustEmbedUnimplementedIRCServiceServer() {}
 
 // UnsafeIRCServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -163,6 +217,60 @@ func _IRCService_SendMessage_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _IRCService_GetHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IRCServiceServer).GetHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IRCService_GetHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IRCServiceServer).GetHistory(ctx, req.(*GetHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IRCService_GetChannelState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChannelStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IRCServiceServer).GetChannelState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IRCService_GetChannelState_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IRCServiceServer).GetChannelState(ctx, req.(*GetChannelStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IRCService_ListClients_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListClientsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IRCServiceServer).ListClients(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IRCService_ListClients_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IRCServiceServer).ListClients(ctx, req.(*ListClientsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // IRCService_ServiceDesc is the grpc.ServiceDesc for IRCService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -174,6 +282,18 @@ var IRCService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SendMessage",
 			Handler:    _IRCService_SendMessage_Handler,
 		},
+		{
+			MethodName: "GetHistory",
+			Handler:    _IRCService_GetHistory_Handler,
+		},
+		{
+			MethodName: "GetChannelState",
+			Handler:    _IRCService_GetChannelState_Handler,
+		},
+		{
+			MethodName: "ListClients",
+			Handler:    _IRCService_ListClients_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -1,3 +1,3 @@
 #!/bin/bash
-# Run the client using Bazel
-bazel run //client:client
+# Run the client using Bazel; extra arguments are passed on, e.g. -server host:port
+bazel run //client:client -- --config $(pwd)/config.textproto "$@"
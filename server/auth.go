@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Clients authenticate with "authorization: Bearer <token>" metadata on
+// every call.
+const authHeader = "authorization"
+
+// clientIdentity is who a client authenticated as.
+type clientIdentity struct {
+	// cert is the allowed_clients entry its certificate matched, or the
+	// certificate's CN if the server accepts any certificate from its CA.
+	cert string
+	// token is the client_tokens entry, or "passkey" for client_passkey.
+	token string
+}
+
+func (id clientIdentity) String() string {
+	switch {
+	case id.cert != "" && id.token != "" && id.cert != id.token:
+		return fmt.Sprintf("%s (token %s)", id.cert, id.token)
+	case id.cert != "":
+		return id.cert
+	case id.token != "":
+		return id.token
+	}
+	return "anonymous"
+}
+
+type clientIdentityKey struct{}
+
+// clientFromContext returns who the caller authenticated as.
+func clientFromContext(ctx context.Context) clientIdentity {
+	id, _ := ctx.Value(clientIdentityKey{}).(clientIdentity)
+	return id
+}
+
+// describeClient names the caller and its address, for logging.
+func describeClient(ctx context.Context) string {
+	return fmt.Sprintf("%s at %s", clientFromContext(ctx), peerAddr(ctx))
+}
+
+var errNoToken = errors.New("missing bearer token")
+
+// authenticate checks the caller's bearer token and returns the name it
+// belongs to.
+func (s *IRCServiceServer) authenticate(ctx context.Context) (string, error) {
+	s.mu.RLock()
+	cfg := s.config
+	s.mu.RUnlock()
+	passkey := cfg.GetClientPasskey()
+	tokens := cfg.GetClientTokens()
+	if passkey == "" && len(tokens) == 0 {
+		return "", nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	for _, v := range md.Get(authHeader) {
+		if t, ok := strings.CutPrefix(v, "Bearer "); ok {
+			token = t
+		}
+	}
+	if token == "" {
+		return "", errNoToken
+	}
+	return s.checkToken(token)
+}
+
+// checkToken returns the name a client token belongs to. With no tokens
+// configured, none is valid.
+func (s *IRCServiceServer) checkToken(token string) (string, error) {
+	s.mu.RLock()
+	cfg := s.config
+	s.mu.RUnlock()
+	passkey := cfg.GetClientPasskey()
+	tokens := cfg.GetClientTokens()
+	if passkey == "" && len(tokens) == 0 {
+		return "", errors.New("no client tokens configured")
+	}
+
+	if passkey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(passkey)) == 1 {
+		return "passkey", nil
+	}
+
+	// bcrypt is slow on purpose; remember tokens that already matched.
+	sum := sha256.Sum256([]byte(token))
+	s.authMu.Lock()
+	name, ok := s.verified[sum]
+	s.authMu.Unlock()
+	if ok {
+		return name, nil
+	}
+	for _, t := range tokens {
+		if bcrypt.CompareHashAndPassword([]byte(t.GetBcryptHash()), []byte(token)) == nil {
+			// Remember it, unless the config was reloaded meanwhile.
+			s.mu.RLock()
+			if s.config == cfg {
+				s.authMu.Lock()
+				s.verified[sum] = t.GetName()
+				s.authMu.Unlock()
+			}
+			s.mu.RUnlock()
+			return t.GetName(), nil
+		}
+	}
+	return "", errors.New("invalid token")
+}
+
+// peerCerts returns the certificate chain the caller presented, if any.
+func peerCerts(ctx context.Context) []*x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return info.State.PeerCertificates
+}
+
+// certIdentity returns the name the caller's certificate is allowed under,
+// or "" if it didn't present one. The certificate is checked again on every
+// call, since it may have been revoked after the connection was made.
+func (s *IRCServiceServer) certIdentity(ctx context.Context) (string, error) {
+	certs := peerCerts(ctx)
+	if len(certs) == 0 {
+		return "", nil
+	}
+	s.mu.RLock()
+	clients := s.clients
+	s.mu.RUnlock()
+	if clients == nil {
+		return certs[0].Subject.CommonName, nil
+	}
+	return clients.verify(certs)
+}
+
+// identify authenticates the caller and returns a context carrying who it is.
+func (s *IRCServiceServer) identify(ctx context.Context, method string) (context.Context, error) {
+	var id clientIdentity
+	var err error
+	id.cert, err = s.certIdentity(ctx)
+	if err == nil {
+		id.token, err = s.authenticate(ctx)
+	}
+	if err != nil {
+		log.Printf("Rejected %s from %s: %v", method, describeClient(context.WithValue(ctx, clientIdentityKey{}, id)), err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return context.WithValue(ctx, clientIdentityKey{}, id), nil
+}
+
+// UnaryAuth is a unary interceptor that requires a valid bearer token.
+func (s *IRCServiceServer) UnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.identify(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamAuth is a stream interceptor that requires a valid bearer token.
+func (s *IRCServiceServer) StreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.identify(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authedStream carries the client's identity in its context.
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(authHeader, "Bearer "+token))
+}
+
+func TestAuthenticate(t *testing.T) {
+	srv := NewIRCServiceServer(&pbConfig.Service{}, nil)
+	if name, err := srv.authenticate(context.Background()); err != nil || name != "" {
+		t.Errorf("Expected any client to be accepted without tokens, got %q %v", name, err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("laptop-token"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &pbConfig.Service{
+		ClientPasskey: "shared",
+		ClientTokens:  []*pbConfig.ClientToken{{Name: "laptop", BcryptHash: string(hash)}},
+	}
+	srv.UpdateState(cfg, nil)
+
+	tests := []struct {
+		desc     string
+		ctx      context.Context
+		wantName string
+		wantErr  bool
+	}{
+		{"passkey", withToken("shared"), "passkey", false},
+		{"named token", withToken("laptop-token"), "laptop", false},
+		{"named token, cached", withToken("laptop-token"), "laptop", false},
+		{"wrong token", withToken("nope"), "", true},
+		{"no token", context.Background(), "", true},
+		{"not bearer", metadata.NewIncomingContext(context.Background(), metadata.Pairs(authHeader, "shared")), "", true},
+	}
+	for _, tt := range tests {
+		name, err := srv.authenticate(tt.ctx)
+		if (err != nil) != tt.wantErr || name != tt.wantName {
+			t.Errorf("%s: got %q, %v; want %q, error %v", tt.desc, name, err, tt.wantName, tt.wantErr)
+		}
+	}
+
+	// Removing a token from the config revokes it, even though it was cached.
+	srv.UpdateState(&pbConfig.Service{ClientPasskey: "shared"}, nil)
+	if _, err := srv.authenticate(withToken("laptop-token")); err == nil {
+		t.Error("Expected the removed token to be rejected")
+	}
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	srv := NewIRCServiceServer(&pbConfig.Service{ClientPasskey: "shared"}, nil)
+
+	var got string
+	unary := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = clientFromContext(ctx).token
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/service.IRCService/GetHistory"}
+	if _, err := srv.UnaryAuth(withToken("wrong"), nil, info, unary); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+	if _, err := srv.UnaryAuth(withToken("shared"), nil, info, unary); err != nil || got != "passkey" {
+		t.Errorf("Expected the call to go through as passkey, got %q %v", got, err)
+	}
+
+	got = ""
+	stream := func(srv interface{}, ss grpc.ServerStream) error {
+		got = clientFromContext(ss.Context()).token
+		return nil
+	}
+	sinfo := &grpc.StreamServerInfo{FullMethod: "/service.IRCService/StreamMessages"}
+	if err := srv.StreamAuth(nil, NewMockStream(context.Background()), sinfo, stream); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated, got %v", err)
+	}
+	if err := srv.StreamAuth(nil, NewMockStream(withToken("shared")), sinfo, stream); err != nil || got != "passkey" {
+		t.Errorf("Expected the stream to go through as passkey, got %q %v", got, err)
+	}
+}
+
+func TestCertIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	cert, _, _, _ := ca.issue(t, "laptop.home", 2)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr:     &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4000},
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+	})
+
+	srv := NewIRCServiceServer(&pbConfig.Service{ClientPasskey: "shared"}, nil)
+	allow, err := newClientAllowList(&pbConfig.TLS{AllowedClients: []*pbConfig.ClientIdentity{{Name: "laptop", DnsSan: "laptop.home"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	srv.SetClientVerifier(&clientVerifier{roots: roots, allow: allow})
+
+	var got clientIdentity
+	unary := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = clientFromContext(ctx)
+		return nil, nil
+	}
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(authHeader, "Bearer shared"))
+	if _, err := srv.UnaryAuth(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/service.IRCService/ListClients"}, unary); err != nil {
+		t.Fatal(err)
+	}
+	if want := (clientIdentity{cert: "laptop", token: "passkey"}); got != want {
+		t.Errorf("Got identity %+v, want %+v", got, want)
+	}
+	if got, want := describeClient(context.WithValue(ctx, clientIdentityKey{}, got)), "laptop (token passkey) at 192.0.2.1:4000"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+
+	// A certificate revoked since the connection was made is turned away.
+	sum := sha256.Sum256(cert.Raw)
+	srv.SetClientVerifier(&clientVerifier{roots: roots, allow: allow, revoked: [][]byte{sum[:]}})
+	if _, err := srv.UnaryAuth(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/service.IRCService/ListClients"}, unary); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated for a revoked certificate, got %v", err)
+	}
+
+	if got := (clientIdentity{}).String(); got != "anonymous" {
+		t.Errorf("Got %q for no identity", got)
+	}
+}
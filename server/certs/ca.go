@@ -0,0 +1,412 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// paths says where the CA keeps its files.
+type paths struct {
+	dir        string // Client certificates and issued/ go here
+	caCert     string
+	caKey      string
+	crl        string
+	serverCert string
+	serverKey  string
+}
+
+// issuedDir holds a copy of every certificate the CA signed, so they can be
+// listed and revoked by name.
+func (p paths) issuedDir() string {
+	return filepath.Join(p.dir, "issued")
+}
+
+// ca is a certificate authority kept in files.
+type ca struct {
+	paths paths
+	cert  *x509.Certificate
+	key   crypto.Signer
+}
+
+// initCA creates a new CA. It refuses to overwrite an existing one, since
+// every certificate it issued would stop working.
+func initCA(p paths, cn string, lifetime time.Duration) (*ca, error) {
+	for _, f := range []string{p.caCert, p.caKey} {
+		if _, err := os.Stat(f); err == nil {
+			return nil, fmt.Errorf("%s already exists", f)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA key: %v", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"IRC-Bot-CA"}},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(lifetime),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CA certificate: %v", err)
+	}
+	if err := writeKeyPair(p.caCert, p.caKey, der, key); err != nil {
+		return nil, err
+	}
+	return loadCA(p)
+}
+
+// loadCA reads an existing CA, including one made by openssl.
+func loadCA(p paths) (*ca, error) {
+	certPEM, err := os.ReadFile(p.caCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %v", err)
+	}
+	keyPEM, err := os.ReadFile(p.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %v", err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("CA key can't sign")
+	}
+	return &ca{paths: p, cert: cert, key: key}, nil
+}
+
+// sign issues a certificate for pub and keeps a copy of it.
+func (c *ca) sign(tmpl *x509.Certificate, pub crypto.PublicKey) ([]byte, error) {
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+	tmpl.SerialNumber = serial
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.BasicConstraintsValid = true
+	if tmpl.NotAfter.After(c.cert.NotAfter) {
+		// Nothing can outlive the CA.
+		tmpl.NotAfter = c.cert.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.cert, pub, c.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %v", err)
+	}
+
+	if err := os.MkdirAll(c.paths.issuedDir(), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", c.paths.issuedDir(), err)
+	}
+	copyPath := filepath.Join(c.paths.issuedDir(), serial.Text(16)+".crt")
+	if err := os.WriteFile(copyPath, pemCert(der), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to keep a copy of the certificate: %v", err)
+	}
+	return der, nil
+}
+
+// issue creates a key and a certificate for it, for the server or a client.
+// sans are IP addresses, URIs, or DNS names.
+func (c *ca) issue(cn string, sans []string, usage x509.ExtKeyUsage, lifetime time.Duration, certPath, keyPath string) (*x509.Certificate, error) {
+	if cn == "" {
+		return nil, errors.New("a name is required")
+	}
+	for _, f := range []string{certPath, keyPath} {
+		if _, err := os.Stat(f); err == nil {
+			return nil, fmt.Errorf("%s already exists; renew it instead", f)
+		}
+	}
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+	}
+	if err := addSANs(tmpl, sans); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl.NotBefore = now.Add(-5 * time.Minute)
+	tmpl.NotAfter = now.Add(lifetime)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	der, err := c.sign(tmpl, key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// renew replaces the certificate at certPath with a new one for the same key
+// and names, valid for lifetime from now. The old one stays valid until it
+// expires or is revoked. A revoked certificate, or one for a key that had a
+// certificate revoked, isn't renewed: that would let the client back in.
+func (c *ca) renew(certPath string, lifetime time.Duration) (*x509.Certificate, error) {
+	old, err := readCert(certPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkNotRevoked(old); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		Subject:     old.Subject,
+		DNSNames:    old.DNSNames,
+		IPAddresses: old.IPAddresses,
+		URIs:        old.URIs,
+		ExtKeyUsage: old.ExtKeyUsage,
+		NotBefore:   now.Add(-5 * time.Minute),
+		NotAfter:    now.Add(lifetime),
+	}
+	der, err := c.sign(tmpl, old.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(certPath, pemCert(der), 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", certPath, err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// issued returns the certificates the CA signed, oldest first.
+func (c *ca) issued() ([]*x509.Certificate, error) {
+	files, err := filepath.Glob(filepath.Join(c.paths.issuedDir(), "*.crt"))
+	if err != nil {
+		return nil, err
+	}
+	var certs []*x509.Certificate
+	for _, f := range files {
+		cert, err := readCert(f)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	slices.SortFunc(certs, func(a, b *x509.Certificate) int {
+		return a.NotBefore.Compare(b.NotBefore)
+	})
+	return certs, nil
+}
+
+// crl returns the CA's current revocation list, or nil if it has none yet.
+func (c *ca) crl() (*x509.RevocationList, error) {
+	data, err := os.ReadFile(c.paths.crl)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CRL: %v", err)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CRL: %v", err)
+	}
+	return crl, nil
+}
+
+// revoked returns the revoked serial numbers, in hex, and when they were
+// revoked.
+func (c *ca) revoked() (map[string]time.Time, error) {
+	crl, err := c.crl()
+	if err != nil || crl == nil {
+		return nil, err
+	}
+	revoked := make(map[string]time.Time)
+	for _, e := range crl.RevokedCertificateEntries {
+		revoked[e.SerialNumber.Text(16)] = e.RevocationTime
+	}
+	return revoked, nil
+}
+
+// checkNotRevoked returns an error if cert, or another certificate the CA
+// issued for its key, is revoked.
+func (c *ca) checkNotRevoked(cert *x509.Certificate) error {
+	revoked, err := c.revoked()
+	if err != nil {
+		return err
+	}
+	if _, ok := revoked[cert.SerialNumber.Text(16)]; ok {
+		return fmt.Errorf("certificate %s (serial %s) is revoked; issue a new one with a new key instead", cert.Subject.CommonName, cert.SerialNumber.Text(16))
+	}
+	issued, err := c.issued()
+	if err != nil {
+		return err
+	}
+	for _, other := range issued {
+		if _, ok := revoked[other.SerialNumber.Text(16)]; ok && string(other.RawSubjectPublicKeyInfo) == string(cert.RawSubjectPublicKeyInfo) {
+			return fmt.Errorf("the key of %s was revoked with serial %s; issue a new one with a new key instead", cert.Subject.CommonName, other.SerialNumber.Text(16))
+		}
+	}
+	return nil
+}
+
+// revoke adds certs to the CRL and writes it out, valid for lifetime. With no
+// certs it just renews the CRL.
+func (c *ca) revoke(certs []*x509.Certificate, lifetime time.Duration) error {
+	old, err := c.crl()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: now,
+		NextUpdate: now.Add(lifetime),
+	}
+	if old != nil {
+		tmpl.Number = new(big.Int).Add(old.Number, big.NewInt(1))
+		tmpl.RevokedCertificateEntries = old.RevokedCertificateEntries
+	}
+	for _, cert := range certs {
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   cert.SerialNumber,
+			RevocationTime: now,
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, c.cert, c.key)
+	if err != nil {
+		return fmt.Errorf("failed to create CRL: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+	if err := os.WriteFile(c.paths.crl, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write CRL: %v", err)
+	}
+	return nil
+}
+
+// find returns the issued certificates that match name, a CN or a serial
+// number in hex.
+func (c *ca) find(name string) ([]*x509.Certificate, error) {
+	certs, err := c.issued()
+	if err != nil {
+		return nil, err
+	}
+	var found []*x509.Certificate
+	for _, cert := range certs {
+		if cert.Subject.CommonName == name || strings.EqualFold(cert.SerialNumber.Text(16), name) {
+			found = append(found, cert)
+		}
+	}
+	return found, nil
+}
+
+// addSANs sorts names into the SAN fields of tmpl.
+func addSANs(tmpl *x509.Certificate, names []string) error {
+	for _, n := range names {
+		if ip := net.ParseIP(n); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if strings.Contains(n, "://") {
+			u, err := url.Parse(n)
+			if err != nil {
+				return fmt.Errorf("invalid URI %q: %v", n, err)
+			}
+			tmpl.URIs = append(tmpl.URIs, u)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, n)
+		}
+	}
+	return nil
+}
+
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	return serial, nil
+}
+
+func pemCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func readCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate in %s", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return cert, nil
+}
+
+// writeKeyPair writes a certificate, and its key readable only by the owner.
+func writeKeyPair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %v", err)
+	}
+	for _, f := range []string{certPath, keyPath} {
+		if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", filepath.Dir(f), err)
+		}
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", keyPath, err)
+	}
+	if err := os.WriteFile(certPath, pemCert(der), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", certPath, err)
+	}
+	return nil
+}
+
+// fingerprint renders the SHA-256 of a certificate the way the server's
+// config takes it, e.g. "AB:CD:...".
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// isClient reports whether cert was issued to a client.
+func isClient(cert *x509.Certificate) bool {
+	return slices.Contains(cert.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+}
@@ -0,0 +1,149 @@
+package certs
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPaths(t *testing.T) paths {
+	dir := t.TempDir()
+	return paths{
+		dir:        dir,
+		caCert:     filepath.Join(dir, "ca.crt"),
+		caKey:      filepath.Join(dir, "ca.key"),
+		crl:        filepath.Join(dir, "ca.crl"),
+		serverCert: filepath.Join(dir, "server.crt"),
+		serverKey:  filepath.Join(dir, "server.key"),
+	}
+}
+
+func TestCA(t *testing.T) {
+	p := testPaths(t)
+	c, err := initCA(p, "Test CA", 10*day)
+	if err != nil {
+		t.Fatalf("initCA failed: %v", err)
+	}
+	if _, err := initCA(p, "Test CA", 10*day); err == nil {
+		t.Error("Expected initCA to refuse to overwrite the CA")
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(c.cert)
+
+	server, err := c.issue("irc.home", []string{"irc.home", "192.0.2.1", "spiffe://home/server"}, x509.ExtKeyUsageServerAuth, day, p.serverCert, p.serverKey)
+	if err != nil {
+		t.Fatalf("issue failed: %v", err)
+	}
+	if len(server.DNSNames) != 1 || len(server.IPAddresses) != 1 || len(server.URIs) != 1 || server.Subject.CommonName != "irc.home" {
+		t.Errorf("Unexpected SANs: %v %v %v", server.DNSNames, server.IPAddresses, server.URIs)
+	}
+	if _, err := server.Verify(x509.VerifyOptions{Roots: roots, DNSName: "192.0.2.1"}); err != nil {
+		t.Errorf("Server certificate doesn't verify: %v", err)
+	}
+	if info, err := os.Stat(p.serverKey); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected a private key file, got %v %v", info, err)
+	}
+
+	clientPath := filepath.Join(p.dir, "laptop.crt")
+	laptop, err := c.issue("laptop", nil, x509.ExtKeyUsageClientAuth, day, clientPath, filepath.Join(p.dir, "laptop.key"))
+	if err != nil {
+		t.Fatalf("issue failed: %v", err)
+	}
+	if len(laptop.DNSNames) != 0 {
+		t.Errorf("Expected no SANs on the client, got %v", laptop.DNSNames)
+	}
+	if _, err := laptop.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("Client certificate doesn't verify: %v", err)
+	}
+	if _, err := c.issue("laptop", nil, x509.ExtKeyUsageClientAuth, day, clientPath, filepath.Join(p.dir, "laptop.key")); err == nil {
+		t.Error("Expected issue to refuse to overwrite a certificate")
+	}
+
+	// Renewing keeps the key and names, and can't outlive the CA.
+	renewed, err := c.renew(clientPath, 100*day)
+	if err != nil {
+		t.Fatalf("renew failed: %v", err)
+	}
+	if renewed.Subject.CommonName != "laptop" || string(renewed.RawSubjectPublicKeyInfo) != string(laptop.RawSubjectPublicKeyInfo) {
+		t.Errorf("Renewed certificate differs: %v", renewed.Subject)
+	}
+	if renewed.NotAfter.After(c.cert.NotAfter) || renewed.SerialNumber.Cmp(laptop.SerialNumber) == 0 {
+		t.Errorf("Unexpected renewal: valid until %v, serial %v", renewed.NotAfter, renewed.SerialNumber)
+	}
+
+	issued, err := c.issued()
+	if err != nil || len(issued) != 3 {
+		t.Fatalf("Expected 3 issued certificates, got %d (err %v)", len(issued), err)
+	}
+
+	// Revocations accumulate in a CRL signed by the CA.
+	if err := c.revoke([]*x509.Certificate{laptop}, day); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	if err := c.revoke([]*x509.Certificate{renewed}, day); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+	crl, err := c.crl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(c.cert); err != nil {
+		t.Errorf("CRL isn't signed by the CA: %v", err)
+	}
+	if len(crl.RevokedCertificateEntries) != 2 || crl.Number.Int64() != 2 || crl.NextUpdate.Before(time.Now()) {
+		t.Errorf("Unexpected CRL: %d entries, number %v", len(crl.RevokedCertificateEntries), crl.Number)
+	}
+	revoked, err := c.revoked()
+	if _, ok := revoked[laptop.SerialNumber.Text(16)]; !ok || err != nil {
+		t.Errorf("Expected the laptop to be revoked, got %v %v", revoked, err)
+	}
+
+	// A revoked client can't renew its way back in.
+	if _, err := c.renew(clientPath, day); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("Expected renewing a revoked certificate to fail, got %v", err)
+	}
+	// Nor with a certificate for a key whose older one was revoked.
+	phonePath := filepath.Join(p.dir, "phone.crt")
+	phone, err := c.issue("phone", nil, x509.ExtKeyUsageClientAuth, day, phonePath, filepath.Join(p.dir, "phone.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.renew(phonePath, day); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.revoke([]*x509.Certificate{phone}, day); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.renew(phonePath, day); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("Expected renewing a revoked key to fail, got %v", err)
+	}
+	if issued, _ := c.issued(); len(issued) != 5 {
+		t.Errorf("Expected nothing more issued for revoked clients, got %d certificates", len(issued))
+	}
+
+	found, err := c.find("laptop")
+	if err != nil || len(found) != 2 {
+		t.Errorf("Expected both laptop certificates, got %d (err %v)", len(found), err)
+	}
+	found, _ = c.find(server.SerialNumber.Text(16))
+	if len(found) != 1 || found[0].Subject.CommonName != "irc.home" {
+		t.Errorf("Expected the server certificate by serial, got %v", found)
+	}
+}
+
+func TestLoadCA(t *testing.T) {
+	p := testPaths(t)
+	if _, err := loadCA(p); err == nil {
+		t.Error("Expected an error without a CA")
+	}
+	if _, err := initCA(p, "Test CA", day); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadCA(p)
+	if err != nil || c.cert.Subject.CommonName != "Test CA" {
+		t.Errorf("loadCA failed: %v", err)
+	}
+}
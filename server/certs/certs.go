@@ -0,0 +1,273 @@
+// Package certs runs the certificate authority for the server's mTLS, as
+// `server certs`: it creates the CA, issues and renews server and client
+// certificates, lists what it issued and revokes certificates in a CRL the
+// server reads.
+package certs
+
+import (
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/protobuf/encoding/prototext"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+const day = 24 * time.Hour
+
+const usage = `Usage: server certs [-config file] [-dir dir] <command> [flags] [args]
+
+Commands:
+  init [-cn name] [-days n]             Create the CA
+  server [-days n] name...              Issue the server certificate; names are DNS names, IPs or URIs
+  client [-days n] [-out base] name [san...]  Issue a client certificate
+  renew [-days n] file...               Issue a new certificate for the same key and names
+  list                                  List issued certificates
+  revoke [-days n] name|serial...       Revoke certificates and write the CRL
+`
+
+// Run runs the command line args, the ones after "certs", writing what it
+// did to out.
+func Run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("certs", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	configPath := fs.String("config", "", "Server config to take file names from (tls section)")
+	dir := fs.String("dir", "certs", "Directory for the CA and client certificates")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no command given")
+	}
+
+	p, err := certPaths(*dir, *configPath)
+	if err != nil {
+		return err
+	}
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+	if cmd == "init" {
+		return runInit(p, args, out)
+	}
+	c, err := loadCA(p)
+	if err != nil {
+		return fmt.Errorf("%v (run server certs init first)", err)
+	}
+	switch cmd {
+	case "server":
+		return runServer(c, args, out)
+	case "client":
+		return runClient(c, args, out)
+	case "renew":
+		return runRenew(c, args, out)
+	case "list":
+		return runList(c, out)
+	case "revoke":
+		return runRevoke(c, args, out)
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+// certPaths places the files in dir, except those the server config names.
+func certPaths(dir, configPath string) (paths, error) {
+	p := paths{
+		dir:        dir,
+		caCert:     filepath.Join(dir, "ca.crt"),
+		caKey:      filepath.Join(dir, "ca.key"),
+		crl:        filepath.Join(dir, "ca.crl"),
+		serverCert: filepath.Join(dir, "server.crt"),
+		serverKey:  filepath.Join(dir, "server.key"),
+	}
+	if configPath == "" {
+		return p, nil
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return p, fmt.Errorf("failed to read config file: %v", err)
+	}
+	config := &pbConfig.Config{}
+	if err := prototext.Unmarshal(data, config); err != nil {
+		return p, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&p.caCert, config.GetTls().GetCaFile()},
+		{&p.crl, config.GetTls().GetCrlFile()},
+		{&p.serverCert, config.GetTls().GetCertFile()},
+		{&p.serverKey, config.GetTls().GetKeyFile()},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	return p, nil
+}
+
+func runInit(p paths, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	cn := fs.String("cn", "IRC-Bot-Root-CA", "Common name of the CA")
+	days := fs.Int("days", 3650, "Lifetime of the CA in days")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	c, err := initCA(p, *cn, time.Duration(*days)*day)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Created CA %q in %s, valid until %s\n", *cn, p.caCert, c.cert.NotAfter.Format(time.DateOnly))
+	fmt.Fprintf(out, "Keep %s safe; it can issue certificates the server accepts.\n", p.caKey)
+	return nil
+}
+
+func runServer(c *ca, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	days := fs.Int("days", 365, "Lifetime of the certificate in days")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("a server name is required")
+	}
+	// The server is checked by its SANs; the first name is also its CN.
+	cert, err := c.issue(fs.Arg(0), fs.Args(), x509.ExtKeyUsageServerAuth, time.Duration(*days)*day, c.paths.serverCert, c.paths.serverKey)
+	if err != nil {
+		return err
+	}
+	printIssued(out, cert, c.paths.serverCert)
+	return nil
+}
+
+func runClient(c *ca, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	days := fs.Int("days", 365, "Lifetime of the certificate in days")
+	base := fs.String("out", "", "File name to write, without extension; defaults to the name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("a client name is required")
+	}
+	name := fs.Arg(0)
+	if *base == "" {
+		*base = name
+	}
+	if strings.ContainsAny(*base, `/\`) {
+		return fmt.Errorf("invalid file name %q", *base)
+	}
+	certPath := filepath.Join(c.paths.dir, *base+".crt")
+	cert, err := c.issue(name, fs.Args()[1:], x509.ExtKeyUsageClientAuth, time.Duration(*days)*day, certPath, filepath.Join(c.paths.dir, *base+".key"))
+	if err != nil {
+		return err
+	}
+	printIssued(out, cert, certPath)
+	fmt.Fprintf(out, "Allow it in the server config with: allowed_clients: { name: %q cn: %q }\n", name, name)
+	return nil
+}
+
+func runRenew(c *ca, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("renew", flag.ContinueOnError)
+	days := fs.Int("days", 365, "Lifetime of the new certificate in days")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("a certificate file is required")
+	}
+	for _, path := range fs.Args() {
+		cert, err := c.renew(path, time.Duration(*days)*day)
+		if err != nil {
+			return err
+		}
+		printIssued(out, cert, path)
+	}
+	return nil
+}
+
+func runList(c *ca, out io.Writer) error {
+	certs, err := c.issued()
+	if err != nil {
+		return err
+	}
+	revoked, err := c.revoked()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tKIND\tNAME\tEXPIRES\tSTATUS\tSHA-256")
+	now := time.Now()
+	for _, cert := range certs {
+		kind := "server"
+		if isClient(cert) {
+			kind = "client"
+		}
+		serial := cert.SerialNumber.Text(16)
+		status := "valid"
+		if t, ok := revoked[serial]; ok {
+			status = "revoked " + t.Format(time.DateOnly)
+		} else if now.After(cert.NotAfter) {
+			status = "expired"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", serial, kind, cert.Subject.CommonName, cert.NotAfter.Format(time.DateOnly), status, fingerprint(cert))
+	}
+	return w.Flush()
+}
+
+func runRevoke(c *ca, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("revoke", flag.ContinueOnError)
+	days := fs.Int("days", 365, "How long the CRL is valid, in days")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("a name or serial number is required")
+	}
+	revoked, err := c.revoked()
+	if err != nil {
+		return err
+	}
+
+	var certs []*x509.Certificate
+	for _, name := range fs.Args() {
+		found, err := c.find(name)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return fmt.Errorf("no certificate issued to %q", name)
+		}
+		for _, cert := range found {
+			if _, ok := revoked[cert.SerialNumber.Text(16)]; !ok {
+				certs = append(certs, cert)
+			}
+		}
+	}
+	if len(certs) == 0 {
+		fmt.Fprintln(out, "Already revoked")
+		return nil
+	}
+	if err := c.revoke(certs, time.Duration(*days)*day); err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		fmt.Fprintf(out, "Revoked %s (serial %s, SHA-256 %s)\n", cert.Subject.CommonName, cert.SerialNumber.Text(16), fingerprint(cert))
+	}
+	fmt.Fprintf(out, "Wrote %s; set it as tls.crl_file and send the server SIGHUP to disconnect these clients.\n", c.paths.crl)
+	return nil
+}
+
+func printIssued(out io.Writer, cert *x509.Certificate, path string) {
+	fmt.Fprintf(out, "Issued %s for %s, serial %s, valid until %s\n", path, cert.Subject.CommonName, cert.SerialNumber.Text(16), cert.NotAfter.Format(time.DateOnly))
+	fmt.Fprintf(out, "SHA-256 %s\n", fingerprint(cert))
+}
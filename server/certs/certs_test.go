@@ -0,0 +1,81 @@
+package certs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+	steps := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"init"}, "Created CA"},
+		{[]string{"server", "localhost", "127.0.0.1"}, "server.crt for localhost"},
+		{[]string{"client", "-out", "client", "client_user"}, `allowed_clients: { name: "client_user" cn: "client_user" }`},
+		{[]string{"client", "-days", "30", "phone", "phone.home"}, "phone.crt for phone"},
+		{[]string{"renew", filepath.Join(dir, "phone.crt")}, "phone.crt for phone"},
+		{[]string{"revoke", "phone"}, "Revoked phone"},
+		{[]string{"revoke", "phone"}, "Already revoked"},
+		{[]string{"list"}, "client  phone"},
+	}
+	for _, s := range steps {
+		var out bytes.Buffer
+		if err := Run(append([]string{"-dir", dir}, s.args...), &out); err != nil {
+			t.Fatalf("%v failed: %v", s.args, err)
+		}
+		if !strings.Contains(out.String(), s.want) {
+			t.Errorf("%v: expected %q in\n%s", s.args, s.want, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	Run([]string{"-dir", dir, "list"}, &out)
+	if n := strings.Count(out.String(), "revoked"); n != 2 {
+		t.Errorf("Expected both phone certificates revoked, got\n%s", out.String())
+	}
+
+	for _, args := range [][]string{
+		{"init"},
+		{"client"},
+		{"revoke", "nobody"},
+		{"client", "-out", "../x", "x"},
+		{"bogus"},
+	} {
+		if err := Run(append([]string{"-dir", dir}, args...), new(bytes.Buffer)); err == nil {
+			t.Errorf("Expected %v to fail", args)
+		}
+	}
+	if err := Run([]string{"-dir", filepath.Join(dir, "none"), "list"}, new(bytes.Buffer)); err == nil {
+		t.Error("Expected an error without a CA")
+	}
+}
+
+func TestCertPaths(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.textproto")
+	if err := os.WriteFile(config, []byte(`tls: { ca_file: "/etc/irc/ca.pem" crl_file: "/etc/irc/ca.crl" }`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := certPaths("certs", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := paths{
+		dir:        "certs",
+		caCert:     "/etc/irc/ca.pem",
+		caKey:      filepath.Join("certs", "ca.key"),
+		crl:        "/etc/irc/ca.crl",
+		serverCert: filepath.Join("certs", "server.crt"),
+		serverKey:  filepath.Join("certs", "server.key"),
+	}
+	if p != want {
+		t.Errorf("Got %+v, want %+v", p, want)
+	}
+	if _, err := certPaths("certs", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error for a missing config")
+	}
+}
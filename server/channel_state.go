@@ -0,0 +1,227 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lrstanley/girc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+// channelState is what the bot knows about a channel it is in. It is built
+// from NAMES, TOPIC and MODE replies and kept current by membership changes.
+type channelState struct {
+	name       string // As we joined it
+	topic      string
+	topicSetBy string
+	topicSetAt time.Time
+	members    map[string]*channelMember // RFC1459-folded nick -> member
+	modes      map[byte]string           // Mode -> argument, "" if it takes none
+}
+
+type channelMember struct {
+	nick     string
+	prefixes string // Membership prefixes, highest first, e.g. "@+"
+}
+
+func newChannelState(name string) *channelState {
+	return &channelState{
+		name:    name,
+		members: make(map[string]*channelMember),
+		modes:   make(map[byte]string),
+	}
+}
+
+// modeInfo describes the server's channel modes, from the PREFIX and
+// CHANMODES ISUPPORT tokens.
+type modeInfo struct {
+	prefixModes string // Modes that grant a prefix, highest first, e.g. "ov"
+	prefixes    string // The matching prefixes, e.g. "@+"
+	listModes   string // CHANMODES type A: lists like bans, not tracked
+	alwaysArg   string // Type B: always take an argument
+	setArg      string // Type C: take an argument only when set
+}
+
+// Defaults from RFC 2811, for servers that don't advertise ISUPPORT.
+const (
+	defaultPrefix    = "(ov)@+"
+	defaultChanModes = "beI,k,l,imnpst"
+)
+
+func newModeInfo(prefix, chanModes string) modeInfo {
+	var mi modeInfo
+	if modes, prefixes, ok := strings.Cut(strings.TrimPrefix(prefix, "("), ")"); ok && len(modes) == len(prefixes) {
+		mi.prefixModes, mi.prefixes = modes, prefixes
+	} else {
+		mi = newModeInfo(defaultPrefix, "")
+	}
+
+	types := strings.Split(chanModes, ",")
+	if len(types) < 4 {
+		types = strings.Split(defaultChanModes, ",")
+	}
+	mi.listModes, mi.alwaysArg, mi.setArg = types[0], types[1], types[2]
+	return mi
+}
+
+// serverModes returns the mode info the connected server advertised.
+func serverModes(c *girc.Client) modeInfo {
+	prefix, _ := c.GetServerOption("PREFIX")
+	chanModes, _ := c.GetServerOption("CHANMODES")
+	return newModeInfo(prefix, chanModes)
+}
+
+// splitPrefixes separates the membership prefixes from a nick in a NAMES
+// reply. Servers with multi-prefix send all of them.
+func (mi modeInfo) splitPrefixes(name string) (prefixes, nick string) {
+	i := 0
+	for i < len(name) && strings.IndexByte(mi.prefixes, name[i]) >= 0 {
+		i++
+	}
+	return mi.sortPrefixes(name[:i]), name[i:]
+}
+
+// sortPrefixes orders prefixes from highest to lowest, dropping duplicates.
+func (mi modeInfo) sortPrefixes(p string) string {
+	var out []byte
+	for i := 0; i < len(mi.prefixes); i++ {
+		if strings.IndexByte(p, mi.prefixes[i]) >= 0 {
+			out = append(out, mi.prefixes[i])
+		}
+	}
+	return string(out)
+}
+
+func (cs *channelState) addMember(nick, prefixes string) {
+	cs.members[girc.ToRFC1459(nick)] = &channelMember{nick: nick, prefixes: prefixes}
+}
+
+// removeMember reports whether nick was a member.
+func (cs *channelState) removeMember(nick string) bool {
+	folded := girc.ToRFC1459(nick)
+	_, ok := cs.members[folded]
+	delete(cs.members, folded)
+	return ok
+}
+
+// renameMember reports whether oldNick was a member.
+func (cs *channelState) renameMember(oldNick, newNick string) bool {
+	folded := girc.ToRFC1459(oldNick)
+	m, ok := cs.members[folded]
+	if !ok {
+		return false
+	}
+	delete(cs.members, folded)
+	m.nick = newNick
+	cs.members[girc.ToRFC1459(newNick)] = m
+	return true
+}
+
+func (cs *channelState) setTopic(topic, setBy string, at time.Time) {
+	cs.topic = topic
+	cs.topicSetBy = setBy
+	cs.topicSetAt = at
+}
+
+// applyModes applies a mode change such as ["+ov-k", "alice", "bob", "key"].
+func (cs *channelState) applyModes(mi modeInfo, params []string) {
+	if len(params) == 0 {
+		return
+	}
+	args := params[1:]
+	nextArg := func() string {
+		if len(args) == 0 {
+			return ""
+		}
+		arg := args[0]
+		args = args[1:]
+		return arg
+	}
+
+	adding := true
+	for i := 0; i < len(params[0]); i++ {
+		mode := params[0][i]
+		switch {
+		case mode == '+':
+			adding = true
+		case mode == '-':
+			adding = false
+		case strings.IndexByte(mi.prefixModes, mode) >= 0:
+			prefix := mi.prefixes[strings.IndexByte(mi.prefixModes, mode)]
+			m := cs.members[girc.ToRFC1459(nextArg())]
+			if m == nil {
+				continue
+			}
+			if adding {
+				m.prefixes = mi.sortPrefixes(m.prefixes + string(prefix))
+			} else {
+				m.prefixes = strings.ReplaceAll(m.prefixes, string(prefix), "")
+			}
+		case strings.IndexByte(mi.listModes, mode) >= 0:
+			nextArg()
+		case strings.IndexByte(mi.alwaysArg, mode) >= 0:
+			arg := nextArg()
+			if adding {
+				cs.modes[mode] = arg
+			} else {
+				delete(cs.modes, mode)
+			}
+		case strings.IndexByte(mi.setArg, mode) >= 0:
+			if adding {
+				cs.modes[mode] = nextArg()
+			} else {
+				delete(cs.modes, mode)
+			}
+		default:
+			if adding {
+				cs.modes[mode] = ""
+			} else {
+				delete(cs.modes, mode)
+			}
+		}
+	}
+}
+
+// modeString formats the channel modes as they appear in a MODE reply,
+// e.g. "+kl key 10".
+func (cs *channelState) modeString() string {
+	if len(cs.modes) == 0 {
+		return ""
+	}
+	var modes []byte
+	for m := range cs.modes {
+		modes = append(modes, m)
+	}
+	sort.Slice(modes, func(i, j int) bool { return modes[i] < modes[j] })
+
+	var args []string
+	for _, m := range modes {
+		if arg := cs.modes[m]; arg != "" {
+			args = append(args, arg)
+		}
+	}
+	return strings.Join(append([]string{"+" + string(modes)}, args...), " ")
+}
+
+// snapshot returns the state as sent to clients. Members are sorted by nick.
+func (cs *channelState) snapshot(channel string) *pbService.ChannelState {
+	st := &pbService.ChannelState{
+		Channel:    channel,
+		Topic:      cs.topic,
+		TopicSetBy: cs.topicSetBy,
+		Modes:      cs.modeString(),
+	}
+	if !cs.topicSetAt.IsZero() {
+		st.TopicSetAt = timestamppb.New(cs.topicSetAt)
+	}
+	for _, m := range cs.members {
+		st.Members = append(st.Members, &pbService.ChannelMember{Nick: m.nick, Prefixes: m.prefixes})
+	}
+	sort.Slice(st.Members, func(i, j int) bool {
+		return girc.ToRFC1459(st.Members[i].GetNick()) < girc.ToRFC1459(st.Members[j].GetNick())
+	})
+	return st
+}
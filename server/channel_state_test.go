@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestModeInfo(t *testing.T) {
+	mi := newModeInfo("(qaohv)~&@%+", "beI,k,l,imnpst")
+	if mi.prefixModes != "qaohv" || mi.prefixes != "~&@%+" || mi.alwaysArg != "k" {
+		t.Errorf("Unexpected mode info: %+v", mi)
+	}
+
+	// Multi-prefix names come back highest first.
+	if prefixes, nick := mi.splitPrefixes("+@alice"); prefixes != "@+" || nick != "alice" {
+		t.Errorf("Expected @+ alice, got %q %q", prefixes, nick)
+	}
+
+	// Missing or malformed ISUPPORT falls back to the RFC defaults.
+	def := newModeInfo("", "")
+	if def.prefixModes != "ov" || def.prefixes != "@+" || def.setArg != "l" {
+		t.Errorf("Unexpected default mode info: %+v", def)
+	}
+}
+
+func TestChannelState_ApplyModes(t *testing.T) {
+	mi := newModeInfo(defaultPrefix, defaultChanModes)
+	cs := newChannelState("#test")
+	cs.addMember("alice", "")
+	cs.addMember("Bob", "+")
+
+	cs.applyModes(mi, []string{"+ntokb-v+l", "Alice", "secret", "*!*@spam", "bob", "10"})
+	if got := cs.modeString(); got != "+klnt secret 10" {
+		t.Errorf("Expected +klnt secret 10, got %q", got)
+	}
+	if cs.members["alice"].prefixes != "@" || cs.members["bob"].prefixes != "" {
+		t.Errorf("Expected alice opped and bob devoiced, got %q %q", cs.members["alice"].prefixes, cs.members["bob"].prefixes)
+	}
+
+	cs.applyModes(mi, []string{"-kl", "secret"})
+	if got := cs.modeString(); got != "+nt" {
+		t.Errorf("Expected +nt, got %q", got)
+	}
+}
+
+func TestChannelState_Snapshot(t *testing.T) {
+	cs := newChannelState("#test")
+	cs.addMember("zed", "")
+	cs.addMember("Alice", "@")
+	if !cs.renameMember("zed", "bob") || cs.renameMember("nobody", "x") {
+		t.Error("Expected only existing members to be renamed")
+	}
+
+	st := cs.snapshot("#test")
+	if len(st.GetMembers()) != 2 || st.GetMembers()[0].GetNick() != "Alice" || st.GetMembers()[1].GetNick() != "bob" {
+		t.Errorf("Expected members sorted by nick, got %v", st.GetMembers())
+	}
+	if st.GetTopicSetAt() != nil {
+		t.Errorf("Expected no topic time, got %v", st.GetTopicSetAt())
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lrstanley/girc"
+	"github.com/morrowc/irc-bot/server/history"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+const (
+	chathistoryCap = "draft/chathistory"
+	// Most messages asked for when filling in a channel, if the server
+	// allows as many.
+	maxBackfill = 1000
+	// How long live events wait for the server's history. After that they
+	// are recorded without it.
+	backfillTimeout = 10 * time.Second
+	// server-time's format, which chathistory timestamps use too.
+	serverTimeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+// backfill is a channel's history being filled in from the server's after we
+// (re)joined it. Meanwhile live events for the channel are held back, so
+// that history stays in order.
+type backfill struct {
+	channel string
+	since   time.Time // Newest event we had
+	limit   int       // Most messages asked for
+	got     []*pbService.IRCMessage
+	held    []*pbService.StreamEvent
+	done    bool // Being recorded; nothing more is collected
+	timer   *time.Timer
+}
+
+// startBackfill asks the server for the messages in channel we missed since
+// the newest event in its history, if the server keeps history. LATEST
+// brings the most recent ones if there are more than limit.
+func (b *IRCBot) startBackfill(c *girc.Client, channel string) {
+	if !c.HasCapability(chathistoryCap) {
+		return
+	}
+	buf := b.history(channel)
+	if buf == nil {
+		return
+	}
+	newest, _ := buf.Page(0, 1, false)
+	if len(newest) == 0 {
+		// Nothing to continue from.
+		return
+	}
+	limit := maxBackfill
+	if n, ok := c.GetServerOptionInt("CHATHISTORY"); ok && n > 0 && n < limit {
+		limit = n
+	}
+
+	fill := &backfill{channel: channel, since: history.EventTime(newest[0]), limit: limit}
+	folded := girc.ToRFC1459(channel)
+	b.mu.Lock()
+	if b.fills[folded] != nil {
+		b.mu.Unlock()
+		return
+	}
+	b.fills[folded] = fill
+	fill.timer = time.AfterFunc(backfillTimeout, func() {
+		log.Printf("No history for %s from the server after %v", channel, backfillTimeout)
+		b.finishBackfill(fill)
+	})
+	b.mu.Unlock()
+
+	c.Send(&girc.Event{Command: "CHATHISTORY", Params: []string{
+		"LATEST", channel, "timestamp=" + fill.since.UTC().Format(serverTimeFormat), strconv.Itoa(limit),
+	}})
+}
+
+// hold keeps back an event for a channel being filled in. It reports
+// whether it did.
+func (b *IRCBot) hold(channel string, ev *pbService.StreamEvent) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fill := b.fills[girc.ToRFC1459(channel)]
+	if fill == nil {
+		return false
+	}
+	fill.held = append(fill.held, ev)
+	return true
+}
+
+// collect takes msg for the backfill whose batch e is part of. It reports
+// whether it did: messages of a chathistory batch are never live, even
+// when their backfill is over or there is none.
+func (b *IRCBot) collect(e girc.Event, msg *pbService.IRCMessage) bool {
+	ref, ok := e.Tags.Get("batch")
+	if !ok {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fill, ok := b.fillBatch[ref]
+	if !ok {
+		return false
+	}
+	if fill != nil && !fill.done {
+		fill.got = append(fill.got, msg)
+	}
+	return true
+}
+
+// playback reports whether e is part of a chathistory batch.
+func (b *IRCBot) playback(e *girc.Event) bool {
+	ref, ok := e.Tags.Get("batch")
+	if !ok {
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok = b.fillBatch[ref]
+	return ok
+}
+
+// handleBatch follows chathistory batches: "BATCH +ref chathistory
+// #channel" starts one and "BATCH -ref" ends it. One that comes too late
+// for its backfill, or that we didn't ask for, is kept track of all the
+// same, with no backfill, so that its messages are dropped.
+func (b *IRCBot) handleBatch(c *girc.Client, e girc.Event) {
+	if len(e.Params) == 0 || len(e.Params[0]) < 2 {
+		return
+	}
+	ref := e.Params[0][1:]
+	b.mu.Lock()
+	if e.Params[0][0] == '+' {
+		if len(e.Params) >= 3 && e.Params[1] == "chathistory" {
+			b.fillBatch[ref] = b.fills[girc.ToRFC1459(e.Params[2])]
+		}
+		b.mu.Unlock()
+		return
+	}
+	fill := b.fillBatch[ref]
+	delete(b.fillBatch, ref)
+	b.mu.Unlock()
+	if fill != nil {
+		b.finishBackfill(fill)
+	}
+}
+
+// handleFail gives up on filling in a channel the server has no history
+// for, e.g. "FAIL CHATHISTORY INVALID_TARGET AFTER #channel :No such channel".
+func (b *IRCBot) handleFail(c *girc.Client, e girc.Event) {
+	if len(e.Params) < 2 || e.Params[0] != "CHATHISTORY" {
+		return
+	}
+	log.Printf("Server history failed: %s", strings.Join(e.Params[1:], " "))
+	for _, p := range e.Params[1 : len(e.Params)-1] {
+		b.mu.RLock()
+		fill := b.fills[girc.ToRFC1459(p)]
+		b.mu.RUnlock()
+		if fill != nil {
+			b.finishBackfill(fill)
+		}
+	}
+}
+
+// finishBackfill records the messages we missed, in order and leaving out
+// those we have, then the events held back meanwhile.
+func (b *IRCBot) finishBackfill(fill *backfill) {
+	b.mu.Lock()
+	if fill.done {
+		b.mu.Unlock()
+		return
+	}
+	fill.done = true
+	fill.timer.Stop()
+	got := fill.got
+	b.mu.Unlock()
+
+	// Leave out what we already have, kept before the outage or held back
+	// since: the server's reference time is only to the millisecond.
+	seen := make(map[string]bool)
+	if buf := b.history(fill.channel); buf != nil {
+		for _, ev := range buf.GetSince(fill.since.Add(-time.Second)) {
+			markSeen(seen, ev.GetMessage())
+		}
+	}
+	b.mu.Lock()
+	for _, ev := range fill.held {
+		markSeen(seen, ev.GetMessage())
+	}
+	b.mu.Unlock()
+
+	var missed []*pbService.StreamEvent
+	sort.SliceStable(got, func(i, j int) bool {
+		return got[i].GetTimestamp().AsTime().Before(got[j].GetTimestamp().AsTime())
+	})
+	for _, msg := range got {
+		if msg.GetTimestamp().AsTime().Before(fill.since) || seenBefore(seen, msg) {
+			continue
+		}
+		markSeen(seen, msg)
+		missed = append(missed, messageEvent(msg))
+	}
+	if len(missed) > 0 {
+		b.broadcast(systemEvent(backfillNotice(fill, missed, len(got) >= fill.limit)))
+	}
+
+	// Record the missed messages, then whatever was held back, including
+	// events that arrive while we do.
+	b.mu.Lock()
+	fill.held = append(missed, fill.held...)
+	for {
+		evs := fill.held
+		fill.held = nil
+		if len(evs) == 0 {
+			break
+		}
+		b.mu.Unlock()
+		for _, ev := range evs {
+			b.store(fill.channel, ev)
+		}
+		b.mu.Lock()
+	}
+	// Its batch, if still going, is kept until it ends: the rest of it is
+	// collected into nothing.
+	folded := girc.ToRFC1459(fill.channel)
+	if b.fills[folded] == fill {
+		delete(b.fills, folded)
+	}
+	b.mu.Unlock()
+}
+
+// backfillNotice tells clients which messages were filled in. more says
+// the server may have had older ones than it sent.
+func backfillNotice(fill *backfill, missed []*pbService.StreamEvent, more bool) *pbService.SystemMessage {
+	first, last := history.EventTime(missed[0]), history.EventTime(missed[len(missed)-1])
+	content := fmt.Sprintf("Filled in %d messages in %s from the server's history, %s to %s UTC",
+		len(missed), fill.channel, first.UTC().Format(time.DateTime), last.UTC().Format(time.DateTime))
+	if more {
+		content += "; earlier ones may be missing"
+	}
+	return &pbService.SystemMessage{
+		Timestamp: timestamppb.New(first),
+		Channel:   fill.channel,
+		Content:   content,
+	}
+}
+
+// seenKeys returns what tells msg apart: its msgid if it has one, and its
+// time, sender and text.
+func seenKeys(msg *pbService.IRCMessage) []string {
+	keys := []string{fmt.Sprintf("%d %s %s", msg.GetTimestamp().AsTime().UnixMilli(), girc.ToRFC1459(msg.GetSender()), msg.GetContent())}
+	if id := msg.GetTags()["msgid"]; id != "" {
+		keys = append(keys, "msgid "+id)
+	}
+	return keys
+}
+
+func markSeen(seen map[string]bool, msg *pbService.IRCMessage) {
+	if msg == nil {
+		return
+	}
+	for _, k := range seenKeys(msg) {
+		seen[k] = true
+	}
+}
+
+func seenBefore(seen map[string]bool, msg *pbService.IRCMessage) bool {
+	for _, k := range seenKeys(msg) {
+		if seen[k] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+	"github.com/morrowc/irc-bot/server/history"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+// fakeHistoryServer lets a client join #test, where a message arrives live
+// right away, and answers CHATHISTORY with what the client missed.
+func fakeHistoryServer(t *testing.T) (*pbConfig.Endpoint, <-chan string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	asked := make(chan string, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case strings.HasPrefix(line, "CAP LS"):
+				fmt.Fprint(conn, ":irc.test CAP * LS :draft/chathistory batch server-time message-tags\r\n")
+			case strings.HasPrefix(line, "CAP REQ"):
+				fmt.Fprintf(conn, ":irc.test CAP * ACK :%s\r\n", strings.TrimPrefix(line, "CAP REQ :"))
+			case strings.HasPrefix(line, "USER "):
+				fmt.Fprint(conn, ":irc.test 001 testbot :Welcome\r\n")
+				fmt.Fprint(conn, ":irc.test 005 testbot CHATHISTORY=50 :are supported by this server\r\n")
+			case strings.HasPrefix(line, "JOIN #test"):
+				fmt.Fprint(conn, ":testbot!bot@example.com JOIN #test\r\n")
+				fmt.Fprint(conn, "@time=2024-05-01T12:04:00.000Z;msgid=d :alice!a@example.com PRIVMSG #test :live\r\n")
+			case strings.HasPrefix(line, "CHATHISTORY "):
+				asked <- line
+				for _, l := range []string{
+					":irc.test BATCH +h chathistory #test",
+					"@batch=h;time=2024-05-01T12:00:00.000Z;msgid=a :alice!a@example.com PRIVMSG #test :before",
+					"@batch=h;time=2024-05-01T12:03:00.000Z;msgid=c :bob!b@example.com PRIVMSG #test :missed 2",
+					"@batch=h;time=2024-05-01T12:02:00.000Z;msgid=b :testbot!bot@example.com PRIVMSG #test :missed 1",
+					"@batch=h;time=2024-05-01T12:04:00.000Z;msgid=d :alice!a@example.com PRIVMSG #test :live",
+					":irc.test BATCH -h",
+				} {
+					fmt.Fprint(conn, l+"\r\n")
+				}
+			}
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+	return &pbConfig.Endpoint{Host: "127.0.0.1", Port: int32(addr.Port)}, asked
+}
+
+func TestBackfill(t *testing.T) {
+	srv, asked := fakeHistoryServer(t)
+	buf := history.NewChannelBuffer(10)
+	buf.Add(messageEvent(&pbService.IRCMessage{
+		Channel:   "#test",
+		Sender:    "alice",
+		Content:   "before",
+		Timestamp: timestamppb.New(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)),
+		Tags:      map[string]string{"msgid": "a"},
+	}))
+
+	var mu sync.Mutex
+	var notices []string
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{
+		Host: srv.GetHost(),
+		Port: srv.GetPort(),
+		Nick: "testbot",
+		User: "testbot",
+	}, []*pbConfig.Channel{{Name: "#test"}}, func(string) history.Store { return buf }, func(ev *pbService.StreamEvent) {
+		if sm := ev.GetSystemMessage(); sm != nil {
+			mu.Lock()
+			notices = append(notices, sm.GetContent())
+			mu.Unlock()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bot.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		bot.Close()
+		<-done
+	}()
+
+	select {
+	case line := <-asked:
+		if want := "CHATHISTORY LATEST #test timestamp=2024-05-01T12:00:00.000Z 50"; line != want {
+			t.Errorf("Expected %q, got %q", want, line)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("History was never asked for")
+	}
+
+	// What we missed goes in before the JOIN and the live message held
+	// back meanwhile; what we had is left out.
+	want := "alice before|testbot missed 1|bob missed 2|JOIN testbot|alice live"
+	var got string
+	deadline := time.Now().Add(2 * time.Second)
+	for got != want && time.Now().Before(deadline) {
+		var evs []string
+		for _, ev := range buf.GetSince(time.Time{}) {
+			if msg := ev.GetMessage(); msg != nil {
+				evs = append(evs, msg.GetSender()+" "+msg.GetContent())
+			} else {
+				evs = append(evs, ev.GetChannelEvent().GetType().String()+" "+ev.GetChannelEvent().GetActor())
+			}
+		}
+		got = strings.Join(evs, "|")
+		time.Sleep(time.Millisecond)
+	}
+	if got != want {
+		t.Errorf("Unexpected history:\n%s\nwant:\n%s", got, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if joined := strings.Join(notices, "\n"); !strings.Contains(joined, "Filled in 2 messages in #test from the server's history, 2024-05-01 12:02:00 to 2024-05-01 12:03:00 UTC") {
+		t.Errorf("Expected a notice of the filled in range, got:\n%s", joined)
+	}
+}
+
+func TestBackfill_Fail(t *testing.T) {
+	buf := history.NewChannelBuffer(10)
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{Nick: "testbot"}, nil, func(string) history.Store { return buf }, func(*pbService.StreamEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill := &backfill{channel: "#Test", limit: 50, timer: time.NewTimer(time.Hour)}
+	bot.fills["#test"] = fill
+
+	bot.handleText(girc.Event{Source: &girc.Source{Name: "alice"}, Command: girc.PRIVMSG, Params: []string{"#test", "live"}}, pbService.IRCMessage_PRIVMSG)
+	if evs := buf.GetSince(time.Time{}); len(evs) != 0 {
+		t.Fatalf("Expected the message to be held back, got %v", evs)
+	}
+
+	// The server has no history for the channel; the held message goes in.
+	bot.handleFail(bot.client, girc.Event{Command: "FAIL", Params: []string{"CHATHISTORY", "INVALID_TARGET", "LATEST", "#test", "No such channel"}})
+	if evs := buf.GetSince(time.Time{}); len(evs) != 1 || evs[0].GetMessage().GetContent() != "live" {
+		t.Errorf("Expected the held message in history, got %v", evs)
+	}
+	if len(bot.fills) != 0 {
+		t.Errorf("Expected the backfill to be over, got %v", bot.fills)
+	}
+}
+
+func TestBackfill_Late(t *testing.T) {
+	buf := history.NewChannelBuffer(10)
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{Nick: "testbot"}, nil, func(string) history.Store { return buf }, func(*pbService.StreamEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := func(params ...string) {
+		bot.handleBatch(bot.client, girc.Event{Command: "BATCH", Params: params})
+	}
+	old := func(ref, text string) girc.Event {
+		return girc.Event{
+			Tags:    girc.Tags{"batch": ref, "time": "2024-05-01T12:00:00.000Z"},
+			Source:  &girc.Source{Name: "alice"},
+			Command: girc.PRIVMSG,
+			Params:  []string{"#test", text},
+		}
+	}
+
+	// The server's history comes after we gave up waiting for it.
+	fill := &backfill{channel: "#test", limit: 50, timer: time.NewTimer(time.Hour)}
+	bot.fills["#test"] = fill
+	bot.finishBackfill(fill)
+	batch("+a", "chathistory", "#test")
+	bot.handleText(old("a", "old"), pbService.IRCMessage_PRIVMSG)
+	batch("-a")
+
+	// It starts in time, but we give up before it ends.
+	fill = &backfill{channel: "#test", limit: 50, timer: time.NewTimer(time.Hour)}
+	bot.fills["#test"] = fill
+	batch("+b", "chathistory", "#test")
+	bot.finishBackfill(fill)
+	ctcp := old("b", "\x01VERSION\x01")
+	if !bot.skipCTCP(*girc.DecodeCTCP(&ctcp)) {
+		t.Error("Expected a CTCP query from the server's history to go unanswered")
+	}
+	bot.handleText(old("b", "old"), pbService.IRCMessage_PRIVMSG)
+	batch("-b")
+
+	if evs := buf.GetSince(time.Time{}); len(evs) != 0 {
+		t.Errorf("Expected late history to be dropped, got %v", evs)
+	}
+	if len(bot.fillBatch) != 0 {
+		t.Errorf("Expected the batches to be over, got %v", bot.fillBatch)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"slices"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+// clientAllowList holds the client certificates the server accepts, and who
+// each belongs to.
+type clientAllowList struct {
+	entries []allowedClient
+}
+
+type allowedClient struct {
+	name        string
+	cn          string
+	dnsSAN      string
+	uriSAN      string
+	fingerprint []byte
+}
+
+// newClientAllowList reads tls.client_cn and tls.allowed_clients. If neither
+// is set, the list is empty and any certificate signed by the CA is accepted.
+func newClientAllowList(cfg *pbConfig.TLS) (*clientAllowList, error) {
+	l := &clientAllowList{}
+	if cn := cfg.GetClientCn(); cn != "" {
+		l.entries = append(l.entries, allowedClient{name: cn, cn: cn})
+	}
+	for i, id := range cfg.GetAllowedClients() {
+		e := allowedClient{
+			name:   id.GetName(),
+			cn:     id.GetCn(),
+			dnsSAN: id.GetDnsSan(),
+			uriSAN: id.GetUriSan(),
+		}
+		if fp := id.GetFingerprint(); fp != "" {
+			sum, err := parseFingerprint(fp)
+			if err != nil {
+				return nil, err
+			}
+			e.fingerprint = sum
+		}
+		if e.cn == "" && e.dnsSAN == "" && e.uriSAN == "" && e.fingerprint == nil {
+			return nil, fmt.Errorf("allowed client %d (%q) has nothing to match", i, e.name)
+		}
+		if e.name == "" {
+			e.name = e.cn
+		}
+		if e.name == "" {
+			return nil, fmt.Errorf("allowed client %d needs a name or cn", i)
+		}
+		l.entries = append(l.entries, e)
+	}
+	return l, nil
+}
+
+// match returns the name of the first entry cert satisfies. With an empty
+// list every certificate matches, under its CN.
+func (l *clientAllowList) match(cert *x509.Certificate) (string, bool) {
+	if l == nil || len(l.entries) == 0 {
+		return cert.Subject.CommonName, true
+	}
+	for _, e := range l.entries {
+		if e.matches(cert) {
+			return e.name, true
+		}
+	}
+	return "", false
+}
+
+func (e *allowedClient) matches(cert *x509.Certificate) bool {
+	if e.cn != "" && cert.Subject.CommonName != e.cn {
+		return false
+	}
+	if e.dnsSAN != "" && !slices.Contains(cert.DNSNames, e.dnsSAN) {
+		return false
+	}
+	if e.uriSAN != "" && !slices.ContainsFunc(cert.URIs, func(u *url.URL) bool { return u.String() == e.uriSAN }) {
+		return false
+	}
+	if e.fingerprint != nil {
+		sum := sha256.Sum256(cert.Raw)
+		if !bytes.Equal(sum[:], e.fingerprint) {
+			return false
+		}
+	}
+	return true
+}
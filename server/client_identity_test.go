@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/url"
+	"testing"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+func TestClientAllowList(t *testing.T) {
+	cert, _ := selfSignedCert(t, "phone.home")
+	cert.URIs = []*url.URL{{Scheme: "spiffe", Host: "home", Path: "/phone"}}
+	sum := sha256.Sum256(cert.Raw)
+
+	tests := []struct {
+		desc     string
+		cfg      *pbConfig.TLS
+		wantName string
+		wantOK   bool
+	}{
+		{"no list", &pbConfig.TLS{}, "phone.home", true},
+		{"client_cn", &pbConfig.TLS{ClientCn: "phone.home"}, "phone.home", true},
+		{"client_cn other", &pbConfig.TLS{ClientCn: "laptop.home"}, "", false},
+		{"dns", &pbConfig.TLS{AllowedClients: []*pbConfig.ClientIdentity{{Name: "phone", DnsSan: "phone.home"}}}, "phone", true},
+		{"uri", &pbConfig.TLS{AllowedClients: []*pbConfig.ClientIdentity{{Name: "phone", UriSan: "spiffe://home/phone"}}}, "phone", true},
+		{"fingerprint", &pbConfig.TLS{AllowedClients: []*pbConfig.ClientIdentity{{Name: "phone", Fingerprint: formatFingerprint(sum[:])}}}, "phone", true},
+		{"all fields must match", &pbConfig.TLS{AllowedClients: []*pbConfig.ClientIdentity{{Name: "phone", Cn: "phone.home", UriSan: "spiffe://home/laptop"}}}, "", false},
+		{"second entry", &pbConfig.TLS{
+			ClientCn:       "laptop.home",
+			AllowedClients: []*pbConfig.ClientIdentity{{Cn: "phone.home"}},
+		}, "phone.home", true},
+	}
+	for _, tt := range tests {
+		l, err := newClientAllowList(tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: newClientAllowList failed: %v", tt.desc, err)
+		}
+		name, ok := l.match(cert)
+		if name != tt.wantName || ok != tt.wantOK {
+			t.Errorf("%s: got %q %v, want %q %v", tt.desc, name, ok, tt.wantName, tt.wantOK)
+		}
+	}
+
+	bad := []*pbConfig.ClientIdentity{
+		{Name: "empty"},
+		{DnsSan: "phone.home"},
+		{Name: "short", Fingerprint: "abcd"},
+	}
+	for _, id := range bad {
+		if _, err := newClientAllowList(&pbConfig.TLS{AllowedClients: []*pbConfig.ClientIdentity{id}}); err == nil {
+			t.Errorf("Expected an error for %v", id)
+		}
+	}
+}
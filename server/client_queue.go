@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/morrowc/irc-bot/server/history"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+const defaultClientQueueSize = 256
+
+// eventSink is where a client's events go: a StreamMessages stream, or a
+// connection of the IRC listener.
+type eventSink interface {
+	Send(*pbService.StreamEvent) error
+}
+
+// clientQueue buffers outbound events for a single subscriber. A dedicated
+// sender goroutine drains it, so a slow client only delays itself instead of
+// the broadcaster (and with it the IRC handler goroutine).
+type clientQueue struct {
+	stream eventSink
+	peer   string         // Remote address
+	id     clientIdentity // Who it authenticated as
+	certs  []*x509.Certificate
+	since  time.Time
+	limit  int
+	policy pbConfig.OverflowPolicy
+
+	mu      sync.Mutex
+	events  []*pbService.StreamEvent
+	skipped int               // Events skipped under OVERFLOW_COALESCE, not yet reported
+	floor   map[string]uint64 // History key -> newest event ID already sent by the history replay
+	slow    bool              // Currently overflowing, so we only log once per episode
+	err     error
+
+	// Stats
+	sent     uint64
+	dropped  uint64
+	maxDepth int
+
+	wake      chan struct{}
+	done      chan struct{}
+	stopped   chan struct{} // Closed when run returns
+	closeOnce sync.Once
+}
+
+func newClientQueue(stream eventSink, peer string, limit int, policy pbConfig.OverflowPolicy) *clientQueue {
+	if limit <= 0 {
+		limit = defaultClientQueueSize
+	}
+	return &clientQueue{
+		stream:  stream,
+		peer:    peer,
+		since:   time.Now(),
+		limit:   limit,
+		policy:  policy,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// enqueue adds an event without blocking, applying the overflow policy if the
+// queue is full.
+func (q *clientQueue) enqueue(ev *pbService.StreamEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return
+	default:
+	}
+
+	// Report previously skipped events before anything newer.
+	if q.skipped > 0 && len(q.events) < q.limit {
+		q.events = append(q.events, skippedEvent(q.skipped))
+		q.skipped = 0
+	}
+
+	if len(q.events) >= q.limit {
+		q.dropped++
+		if !q.slow {
+			q.slow = true
+			log.Printf("Client %s at %s is slow: outbound queue full (%d events), policy %s", q.id, q.peer, q.limit, q.policy)
+		}
+		switch q.policy {
+		case pbConfig.OverflowPolicy_OVERFLOW_DISCONNECT:
+			q.closeLocked(status.Errorf(codes.ResourceExhausted, "outbound queue full (%d events)", q.limit))
+			return
+		case pbConfig.OverflowPolicy_OVERFLOW_COALESCE:
+			q.skipped++
+			return
+		default:
+			q.events[0] = nil
+			q.events = q.events[1:]
+		}
+	}
+
+	q.events = append(q.events, ev)
+	if len(q.events) > q.maxDepth {
+		q.maxDepth = len(q.events)
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// skipThrough makes the sender drop queued events the history replay
+// already delivered. Must be called before run.
+func (q *clientQueue) skipThrough(replayed map[string]uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.floor = replayed
+}
+
+// run sends queued events to the stream until the queue is closed or a send fails.
+func (q *clientQueue) run() {
+	defer close(q.stopped)
+	for {
+		q.mu.Lock()
+		for len(q.events) == 0 && q.skipped == 0 {
+			q.mu.Unlock()
+			select {
+			case <-q.wake:
+			case <-q.done:
+				return
+			}
+			q.mu.Lock()
+		}
+
+		var ev *pbService.StreamEvent
+		if len(q.events) > 0 {
+			ev = q.events[0]
+			q.events[0] = nil
+			q.events = q.events[1:]
+		} else {
+			ev = skippedEvent(q.skipped)
+			q.skipped = 0
+		}
+		if len(q.events) == 0 && q.skipped == 0 {
+			q.slow = false
+		}
+		if id := history.EventID(ev); id != 0 && id <= q.floor[eventKey(ev)] {
+			q.mu.Unlock()
+			continue
+		}
+		q.mu.Unlock()
+
+		if err := q.stream.Send(ev); err != nil {
+			q.close(err)
+			return
+		}
+
+		q.mu.Lock()
+		q.sent++
+		q.mu.Unlock()
+	}
+}
+
+// close stops the sender. err is reported by Err; nil means a normal detach.
+func (q *clientQueue) close(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closeLocked(err)
+}
+
+func (q *clientQueue) closeLocked(err error) {
+	q.closeOnce.Do(func() {
+		q.err = err
+		close(q.done)
+	})
+}
+
+// wait blocks until run has returned, so nothing is sent on the stream
+// anymore. Only call it once run has been started.
+func (q *clientQueue) wait() {
+	<-q.stopped
+}
+
+// Done is closed once the queue has been shut down.
+func (q *clientQueue) Done() <-chan struct{} {
+	return q.done
+}
+
+func (q *clientQueue) Err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+func (q *clientQueue) logStats() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	log.Printf("Client %s at %s detached after %v: sent=%d dropped=%d max_depth=%d/%d err=%v", q.id, q.peer, time.Since(q.since).Round(time.Second), q.sent, q.dropped, q.maxDepth, q.limit, q.err)
+}
+
+// info describes the client for ListClients.
+func (q *clientQueue) info() *pbService.AttachedClient {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return &pbService.AttachedClient{
+		Identity:   q.id.String(),
+		Address:    q.peer,
+		Since:      timestamppb.New(q.since),
+		Sent:       q.sent,
+		Dropped:    q.dropped,
+		QueueDepth: int32(len(q.events)),
+	}
+}
+
+func skippedEvent(n int) *pbService.StreamEvent {
+	return systemEvent(&pbService.SystemMessage{
+		Timestamp: timestamppb.Now(),
+		Content:   fmt.Sprintf("%d messages skipped (client too slow)", n),
+	})
+}
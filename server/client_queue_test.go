@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+func msgEvent(content string) *pbService.StreamEvent {
+	return messageEvent(&pbService.IRCMessage{Content: content})
+}
+
+func TestClientQueue_DropOldest(t *testing.T) {
+	stream := NewMockStream(context.Background())
+	q := newClientQueue(stream, "test", 2, pbConfig.OverflowPolicy_OVERFLOW_DROP_OLDEST)
+
+	// Sender not running yet, so the queue fills up.
+	q.enqueue(msgEvent("a"))
+	q.enqueue(msgEvent("b"))
+	q.enqueue(msgEvent("c"))
+
+	go q.run()
+	defer q.close(nil)
+
+	sent := waitForSent(t, stream, 2)
+	if got := sent[0].GetMessage().GetContent() + sent[1].GetMessage().GetContent(); got != "bc" {
+		t.Errorf("Expected oldest event dropped (bc), got %s", got)
+	}
+	if q.dropped != 1 {
+		t.Errorf("Expected 1 dropped, got %d", q.dropped)
+	}
+}
+
+func TestClientQueue_SkipThrough(t *testing.T) {
+	stream := NewMockStream(context.Background())
+	q := newClientQueue(stream, "test", 10, pbConfig.OverflowPolicy_OVERFLOW_DROP_OLDEST)
+	// The replay sent the same channel up to different IDs on two networks.
+	q.skipThrough(map[string]uint64{"#test": 2, "libera/#test": 3})
+
+	for id := uint64(2); id <= 4; id++ {
+		q.enqueue(messageEvent(&pbService.IRCMessage{Id: id, Channel: "#test"}))
+		q.enqueue(messageEvent(&pbService.IRCMessage{Id: id, Network: "libera", Channel: "#test"}))
+	}
+	go q.run()
+	defer q.close(nil)
+
+	sent := waitForSent(t, stream, 3)
+	var got []string
+	for _, ev := range sent {
+		got = append(got, fmt.Sprintf("%s%d", ev.GetMessage().GetNetwork(), ev.GetMessage().GetId()))
+	}
+	if strings.Join(got, " ") != "3 4 libera4" {
+		t.Errorf("Expected 3 4 libera4, got %v", got)
+	}
+}
+
+func TestClientQueue_Disconnect(t *testing.T) {
+	stream := NewMockStream(context.Background())
+	q := newClientQueue(stream, "test", 1, pbConfig.OverflowPolicy_OVERFLOW_DISCONNECT)
+
+	q.enqueue(msgEvent("a"))
+	q.enqueue(msgEvent("b"))
+
+	select {
+	case <-q.Done():
+	default:
+		t.Fatal("Expected queue to be closed on overflow")
+	}
+	if status.Code(q.Err()) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted, got %v", q.Err())
+	}
+}
+
+func TestClientQueue_Coalesce(t *testing.T) {
+	stream := NewMockStream(context.Background())
+	q := newClientQueue(stream, "test", 2, pbConfig.OverflowPolicy_OVERFLOW_COALESCE)
+
+	for _, c := range []string{"a", "b", "c", "d", "e"} {
+		q.enqueue(msgEvent(c))
+	}
+
+	go q.run()
+	defer q.close(nil)
+
+	// a, b, then a notice covering c, d and e.
+	sent := waitForSent(t, stream, 3)
+	if sent[0].GetMessage().GetContent() != "a" || sent[1].GetMessage().GetContent() != "b" {
+		t.Errorf("Expected queued events a and b first, got %v", sent[:2])
+	}
+	notice := sent[2].GetSystemMessage().GetContent()
+	if !strings.HasPrefix(notice, "3 messages skipped") {
+		t.Errorf("Expected skip notice for 3 messages, got %q", notice)
+	}
+}
@@ -2,7 +2,17 @@ package main
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/morrowc/irc-bot/server/history"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -17,6 +27,7 @@ irc: {
 channels: {
   name: "#test"
   history_limit: 50
+  storage: HISTORY_DISK
 }
 service: {
   port: 1234
@@ -56,4 +67,87 @@ tls: {
 	if cfg.GetChannels()[0].GetName() != "#test" {
 		t.Errorf("Expected channel #test, got %s", cfg.GetChannels()[0].GetName())
 	}
+	if cfg.GetChannels()[0].GetStorage() != pbConfig.HistoryStorage_HISTORY_DISK {
+		t.Errorf("Expected HISTORY_DISK storage, got %s", cfg.GetChannels()[0].GetStorage())
+	}
+}
+
+func TestNewQueryStore(t *testing.T) {
+	cfg := &pbConfig.Config{
+		HistoryDir:        t.TempDir(),
+		QueryHistoryLimit: 2,
+		QueryStorage:      pbConfig.HistoryStorage_HISTORY_DISK,
+	}
+	store := newQueryStore(cfg, "", "alice")
+	defer store.Close()
+	if _, ok := store.(*history.FileStore); !ok {
+		t.Fatalf("Expected a disk store for the query, got %T", store)
+	}
+
+	for i := 0; i < 3; i++ {
+		store.Add(messageEvent(&pbService.IRCMessage{Channel: "alice", Timestamp: timestamppb.Now()}))
+	}
+	if evs := store.GetSince(time.Time{}); len(evs) != 2 {
+		t.Errorf("Expected the query limit of 2 to apply, got %d events", len(evs))
+	}
+
+	// Named networks keep their history apart.
+	other := newQueryStore(cfg, "libera", "alice")
+	defer other.Close()
+	if evs := other.GetSince(time.Time{}); len(evs) != 0 {
+		t.Errorf("Expected libera's alice to have no history, got %d events", len(evs))
+	}
+	if _, err := os.Stat(filepath.Join(cfg.HistoryDir, "libera", "_queries", "alice")); err != nil {
+		t.Errorf("Expected the history in a directory for libera: %v", err)
+	}
+}
+
+func TestHistoryPath(t *testing.T) {
+	tests := []struct {
+		network, name, want string
+	}{
+		{"", "#go-nuts", "history/_default/%23go-nuts"},
+		{"", "alice", "history/_default/_queries/alice"},
+		// A query for a nick named like a network stays out of its way.
+		{"", "libera", "history/_default/_queries/libera"},
+		{"libera", "#go-nuts", "history/libera/%23go-nuts"},
+		{"libera", "&local", "history/libera/&local"},
+		{"libera", "alice", "history/libera/_queries/alice"},
+	}
+	for _, tt := range tests {
+		if got := historyPath("history", tt.network, tt.name); got != filepath.FromSlash(tt.want) {
+			t.Errorf("historyPath(%q, %q) = %q, want %q", tt.network, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueryToEvict(t *testing.T) {
+	now := time.Now()
+	queries := map[string]time.Time{
+		"alice":        now.Add(-time.Minute),
+		"libera/bob":   now.Add(-time.Hour),
+		"libera/carol": now,
+	}
+	if got := queryToEvict(queries, 4); got != "" {
+		t.Errorf("Expected room for a fourth query, got %q to evict", got)
+	}
+	if got := queryToEvict(queries, 3); got != "libera/bob" {
+		t.Errorf("Expected the least recently used query to go, got %q", got)
+	}
+	if got := queryToEvict(queries, 0); got != "" {
+		t.Errorf("Expected the default of %d to leave room, got %q to evict", defaultMaxQueries, got)
+	}
+}
+
+func TestHashClientToken(t *testing.T) {
+	hash, err := hashClientToken(strings.NewReader("s3cret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte("s3cret")) != nil {
+		t.Errorf("Hash %q does not match the token", hash)
+	}
+	if _, err := hashClientToken(strings.NewReader("\n")); err == nil {
+		t.Error("Expected an error for an empty token")
+	}
 }
@@ -2,14 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"maps"
+	"math"
+	"net"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/morrowc/irc-bot/server/history"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	pbConfig "github.com/morrowc/irc-bot/proto/config"
 	pbService "github.com/morrowc/irc-bot/proto/service"
@@ -18,38 +25,106 @@ import (
 type IRCServiceServer struct {
 	pbService.UnimplementedIRCServiceServer
 	config  *pbConfig.Service
-	history map[string]*history.ChannelBuffer
-	// Active streams
-	streams sync.Map // map[pbService.IRCService_StreamMessagesServer]bool
-	bot     *IRCBot
+	history map[string]history.Store
+	// Attached clients: gRPC streams and IRC listener connections
+	streams sync.Map           // map[eventSink]*clientQueue
+	bots    map[string]*IRCBot // Network -> bot; replaced, not modified
+	clients *clientVerifier    // nil without TLS
 	mu      sync.RWMutex
+	// Send rate limits, per client identity or IP address
+	limitMu sync.Mutex
+	limits  map[string]*tokenBucket
+	// Hashes of client tokens that matched, and the names they belong to
+	authMu   sync.Mutex
+	verified map[[32]byte]string
 }
 
-func NewIRCServiceServer(cfg *pbConfig.Service, hist map[string]*history.ChannelBuffer) *IRCServiceServer {
+func NewIRCServiceServer(cfg *pbConfig.Service, hist map[string]history.Store) *IRCServiceServer {
 	return &IRCServiceServer{
-		config:  cfg,
-		history: hist,
+		config:   cfg,
+		history:  hist,
+		limits:   make(map[string]*tokenBucket),
+		verified: make(map[[32]byte]string),
 	}
 }
 
-func (s *IRCServiceServer) SetBot(bot *IRCBot) {
+// SetBot sets the bot of a network, or removes it if bot is nil. IRC clients
+// attached to the network's old bot are disconnected.
+func (s *IRCServiceServer) SetBot(network string, bot *IRCBot) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.bot = bot
+	bots := maps.Clone(s.bots)
+	if bots == nil {
+		bots = make(map[string]*IRCBot)
+	}
+	if bot == nil {
+		delete(bots, network)
+	} else {
+		bots[network] = bot
+	}
+	s.bots = bots
+	s.mu.Unlock()
+
+	s.streams.Range(func(key, value interface{}) bool {
+		if c, ok := key.(*ircConn); ok && c.network == network && c.bot != bot {
+			value.(*clientQueue).close(fmt.Errorf("network %q went away", network))
+		}
+		return true
+	})
 }
 
-func (s *IRCServiceServer) UpdateState(cfg *pbConfig.Service, hist map[string]*history.ChannelBuffer) {
+// bot returns the bot of a network, and an error for clients if there is none.
+func (s *IRCServiceServer) bot(network string) (*IRCBot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if bot := s.bots[network]; bot != nil {
+		return bot, nil
+	}
+	if len(s.bots) == 0 {
+		return nil, errNotConnected
+	}
+	return nil, fmt.Errorf("unknown network %q", network)
+}
+
+// SetClientVerifier sets the rules client certificates are checked by, and
+// disconnects attached clients whose certificate no longer passes them.
+func (s *IRCServiceServer) SetClientVerifier(v *clientVerifier) {
+	s.mu.Lock()
+	s.clients = v
+	s.mu.Unlock()
+
+	s.streams.Range(func(key, value interface{}) bool {
+		q := value.(*clientQueue)
+		if len(q.certs) == 0 {
+			return true
+		}
+		if _, err := v.verify(q.certs); err != nil {
+			log.Printf("Disconnecting client %s at %s: %v", q.id, q.peer, err)
+			q.close(status.Error(codes.Unauthenticated, err.Error()))
+		}
+		return true
+	})
+}
+
+func (s *IRCServiceServer) UpdateState(cfg *pbConfig.Service, hist map[string]history.Store) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.config = cfg
 	s.history = hist
+
+	// Tokens may have been revoked.
+	s.authMu.Lock()
+	clear(s.verified)
+	s.authMu.Unlock()
 }
 
-func (s *IRCServiceServer) StreamMessages(stream pbService.IRCService_StreamMessagesServer) error {
-	// Basic Auth Check (Ideally via Interceptor, but simplistic for now as per req)
-	// Client sends subscription request implementation.
-	// For now, let's assume the client sends the first message as a SubscribeRequest.
+// SetHistory replaces the history stores, e.g. when a query buffer is added.
+func (s *IRCServiceServer) SetHistory(hist map[string]history.Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = hist
+}
 
+func (s *IRCServiceServer) StreamMessages(stream pbService.IRCService_StreamMessagesServer) error {
 	// We need to wait for the first message from the client to know what they want
 	req, err := stream.Recv()
 	if err != nil {
@@ -60,48 +135,149 @@ func (s *IRCServiceServer) StreamMessages(stream pbService.IRCService_StreamMess
 	if subReq == nil {
 		return status.Error(codes.InvalidArgument, "First message must be SubscribeRequest")
 	}
+	// The client's token was checked by StreamAuth.
 
-	// TODO: Verify client_passkey if we add it to the Protocol or Metadata.
-	// The requirement says "storage of user passkey in plaintext in prototext config is acceptable".
-	// We should probably check metadata for passkey or add it to the SubscribeRequest.
-	// For this pass, I will assume metadata auth or just no auth for the very first step,
-	// but the plan said "Authenticate with a passkey".
-	// Let's add passkey to SubscribeRequest in proto or use metadata.
-	// Metadata is better. I'll stick to the plan of "passkey provided".
-
-	// Handle History
-	if subReq.GetGetHistory() {
-		s.mu.RLock()
-		histCopy := make(map[string]*history.ChannelBuffer)
-		for k, v := range s.history {
-			histCopy[k] = v
-		}
-		s.mu.RUnlock()
-
-		for _, buf := range histCopy {
-			msgs := buf.GetSince(time.Time{}) // Get all for now, or use a specific time if provided
-			for _, msg := range msgs {
-				if err := stream.Send(&pbService.StreamEvent{
-					Event: &pbService.StreamEvent_Message{Message: msg},
-				}); err != nil {
-					return err
-				}
-			}
-		}
-	}
+	// Register stream for live updates. Live events queue up while we replay
+	// history; the sender starts once the replay is done.
+	s.mu.RLock()
+	queueSize := int(s.config.GetClientQueueSize())
+	policy := s.config.GetOverflowPolicy()
+	s.mu.RUnlock()
+	q := newClientQueue(stream, peerAddr(stream.Context()), queueSize, policy)
+	q.id = clientFromContext(stream.Context())
+	q.certs = peerCerts(stream.Context())
+	log.Printf("Client %s attached", describeClient(stream.Context()))
 
-	// Register stream for live updates
 	s.mu.Lock()
-	s.streams.Store(stream, true)
+	s.streams.Store(stream, q)
 	s.mu.Unlock()
 
 	defer func() {
 		s.mu.Lock()
 		s.streams.Delete(stream)
 		s.mu.Unlock()
+		q.close(nil)
+		q.logStats()
 	}()
 
-	// Keep stream alive and handle incoming control messages
+	// Handle History
+	replayed, err := s.replayHistory(stream, subReq)
+	if err != nil {
+		return err
+	}
+	// Live events that raced with the replay may already have been sent.
+	q.skipThrough(replayed)
+
+	// Then where each channel stands now.
+	s.mu.RLock()
+	bots := s.bots
+	s.mu.RUnlock()
+	for _, network := range slices.Sorted(maps.Keys(bots)) {
+		bot := bots[network]
+		for _, st := range bot.ChannelStates() {
+			if err := stream.Send(channelStateEvent(st)); err != nil {
+				return err
+			}
+		}
+		if st := bot.SendQueueStatus(); st.GetDepth() > 0 {
+			if err := stream.Send(sendQueueEvent(st)); err != nil {
+				return err
+			}
+		}
+		if msg := bot.nickMessage(); msg != nil {
+			if err := stream.Send(systemEvent(msg)); err != nil {
+				return err
+			}
+		}
+	}
+
+	go q.run()
+
+	// Handle incoming control messages until the client goes away or the
+	// queue gives up on it.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.handleRequests(stream, q)
+	}()
+
+	select {
+	case err = <-errc:
+	case <-q.Done():
+		err = q.Err()
+	}
+	// The sender may still be in the middle of a Send, and the stream must
+	// not be used once we return.
+	q.close(nil)
+	q.wait()
+	return err
+}
+
+// replayHistory sends the history a new subscriber asked for. Channels in
+// last_seen resume right after the client's newest message; other channels get
+// their backlog if get_history is set. It returns the newest ID sent per channel.
+func (s *IRCServiceServer) replayHistory(stream pbService.IRCService_StreamMessagesServer, subReq *pbService.SubscribeRequest) (map[string]uint64, error) {
+	s.mu.RLock()
+	histCopy := make(map[string]history.Store)
+	for k, v := range s.history {
+		histCopy[k] = v
+	}
+	s.mu.RUnlock()
+
+	// Clients may name a query with the nick as it was spelled.
+	lastSeenByKey := make(map[string]uint64)
+	for key, id := range subReq.GetLastSeen() {
+		lastSeenByKey[historyKey(splitHistoryKey(key))] = id
+	}
+
+	replayed := make(map[string]uint64)
+	for name, buf := range histCopy {
+		var evs []*pbService.StreamEvent
+		if lastSeen, ok := lastSeenByKey[name]; ok {
+			var gap *pbService.SystemMessage
+			evs, gap = resumeFrom(name, buf, lastSeen)
+			if gap != nil {
+				if err := stream.Send(systemEvent(gap)); err != nil {
+					return nil, err
+				}
+			}
+		} else if subReq.GetGetHistory() {
+			if n := int(subReq.GetHistoryLimit()); n > 0 {
+				evs, _ = buf.Page(0, n, false)
+			} else {
+				evs = buf.GetSince(time.Time{})
+			}
+		}
+
+		for _, ev := range evs {
+			if err := stream.Send(ev); err != nil {
+				return nil, err
+			}
+			replayed[name] = history.EventID(ev)
+		}
+	}
+	return replayed, nil
+}
+
+// resumeFrom returns the events of a channel after lastSeen, and a notice if
+// some of the events the client missed are no longer in the buffer.
+func resumeFrom(key string, buf history.Store, lastSeen uint64) ([]*pbService.StreamEvent, *pbService.SystemMessage) {
+	evs, _ := buf.Page(lastSeen, math.MaxInt32, true)
+	oldest, _ := buf.Page(0, 1, true)
+	if len(oldest) == 0 || history.EventID(oldest[0]) <= lastSeen+1 {
+		return evs, nil
+	}
+	network, channel := splitHistoryKey(key)
+	return evs, &pbService.SystemMessage{
+		Timestamp: timestamppb.New(history.EventTime(oldest[0])),
+		Channel:   channel,
+		Network:   network,
+		Content:   fmt.Sprintf("Some messages in %s were missed: history no longer goes back to your last seen message", key),
+	}
+}
+
+// handleRequests processes control messages sent by the client after
+// subscribing. Replies go out through the client's queue q.
+func (s *IRCServiceServer) handleRequests(stream pbService.IRCService_StreamMessagesServer, q *clientQueue) error {
 	for {
 		req, err := stream.Recv()
 		if err != nil {
@@ -109,8 +285,13 @@ func (s *IRCServiceServer) StreamMessages(stream pbService.IRCService_StreamMess
 		}
 
 		if msgReq, ok := req.Request.(*pbService.StreamRequest_SendMessage); ok {
-			if s.bot != nil {
-				s.bot.Send(msgReq.SendMessage.GetChannel(), msgReq.SendMessage.GetMessage())
+			// Acknowledged once the lines are in history, or can't be.
+			send := msgReq.SendMessage
+			_, err := s.send(limitKey(q.id, q.peer), send, func(lines []*pbService.IRCMessage, err error) {
+				q.enqueue(sendAckEvent(sendResponse(send, lines, err)))
+			})
+			if err != nil {
+				q.enqueue(sendAckEvent(sendResponse(send, nil, err)))
 			}
 		} else if quitReq, ok := req.Request.(*pbService.StreamRequest_Quit); ok {
 			if quitReq.Quit.GetShutdownServer() {
@@ -137,22 +318,208 @@ func (s *IRCServiceServer) StreamMessages(stream pbService.IRCService_StreamMess
 	}
 }
 
-func (s *IRCServiceServer) Broadcast(msg *pbService.IRCMessage) {
+// Broadcast queues ev for every attached client. It never blocks on a client.
+func (s *IRCServiceServer) Broadcast(ev *pbService.StreamEvent) {
 	s.streams.Range(func(key, value interface{}) bool {
-		stream := key.(pbService.IRCService_StreamMessagesServer)
-		// Best effort send. If it blocks/fails, simplistic handling for now.
-		// In production, we'd use a per-client queue to avoid blocking the broadcaster.
-		if err := stream.Send(&pbService.StreamEvent{
-			Event: &pbService.StreamEvent_Message{Message: msg},
-		}); err != nil {
-			log.Printf("Failed to send to client: %v", err)
-			// Maybe remove client?
-		}
+		value.(*clientQueue).enqueue(ev)
 		return true
 	})
 }
 
+// SendMessage sends a line to a channel or nick, and returns once it is in
+// history. A message that can't be sent is reported in the response rather
+// than as an RPC error.
 func (s *IRCServiceServer) SendMessage(ctx context.Context, req *pbService.SendMessageRequest) (*pbService.SendMessageResponse, error) {
-	// TODO: Implement sending to IRC via a channel or callback to the bot
-	return &pbService.SendMessageResponse{Success: false, Error: "Not implemented"}, nil
+	acked := make(chan *pbService.SendMessageResponse, 1)
+	_, err := s.send(limitKey(clientFromContext(ctx), peerAddr(ctx)), req, func(lines []*pbService.IRCMessage, err error) {
+		acked <- sendResponse(req, lines, err)
+	})
+	if err != nil {
+		return sendResponse(req, nil, err), nil
+	}
+	select {
+	case resp := <-acked:
+		return resp, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// send hands req to the bot, returning the lines it is sent as. The send
+// comes out of the allowance named by limit. sent is passed on to
+// IRCBot.Send, and not called if the send fails here.
+func (s *IRCServiceServer) send(limit string, req *pbService.SendMessageRequest, sent func([]*pbService.IRCMessage, error)) ([]*pbService.IRCMessage, error) {
+	if wait := s.rateLimit(limit); wait > 0 {
+		return nil, fmt.Errorf("rate limited: try again in %v", wait.Round(100*time.Millisecond))
+	}
+	bot, err := s.bot(req.GetNetwork())
+	if err != nil {
+		return nil, err
+	}
+	lines, err := bot.Send(req.GetChannel(), req.GetMessage(), req.GetKind(), sent)
+	if err != nil {
+		log.Printf("Failed to send to %s: %v", historyKey(req.GetNetwork(), req.GetChannel()), err)
+		return nil, err
+	}
+	return lines, nil
+}
+
+// sendResponse answers req, which was sent as lines, or failed with err.
+// Lines carry the IDs history gave them.
+func sendResponse(req *pbService.SendMessageRequest, lines []*pbService.IRCMessage, err error) *pbService.SendMessageResponse {
+	resp := &pbService.SendMessageResponse{RequestId: req.GetRequestId(), Success: err == nil}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	for _, line := range lines {
+		if line.GetId() != 0 {
+			resp.LineIds = append(resp.LineIds, line.GetId())
+		}
+	}
+	if len(resp.LineIds) > 0 {
+		resp.MessageId = resp.LineIds[0]
+	}
+	return resp
+}
+
+// limitKey names the send allowance of a client: the identity it
+// authenticated as, so that reconnecting doesn't renew it, or else its IP
+// address.
+func limitKey(id clientIdentity, addr string) string {
+	if id != (clientIdentity{}) {
+		return "client " + id.String()
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// rateLimit takes a send out of the allowance named by key. It returns how
+// long the client has to wait if it has none left.
+func (s *IRCServiceServer) rateLimit(key string) time.Duration {
+	s.mu.RLock()
+	rate := s.config.GetClientSendRate()
+	burst := int(s.config.GetClientSendBurst())
+	s.mu.RUnlock()
+	if rate <= 0 {
+		rate = 1
+	}
+	if burst <= 0 {
+		burst = 10
+	}
+
+	s.limitMu.Lock()
+	defer s.limitMu.Unlock()
+	now := time.Now()
+	tb := s.limits[key]
+	if tb == nil || tb.rate != rate || tb.burst != float64(burst) {
+		// Forget clients that haven't sent anything for a while.
+		for p, other := range s.limits {
+			if other.full(now) {
+				delete(s.limits, p)
+			}
+		}
+		tb = newTokenBucket(rate, burst)
+		s.limits[key] = tb
+	}
+	if ok, wait := tb.take(now); !ok {
+		return wait
+	}
+	return 0
+}
+
+// ListClients lists the attached clients, oldest first.
+func (s *IRCServiceServer) ListClients(ctx context.Context, req *pbService.ListClientsRequest) (*pbService.ListClientsResponse, error) {
+	var clients []*pbService.AttachedClient
+	s.streams.Range(func(key, value interface{}) bool {
+		clients = append(clients, value.(*clientQueue).info())
+		return true
+	})
+	slices.SortFunc(clients, func(a, b *pbService.AttachedClient) int {
+		return a.GetSince().AsTime().Compare(b.GetSince().AsTime())
+	})
+	return &pbService.ListClientsResponse{Clients: clients}, nil
+}
+
+const (
+	defaultHistoryPage = 50
+	maxHistoryPage     = 500
+)
+
+// GetHistory returns a page of a channel's history relative to a message ID.
+func (s *IRCServiceServer) GetHistory(ctx context.Context, req *pbService.GetHistoryRequest) (*pbService.GetHistoryResponse, error) {
+	s.mu.RLock()
+	buf := s.history[historyKey(req.GetNetwork(), req.GetChannel())]
+	s.mu.RUnlock()
+	if buf == nil {
+		return nil, status.Errorf(codes.NotFound, "no history for %q", historyKey(req.GetNetwork(), req.GetChannel()))
+	}
+
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultHistoryPage
+	}
+	if limit > maxHistoryPage {
+		limit = maxHistoryPage
+	}
+
+	forward := req.GetDirection() == pbService.GetHistoryRequest_FORWARD
+	evs, more := buf.Page(req.GetCursor(), limit, forward)
+	resp := &pbService.GetHistoryResponse{Events: evs, HasMore: more}
+	for _, ev := range evs {
+		if msg := ev.GetMessage(); msg != nil {
+			resp.Messages = append(resp.Messages, msg)
+		}
+	}
+	return resp, nil
+}
+
+// GetChannelState returns the current state of a channel the bot is in.
+func (s *IRCServiceServer) GetChannelState(ctx context.Context, req *pbService.GetChannelStateRequest) (*pbService.ChannelState, error) {
+	bot, err := s.bot(req.GetNetwork())
+	if err == errNotConnected {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	st := bot.ChannelState(req.GetChannel())
+	if st == nil {
+		return nil, status.Errorf(codes.NotFound, "not in channel %q", req.GetChannel())
+	}
+	return st, nil
+}
+
+func messageEvent(msg *pbService.IRCMessage) *pbService.StreamEvent {
+	return &pbService.StreamEvent{Event: &pbService.StreamEvent_Message{Message: msg}}
+}
+
+func systemEvent(msg *pbService.SystemMessage) *pbService.StreamEvent {
+	return &pbService.StreamEvent{Event: &pbService.StreamEvent_SystemMessage{SystemMessage: msg}}
+}
+
+func channelEvent(ce *pbService.ChannelEvent) *pbService.StreamEvent {
+	return &pbService.StreamEvent{Event: &pbService.StreamEvent_ChannelEvent{ChannelEvent: ce}}
+}
+
+func channelStateEvent(st *pbService.ChannelState) *pbService.StreamEvent {
+	return &pbService.StreamEvent{Event: &pbService.StreamEvent_ChannelState{ChannelState: st}}
+}
+
+func sendAckEvent(resp *pbService.SendMessageResponse) *pbService.StreamEvent {
+	return &pbService.StreamEvent{Event: &pbService.StreamEvent_SendAck{SendAck: resp}}
+}
+
+func sendQueueEvent(st *pbService.SendQueueStatus) *pbService.StreamEvent {
+	return &pbService.StreamEvent{Event: &pbService.StreamEvent_SendQueue{SendQueue: st}}
+}
+
+// peerAddr returns the remote address of a stream, for logging.
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return "unknown"
 }
@@ -2,12 +2,24 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io"
+	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/lrstanley/girc"
 	"github.com/morrowc/irc-bot/server/history"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	pbConfig "github.com/morrowc/irc-bot/proto/config"
@@ -19,6 +31,7 @@ type MockStream struct {
 	grpc.ServerStream
 	ctx       context.Context
 	recvChan  chan *pbService.StreamRequest
+	mu        sync.Mutex
 	sentMsgs  []*pbService.StreamEvent
 	closeChan chan struct{}
 }
@@ -37,10 +50,34 @@ func (m *MockStream) Context() context.Context {
 }
 
 func (m *MockStream) Send(msg *pbService.StreamEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.sentMsgs = append(m.sentMsgs, msg)
 	return nil
 }
 
+// Sent returns a copy of the events sent so far.
+func (m *MockStream) Sent() []*pbService.StreamEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*pbService.StreamEvent(nil), m.sentMsgs...)
+}
+
+// waitForSent polls until the stream has sent at least n events.
+func waitForSent(t *testing.T, m *MockStream, n int) []*pbService.StreamEvent {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if sent := m.Sent(); len(sent) >= n {
+			return sent
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	sent := m.Sent()
+	t.Fatalf("Expected %d sent events, got %d", n, len(sent))
+	return sent
+}
+
 func (m *MockStream) Recv() (*pbService.StreamRequest, error) {
 	select {
 	case msg := <-m.recvChan:
@@ -54,13 +91,13 @@ func (m *MockStream) Recv() (*pbService.StreamRequest, error) {
 
 func TestStreamMessages_History(t *testing.T) {
 	// Setup
-	hist := make(map[string]*history.ChannelBuffer)
+	hist := make(map[string]history.Store)
 	cb := history.NewChannelBuffer(10)
-	cb.Add(&pbService.IRCMessage{
+	cb.Add(messageEvent(&pbService.IRCMessage{
 		Content:   "historical_msg",
 		Timestamp: timestamppb.Now(),
 		Channel:   "#test",
-	})
+	}))
 	hist["#test"] = cb
 
 	cfg := &pbConfig.Service{Port: 1234}
@@ -90,12 +127,13 @@ func TestStreamMessages_History(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Check if history was sent
-	if len(stream.sentMsgs) == 0 {
+	sent := stream.Sent()
+	if len(sent) == 0 {
 		t.Fatal("Expected history messages, got none")
 	}
 
 	found := false
-	for _, event := range stream.sentMsgs {
+	for _, event := range sent {
 		if msg := event.GetMessage(); msg != nil {
 			if msg.Content == "historical_msg" {
 				found = true
@@ -113,7 +151,7 @@ func TestStreamMessages_History(t *testing.T) {
 
 func TestBroadcast(t *testing.T) {
 	// Setup
-	hist := make(map[string]*history.ChannelBuffer)
+	hist := make(map[string]history.Store)
 	srv := NewIRCServiceServer(&pbConfig.Service{}, hist)
 
 	// Mock Stream
@@ -122,34 +160,405 @@ func TestBroadcast(t *testing.T) {
 	stream := NewMockStream(ctx)
 
 	// Manually register stream (since StreamMessages blocks, we simulate registration)
+	q := newClientQueue(stream, "test", 10, pbConfig.OverflowPolicy_OVERFLOW_DROP_OLDEST)
 	srv.mu.Lock()
-	srv.streams.Store(stream, true)
+	srv.streams.Store(stream, q)
 	srv.mu.Unlock()
+	go q.run()
+	defer q.close(nil)
 
 	// Broadcast
 	msg := &pbService.IRCMessage{Content: "live_msg"}
-	srv.Broadcast(msg)
+	srv.Broadcast(messageEvent(msg))
 
 	// Check receipt
-	if len(stream.sentMsgs) != 1 {
-		t.Errorf("Expected 1 broadcast message, got %d", len(stream.sentMsgs))
+	sent := waitForSent(t, stream, 1)
+	if len(sent) != 1 {
+		t.Errorf("Expected 1 broadcast message, got %d", len(sent))
 	} else {
-		if stream.sentMsgs[0].GetMessage().GetContent() != "live_msg" {
-			t.Errorf("Expected content 'live_msg', got %s", stream.sentMsgs[0].GetMessage().GetContent())
+		if sent[0].GetMessage().GetContent() != "live_msg" {
+			t.Errorf("Expected content 'live_msg', got %s", sent[0].GetMessage().GetContent())
 		}
 	}
 }
 
+// blockingStream holds every Send until it is released.
+type blockingStream struct {
+	*MockStream
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStream) Send(ev *pbService.StreamEvent) error {
+	s.entered <- struct{}{}
+	<-s.release
+	return s.MockStream.Send(ev)
+}
+
+func TestStreamMessages_WaitsForSender(t *testing.T) {
+	srv := NewIRCServiceServer(&pbConfig.Service{}, map[string]history.Store{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &blockingStream{MockStream: NewMockStream(ctx), entered: make(chan struct{}), release: make(chan struct{})}
+	stream.recvChan <- &pbService.StreamRequest{
+		Request: &pbService.StreamRequest_Subscribe{Subscribe: &pbService.SubscribeRequest{}},
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.StreamMessages(stream)
+	}()
+	for registered := false; !registered; time.Sleep(5 * time.Millisecond) {
+		srv.streams.Range(func(key, value interface{}) bool {
+			registered = true
+			return false
+		})
+	}
+
+	// The sender is stuck in Send when the client goes away.
+	srv.Broadcast(messageEvent(&pbService.IRCMessage{Content: "live_msg"}))
+	<-stream.entered
+	close(stream.closeChan)
+	select {
+	case <-errChan:
+		t.Fatal("Expected StreamMessages to wait for the sender")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(stream.release)
+	select {
+	case <-errChan:
+	case <-time.After(time.Second):
+		t.Fatal("Expected StreamMessages to return once the sender is done")
+	}
+}
+
 func TestSendMessage(t *testing.T) {
-	srv := NewIRCServiceServer(nil, nil)
-	resp, err := srv.SendMessage(context.Background(), &pbService.SendMessageRequest{})
+	srv := NewIRCServiceServer(&pbConfig.Service{}, map[string]history.Store{})
+	resp, err := srv.SendMessage(context.Background(), &pbService.SendMessageRequest{Channel: "#test", Message: "hi", RequestId: "r1"})
 	if err != nil {
 		t.Fatalf("SendMessage returned error: %v", err)
 	}
-	if resp.Success {
-		t.Error("Expected Success to be false")
+	if resp.GetSuccess() || resp.GetError() != errNotConnected.Error() || resp.GetRequestId() != "r1" {
+		t.Errorf("Expected a not connected failure for r1, got %v", resp)
+	}
+
+	// Failures are reported in the response, not as RPC errors.
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{Nick: "testbot"}, nil, func(string) history.Store { return nil }, srv.Broadcast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetBot("", bot)
+	resp, err = srv.SendMessage(context.Background(), &pbService.SendMessageRequest{Channel: "#test", Message: "hi"})
+	if err != nil || resp.GetSuccess() || resp.GetError() == "" {
+		t.Errorf("Expected a failed send, got %v (err %v)", resp, err)
+	}
+
+	// On the stream, the ack carries the request ID.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := NewMockStream(ctx)
+	stream.recvChan <- &pbService.StreamRequest{
+		Request: &pbService.StreamRequest_Subscribe{Subscribe: &pbService.SubscribeRequest{}},
+	}
+	stream.recvChan <- &pbService.StreamRequest{
+		Request: &pbService.StreamRequest_SendMessage{SendMessage: &pbService.SendMessageRequest{Channel: "#test", Message: "hi", RequestId: "r2"}},
+	}
+	go srv.StreamMessages(stream)
+	sent := waitForSent(t, stream, 1)
+	if ack := sent[0].GetSendAck(); ack.GetRequestId() != "r2" || ack.GetSuccess() {
+		t.Errorf("Expected a failed ack for r2, got %v", sent[0])
+	}
+}
+
+func TestSendMessage_Networks(t *testing.T) {
+	srv := NewIRCServiceServer(&pbConfig.Service{}, map[string]history.Store{})
+	for _, name := range []string{"", "libera"} {
+		bot, err := NewIRCBot(name, &pbConfig.IRCServer{Nick: "testbot"}, nil, func(string) history.Store { return nil }, srv.Broadcast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv.SetBot(name, bot)
+	}
+
+	// Known networks get as far as the bot, which isn't connected.
+	for _, network := range []string{"", "libera"} {
+		if _, err := srv.send("client", &pbService.SendMessageRequest{Network: network, Channel: "#test", Message: "hi"}, nil); err != errNotConnected {
+			t.Errorf("Network %q: expected %q, got %v", network, errNotConnected, err)
+		}
+	}
+	if _, err := srv.send("client", &pbService.SendMessageRequest{Network: "oftc", Channel: "#test", Message: "hi"}, nil); !strings.Contains(fmt.Sprint(err), "unknown network") {
+		t.Errorf("Expected an unknown network error, got %v", err)
+	}
+	if _, err := srv.GetChannelState(context.Background(), &pbService.GetChannelStateRequest{Network: "oftc", Channel: "#test"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for an unknown network, got %v", err)
+	}
+
+	srv.SetBot("libera", nil)
+	if _, err := srv.send("client", &pbService.SendMessageRequest{Network: "libera", Channel: "#test", Message: "hi"}, nil); !strings.Contains(fmt.Sprint(err), "unknown network") {
+		t.Errorf("Expected libera to be gone, got %v", err)
+	}
+}
+
+func TestSendMessage_RateLimit(t *testing.T) {
+	srv := NewIRCServiceServer(&pbConfig.Service{ClientSendBurst: 2, ClientSendRate: 0.01}, map[string]history.Store{})
+	for i := 0; i < 2; i++ {
+		if _, err := srv.send("client1", &pbService.SendMessageRequest{}, nil); strings.Contains(fmt.Sprint(err), "rate limited") {
+			t.Fatalf("Send %d: unexpected %v", i, err)
+		}
+	}
+	if _, err := srv.send("client1", &pbService.SendMessageRequest{}, nil); !strings.Contains(fmt.Sprint(err), "rate limited") {
+		t.Errorf("Expected the third send to be rate limited, got %v", err)
+	}
+	// Each client has its own allowance.
+	if _, err := srv.send("client2", &pbService.SendMessageRequest{}, nil); strings.Contains(fmt.Sprint(err), "rate limited") {
+		t.Errorf("Expected another client not to be limited, got %v", err)
+	}
+}
+
+func TestLimitKey(t *testing.T) {
+	tests := []struct {
+		id   clientIdentity
+		addr string
+		want string
+	}{
+		// Authenticated clients keep their allowance across connections.
+		{clientIdentity{token: "laptop"}, "192.0.2.1:40000", "client laptop"},
+		{clientIdentity{cert: "phone"}, "192.0.2.1:40001", "client phone"},
+		// Others share one per IP address.
+		{clientIdentity{}, "192.0.2.1:40002", "192.0.2.1"},
+		{clientIdentity{}, "[2001:db8::1]:40003", "2001:db8::1"},
+		{clientIdentity{}, "unknown", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := limitKey(tt.id, tt.addr); got != tt.want {
+			t.Errorf("limitKey(%v, %q) = %q, want %q", tt.id, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestListClients(t *testing.T) {
+	srv := NewIRCServiceServer(&pbConfig.Service{}, map[string]history.Store{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := NewMockStream(context.WithValue(ctx, clientIdentityKey{}, clientIdentity{cert: "laptop"}))
+	stream.recvChan <- &pbService.StreamRequest{
+		Request: &pbService.StreamRequest_Subscribe{Subscribe: &pbService.SubscribeRequest{}},
+	}
+	go srv.StreamMessages(stream)
+
+	var clients []*pbService.AttachedClient
+	for deadline := time.Now().Add(time.Second); len(clients) == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		resp, err := srv.ListClients(context.Background(), &pbService.ListClientsRequest{})
+		if err != nil {
+			t.Fatalf("ListClients failed: %v", err)
+		}
+		clients = resp.GetClients()
+	}
+	if len(clients) != 1 || clients[0].GetIdentity() != "laptop" || clients[0].GetAddress() != "unknown" {
+		t.Errorf("Expected the attached laptop, got %v", clients)
+	}
+	close(stream.closeChan)
+}
+
+func TestSetClientVerifier(t *testing.T) {
+	ca := newTestCA(t)
+	laptop, _, _, _ := ca.issue(t, "laptop", 2)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	srv := NewIRCServiceServer(&pbConfig.Service{}, map[string]history.Store{})
+	srv.SetClientVerifier(&clientVerifier{roots: roots})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = peer.NewContext(ctx, &peer.Peer{
+		Addr:     &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4000},
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{laptop}}},
+	})
+	stream := NewMockStream(ctx)
+	stream.recvChan <- &pbService.StreamRequest{
+		Request: &pbService.StreamRequest_Subscribe{Subscribe: &pbService.SubscribeRequest{}},
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.StreamMessages(stream) }()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp, _ := srv.ListClients(context.Background(), &pbService.ListClientsRequest{})
+		if len(resp.GetClients()) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Client never attached")
+		}
+	}
+
+	// Reloading with the same rules keeps the client; revoking its
+	// certificate disconnects it.
+	srv.SetClientVerifier(&clientVerifier{roots: roots})
+	select {
+	case err := <-errc:
+		t.Fatalf("Client was disconnected: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	sum := sha256.Sum256(laptop.Raw)
+	srv.SetClientVerifier(&clientVerifier{roots: roots, revoked: [][]byte{sum[:]}})
+	select {
+	case err := <-errc:
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Expected Unauthenticated, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Revoked client was not disconnected")
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	cb := history.NewChannelBuffer(10)
+	for i := 0; i < 5; i++ {
+		cb.Add(messageEvent(&pbService.IRCMessage{Channel: "#test", Timestamp: timestamppb.Now()}))
+	}
+	srv := NewIRCServiceServer(&pbConfig.Service{}, map[string]history.Store{"#test": cb})
+	all := cb.GetSince(time.Time{})
+
+	resp, err := srv.GetHistory(context.Background(), &pbService.GetHistoryRequest{
+		Channel: "#test",
+		Cursor:  history.EventID(all[3]),
+		Limit:   2,
+	})
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(resp.GetMessages()) != 2 || resp.GetMessages()[0].GetId() != history.EventID(all[1]) || !resp.GetHasMore() {
+		t.Errorf("Expected messages 1..2 with more, got %v (more=%v)", resp.GetMessages(), resp.GetHasMore())
+	}
+	if len(resp.GetEvents()) != 2 || history.EventID(resp.GetEvents()[1]) != history.EventID(all[2]) {
+		t.Errorf("Expected events 1..2, got %v", resp.GetEvents())
+	}
+
+	if _, err := srv.GetHistory(context.Background(), &pbService.GetHistoryRequest{Channel: "#nope"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for unknown channel, got %v", err)
+	}
+
+	// Channels of named networks are kept under network/channel.
+	srv.SetHistory(map[string]history.Store{"libera/#test": cb})
+	if resp, err := srv.GetHistory(context.Background(), &pbService.GetHistoryRequest{Network: "libera", Channel: "#test"}); err != nil || len(resp.GetEvents()) != 5 {
+		t.Errorf("Expected libera's #test, got %v (err %v)", resp, err)
+	}
+	if _, err := srv.GetHistory(context.Background(), &pbService.GetHistoryRequest{Channel: "#test"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for #test of the unnamed network, got %v", err)
+	}
+}
+
+func TestStreamMessages_Resume(t *testing.T) {
+	cb := history.NewChannelBuffer(3)
+	for i := 0; i < 6; i++ {
+		cb.Add(messageEvent(&pbService.IRCMessage{Channel: "#test", Timestamp: timestamppb.Now()}))
+	}
+	retained := cb.GetSince(time.Time{})
+	srv := NewIRCServiceServer(&pbConfig.Service{}, map[string]history.Store{"#test": cb})
+
+	tests := []struct {
+		desc     string
+		lastSeen uint64
+		wantGap  bool
+		wantMsgs int
+	}{
+		{"caught up", history.EventID(retained[2]), false, 0},
+		{"within buffer", history.EventID(retained[0]), false, 2},
+		{"just before buffer", history.EventID(retained[0]) - 1, false, 3},
+		{"buffer rolled past", history.EventID(retained[0]) - 2, true, 3},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream := NewMockStream(ctx)
+		stream.recvChan <- &pbService.StreamRequest{
+			Request: &pbService.StreamRequest_Subscribe{
+				Subscribe: &pbService.SubscribeRequest{
+					GetHistory: true,
+					LastSeen:   map[string]uint64{"#test": tt.lastSeen},
+				},
+			},
+		}
+		go srv.StreamMessages(stream)
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+
+		var gap bool
+		var msgs []*pbService.IRCMessage
+		for _, ev := range stream.Sent() {
+			if ev.GetSystemMessage() != nil {
+				gap = true
+			}
+			if m := ev.GetMessage(); m != nil {
+				msgs = append(msgs, m)
+			}
+		}
+		if gap != tt.wantGap {
+			t.Errorf("%s: gap notice = %v, want %v", tt.desc, gap, tt.wantGap)
+		}
+		if len(msgs) != tt.wantMsgs {
+			t.Errorf("%s: got %d messages, want %d", tt.desc, len(msgs), tt.wantMsgs)
+		}
+		for _, m := range msgs {
+			if m.GetId() <= tt.lastSeen {
+				t.Errorf("%s: replayed already seen message %d", tt.desc, m.GetId())
+			}
+		}
+	}
+
+	// A query resumes whichever way the client spells the nick.
+	srv.SetHistory(map[string]history.Store{"libera/alice": cb})
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := NewMockStream(ctx)
+	stream.recvChan <- &pbService.StreamRequest{
+		Request: &pbService.StreamRequest_Subscribe{
+			Subscribe: &pbService.SubscribeRequest{
+				GetHistory: true,
+				LastSeen:   map[string]uint64{"libera/Alice": history.EventID(retained[2])},
+			},
+		},
+	}
+	go srv.StreamMessages(stream)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	for _, ev := range stream.Sent() {
+		if ev.GetMessage() != nil {
+			t.Errorf("Expected libera/Alice to resume libera/alice, got %v replayed", ev)
+		}
+	}
+}
+
+func TestGetChannelState(t *testing.T) {
+	srv := NewIRCServiceServer(&pbConfig.Service{}, map[string]history.Store{})
+	if _, err := srv.GetChannelState(context.Background(), &pbService.GetChannelStateRequest{Channel: "#test"}); status.Code(err) != codes.Unavailable {
+		t.Errorf("Expected Unavailable without a bot, got %v", err)
+	}
+
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{Nick: "testbot"}, nil, func(string) history.Store { return nil }, srv.Broadcast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.handleJoin(bot.client, girc.Event{Source: &girc.Source{Name: "testbot"}, Params: []string{"#test"}})
+	bot.handleTopicReply(bot.client, girc.Event{Params: []string{"testbot", "#test", "hello"}})
+	srv.SetBot("", bot)
+
+	st, err := srv.GetChannelState(context.Background(), &pbService.GetChannelStateRequest{Channel: "#test"})
+	if err != nil || st.GetTopic() != "hello" || len(st.GetMembers()) != 1 {
+		t.Errorf("Expected #test state, got %v (err %v)", st, err)
+	}
+	if _, err := srv.GetChannelState(context.Background(), &pbService.GetChannelStateRequest{Channel: "#nope"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+
+	// Subscribers get a snapshot of each channel.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := NewMockStream(ctx)
+	stream.recvChan <- &pbService.StreamRequest{
+		Request: &pbService.StreamRequest_Subscribe{Subscribe: &pbService.SubscribeRequest{}},
 	}
-	if resp.Error != "Not implemented" {
-		t.Errorf("Expected 'Not implemented', got '%s'", resp.Error)
+	go srv.StreamMessages(stream)
+	sent := waitForSent(t, stream, 1)
+	if sent[0].GetChannelState().GetTopic() != "hello" {
+		t.Errorf("Expected a channel state snapshot, got %v", sent[0])
 	}
 }
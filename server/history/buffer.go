@@ -1,17 +1,39 @@
 package history
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	pb "github.com/morrowc/irc-bot/proto/service"
 )
 
-// ChannelBuffer manages history for a single channel.
+// Store is the history of a single channel. It holds the channel's messages
+// and channel events, as the StreamEvents that are sent to clients.
+type Store interface {
+	// Add appends an event, dropping old ones if the store is full.
+	Add(ev *pb.StreamEvent) error
+	// GetSince returns all retained events newer than the given timestamp.
+	GetSince(since time.Time) []*pb.StreamEvent
+	// Page returns up to limit events before (or, if forward, after) the
+	// event with ID cursor, oldest first. A zero cursor starts from the
+	// newest (or oldest) end. more reports whether the page was cut short.
+	Page(cursor uint64, limit int, forward bool) (events []*pb.StreamEvent, more bool)
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// ChannelBuffer manages history for a single channel in memory.
+// Events are assigned increasing IDs as they are added. IDs start from the
+// current time in microseconds, so they keep increasing across restarts even
+// though the buffer itself is lost, and a client holding an ID from before
+// the restart never mistakes new events for ones it has seen.
 type ChannelBuffer struct {
-	mu       sync.RWMutex
-	messages []*pb.IRCMessage
-	limit    int
+	mu     sync.RWMutex
+	events []*pb.StreamEvent
+	limit  int
+	lastID uint64
 }
 
 // NewChannelBuffer creates a new buffer with the given limit.
@@ -20,37 +42,141 @@ func NewChannelBuffer(limit int) *ChannelBuffer {
 		limit = 0
 	}
 	return &ChannelBuffer{
-		messages: make([]*pb.IRCMessage, 0, limit),
-		limit:    limit,
+		events: make([]*pb.StreamEvent, 0, limit),
+		limit:  limit,
+		lastID: uint64(time.Now().UnixMicro()),
 	}
 }
 
-// Add appends a message to the buffer, dropping old ones if limit is reached.
-func (cb *ChannelBuffer) Add(msg *pb.IRCMessage) {
+// Add appends an event to the buffer, dropping old ones if limit is reached.
+// Events without an ID are assigned the next one; events that already have
+// one (e.g. replayed from disk) keep it. Only messages and channel events can
+// be stored.
+func (cb *ChannelBuffer) Add(ev *pb.StreamEvent) error {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
 
+	id := EventID(ev)
+	if id == 0 {
+		id = cb.lastID + 1
+		if err := setEventID(ev, id); err != nil {
+			return err
+		}
+	}
+	if id > cb.lastID {
+		cb.lastID = id
+	}
+
 	if cb.limit == 0 {
-		return
+		return nil
 	}
 
-	if len(cb.messages) >= cb.limit {
-		// Drop the oldest message
-		cb.messages = cb.messages[1:]
+	if len(cb.events) >= cb.limit {
+		// Drop the oldest event
+		cb.events = cb.events[1:]
 	}
-	cb.messages = append(cb.messages, msg)
+	cb.events = append(cb.events, ev)
+	return nil
 }
 
-// GetSince returns all messages since the given timestamp.
-func (cb *ChannelBuffer) GetSince(since time.Time) []*pb.IRCMessage {
+// GetSince returns all events since the given timestamp.
+func (cb *ChannelBuffer) GetSince(since time.Time) []*pb.StreamEvent {
 	cb.mu.RLock()
 	defer cb.mu.RUnlock()
 
-	var result []*pb.IRCMessage
-	for _, msg := range cb.messages {
-		if msg.GetTimestamp().AsTime().After(since) {
-			result = append(result, msg)
+	var result []*pb.StreamEvent
+	for _, ev := range cb.events {
+		if EventTime(ev).After(since) {
+			result = append(result, ev)
 		}
 	}
 	return result
 }
+
+// Page returns a page of events around cursor. See Store.
+func (cb *ChannelBuffer) Page(cursor uint64, limit int, forward bool) ([]*pb.StreamEvent, bool) {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+
+	if limit <= 0 {
+		return nil, false
+	}
+
+	// Events are ordered by ID, so we can search for the cursor.
+	if forward {
+		start := sort.Search(len(cb.events), func(i int) bool {
+			return EventID(cb.events[i]) > cursor
+		})
+		end := start + limit
+		if end > len(cb.events) {
+			end = len(cb.events)
+		}
+		return append([]*pb.StreamEvent(nil), cb.events[start:end]...), end < len(cb.events)
+	}
+
+	end := len(cb.events)
+	if cursor != 0 {
+		end = sort.Search(len(cb.events), func(i int) bool {
+			return EventID(cb.events[i]) >= cursor
+		})
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return append([]*pb.StreamEvent(nil), cb.events[start:end]...), start > 0
+}
+
+// Close is a no-op; the buffer only lives in memory.
+func (cb *ChannelBuffer) Close() error {
+	return nil
+}
+
+// EventID returns the history ID of a message or channel event, or 0.
+func EventID(ev *pb.StreamEvent) uint64 {
+	switch e := ev.GetEvent().(type) {
+	case *pb.StreamEvent_Message:
+		return e.Message.GetId()
+	case *pb.StreamEvent_ChannelEvent:
+		return e.ChannelEvent.GetId()
+	}
+	return 0
+}
+
+// EventChannel returns the channel an event belongs to.
+func EventChannel(ev *pb.StreamEvent) string {
+	switch e := ev.GetEvent().(type) {
+	case *pb.StreamEvent_Message:
+		return e.Message.GetChannel()
+	case *pb.StreamEvent_ChannelEvent:
+		return e.ChannelEvent.GetChannel()
+	case *pb.StreamEvent_SystemMessage:
+		return e.SystemMessage.GetChannel()
+	}
+	return ""
+}
+
+// EventTime returns the time an event happened.
+func EventTime(ev *pb.StreamEvent) time.Time {
+	switch e := ev.GetEvent().(type) {
+	case *pb.StreamEvent_Message:
+		return e.Message.GetTimestamp().AsTime()
+	case *pb.StreamEvent_ChannelEvent:
+		return e.ChannelEvent.GetTimestamp().AsTime()
+	case *pb.StreamEvent_SystemMessage:
+		return e.SystemMessage.GetTimestamp().AsTime()
+	}
+	return time.Time{}
+}
+
+func setEventID(ev *pb.StreamEvent, id uint64) error {
+	switch e := ev.GetEvent().(type) {
+	case *pb.StreamEvent_Message:
+		e.Message.Id = id
+	case *pb.StreamEvent_ChannelEvent:
+		e.ChannelEvent.Id = id
+	default:
+		return fmt.Errorf("cannot store %T in history", ev.GetEvent())
+	}
+	return nil
+}
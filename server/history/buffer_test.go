@@ -14,10 +14,10 @@ func TestChannelBuffer(t *testing.T) {
 
 	// Test Add and Limit
 	for i := 0; i < limit+2; i++ {
-		cb.Add(&pbService.IRCMessage{
+		cb.Add(msgEvent(&pbService.IRCMessage{
 			Content:   "msg",
 			Timestamp: timestamppb.Now(),
-		})
+		}))
 	}
 
 	msgs := cb.GetSince(time.Time{})
@@ -27,17 +27,91 @@ func TestChannelBuffer(t *testing.T) {
 
 	// Test GetSince
 	now := time.Now()
-	cb.Add(&pbService.IRCMessage{
+	cb.Add(msgEvent(&pbService.IRCMessage{
 		Content:   "new_msg",
 		Timestamp: timestamppb.New(now.Add(1 * time.Second)),
-	})
+	}))
 
 	// Get messages after 'now'
 	recentMsgs := cb.GetSince(now)
 	if len(recentMsgs) != 1 {
 		t.Errorf("Expected 1 recent message, got %d", len(recentMsgs))
 	}
-	if recentMsgs[0].Content != "new_msg" {
-		t.Errorf("Expected content 'new_msg', got '%s'", recentMsgs[0].Content)
+	if recentMsgs[0].GetMessage().Content != "new_msg" {
+		t.Errorf("Expected content 'new_msg', got '%s'", recentMsgs[0].GetMessage().Content)
 	}
 }
+
+func TestChannelBuffer_Page(t *testing.T) {
+	cb := NewChannelBuffer(10)
+	for i := 0; i < 15; i++ {
+		cb.Add(msgEvent(&pbService.IRCMessage{Content: "msg", Timestamp: timestamppb.Now()}))
+	}
+
+	// IDs keep increasing even though the oldest messages were dropped.
+	all := cb.GetSince(time.Time{})
+	base := EventID(all[0]) - 6 // ID of message n is base+n
+	if EventID(all[len(all)-1]) != base+15 {
+		t.Fatalf("Expected consecutive IDs, got %d..%d", EventID(all[0]), EventID(all[len(all)-1]))
+	}
+
+	// Newest page
+	msgs, more := cb.Page(0, 4, false)
+	if len(msgs) != 4 || EventID(msgs[0]) != base+12 || EventID(msgs[3]) != base+15 || !more {
+		t.Errorf("Expected messages 12..15 with more, got %d msgs (more=%v)", len(msgs), more)
+	}
+
+	// Page backward from the oldest message of the previous page
+	msgs, more = cb.Page(EventID(msgs[0]), 10, false)
+	if len(msgs) != 6 || EventID(msgs[0]) != base+6 || EventID(msgs[5]) != base+11 || more {
+		t.Errorf("Expected messages 6..11 without more, got %d msgs (more=%v)", len(msgs), more)
+	}
+
+	// Page forward
+	msgs, more = cb.Page(base+13, 10, true)
+	if len(msgs) != 2 || EventID(msgs[0]) != base+14 || more {
+		t.Errorf("Expected messages 14..15 without more, got %d msgs (more=%v)", len(msgs), more)
+	}
+
+	// A new buffer (e.g. after a restart) never reuses IDs.
+	time.Sleep(time.Millisecond)
+	if next := NewChannelBuffer(1); next.lastID <= base+15 {
+		t.Errorf("Expected new buffer to start past %d, got %d", base+15, next.lastID)
+	}
+
+	// Messages that already carry a newer ID keep it.
+	cb.Add(msgEvent(&pbService.IRCMessage{Id: base + 100, Timestamp: timestamppb.Now()}))
+	cb.Add(msgEvent(&pbService.IRCMessage{Timestamp: timestamppb.Now()}))
+	if msgs, _ := cb.Page(0, 1, false); EventID(msgs[0]) != base+101 {
+		t.Errorf("Expected next ID %d, got %d", base+101, EventID(msgs[0]))
+	}
+}
+
+func TestChannelBuffer_ChannelEvents(t *testing.T) {
+	cb := NewChannelBuffer(10)
+	cb.Add(msgEvent(&pbService.IRCMessage{Channel: "#test", Content: "hi", Timestamp: timestamppb.Now()}))
+	cb.Add(&pbService.StreamEvent{Event: &pbService.StreamEvent_ChannelEvent{ChannelEvent: &pbService.ChannelEvent{
+		Channel:   "#test",
+		Type:      pbService.ChannelEvent_JOIN,
+		Actor:     "alice",
+		Timestamp: timestamppb.Now(),
+	}}})
+
+	// Channel events share the message ID sequence.
+	evs := cb.GetSince(time.Time{})
+	if len(evs) != 2 || EventID(evs[1]) != EventID(evs[0])+1 {
+		t.Fatalf("Expected 2 events with consecutive IDs, got %v", evs)
+	}
+	if evs[1].GetChannelEvent().GetActor() != "alice" || EventChannel(evs[1]) != "#test" {
+		t.Errorf("Expected alice's join in #test, got %v", evs[1])
+	}
+
+	// System messages aren't part of a channel's history.
+	if err := cb.Add(&pbService.StreamEvent{Event: &pbService.StreamEvent_SystemMessage{SystemMessage: &pbService.SystemMessage{}}}); err == nil {
+		t.Error("Expected an error storing a system message")
+	}
+}
+
+func msgEvent(msg *pbService.IRCMessage) *pbService.StreamEvent {
+	return &pbService.StreamEvent{Event: &pbService.StreamEvent_Message{Message: msg}}
+}
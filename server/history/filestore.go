@@ -0,0 +1,268 @@
+package history
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/morrowc/irc-bot/proto/service"
+)
+
+const (
+	segmentExt = ".seg"
+	// Each record is a 4 byte length and a 4 byte CRC32 followed by the
+	// marshalled StreamEvent.
+	recordHeaderLen = 8
+	maxRecordLen    = 1 << 20
+)
+
+var errTornRecord = errors.New("torn record")
+
+// FileStore is a Store that appends every event to segment files on disk
+// and serves reads from an in-memory ChannelBuffer. Opening a FileStore
+// replays the segments into memory, so history survives a restart.
+//
+// A segment holds at most limit records. When it fills up a new one is
+// started and all but the previous segment are deleted, so at least limit
+// events are always retained on disk.
+type FileStore struct {
+	mu      sync.Mutex
+	mem     *ChannelBuffer
+	dir     string
+	limit   int
+	seg     *os.File
+	segSeq  int // Sequence number of the active segment
+	segRecs int // Records in the active segment
+}
+
+// OpenFileStore opens (creating if needed) the store in dir and replays its
+// contents. Torn records left by an unclean shutdown are truncated away.
+func OpenFileStore(dir string, limit int) (*FileStore, error) {
+	if limit < 0 {
+		limit = 0
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create history dir: %v", err)
+	}
+
+	fs := &FileStore{
+		mem:   NewChannelBuffer(limit),
+		dir:   dir,
+		limit: limit,
+	}
+
+	seqs, err := fs.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		n, err := fs.replay(seq)
+		if err != nil {
+			return nil, err
+		}
+		fs.segSeq, fs.segRecs = seq, n
+	}
+	if fs.segSeq == 0 {
+		fs.segSeq = 1
+	}
+
+	fs.seg, err = os.OpenFile(fs.segmentPath(fs.segSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history segment: %v", err)
+	}
+	return fs, nil
+}
+
+// Add writes the event to disk and keeps it in memory.
+func (fs *FileStore) Add(ev *pb.StreamEvent) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.seg == nil {
+		return errors.New("history store is closed")
+	}
+
+	// Keep it in memory even if the disk write fails. This also assigns
+	// the ID, which is persisted with the record; with history turned off
+	// the event still gets one, but nothing is kept.
+	if err := fs.mem.Add(ev); err != nil {
+		return err
+	}
+	if fs.limit == 0 {
+		return nil
+	}
+
+	if fs.segRecs >= fs.limit {
+		if err := fs.rotate(); err != nil {
+			return err
+		}
+	}
+
+	data, err := proto.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+	rec := make([]byte, recordHeaderLen+len(data))
+	binary.BigEndian.PutUint32(rec[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(data))
+	copy(rec[recordHeaderLen:], data)
+
+	if _, err := fs.seg.Write(rec); err != nil {
+		return fmt.Errorf("failed to write history record: %v", err)
+	}
+	fs.segRecs++
+	return nil
+}
+
+// GetSince returns all retained events since the given timestamp.
+func (fs *FileStore) GetSince(since time.Time) []*pb.StreamEvent {
+	return fs.mem.GetSince(since)
+}
+
+// Page returns a page of retained events around cursor. See Store.
+func (fs *FileStore) Page(cursor uint64, limit int, forward bool) ([]*pb.StreamEvent, bool) {
+	return fs.mem.Page(cursor, limit, forward)
+}
+
+// Close flushes and closes the active segment.
+func (fs *FileStore) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.seg == nil {
+		return nil
+	}
+	err := fs.seg.Sync()
+	if cerr := fs.seg.Close(); err == nil {
+		err = cerr
+	}
+	fs.seg = nil
+	return err
+}
+
+// rotate starts a new segment and removes those no longer needed.
+func (fs *FileStore) rotate() error {
+	if err := fs.seg.Close(); err != nil {
+		return fmt.Errorf("failed to close history segment: %v", err)
+	}
+	fs.segSeq++
+	fs.segRecs = 0
+
+	var err error
+	fs.seg, err = os.OpenFile(fs.segmentPath(fs.segSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open history segment: %v", err)
+	}
+
+	seqs, err := fs.segments()
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		if seq < fs.segSeq-1 {
+			if err := os.Remove(fs.segmentPath(seq)); err != nil {
+				return fmt.Errorf("failed to remove old history segment: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// replay loads a segment into memory and returns the number of good records.
+// The segment is truncated at the first torn record.
+func (fs *FileStore) replay(seq int) (int, error) {
+	path := fs.segmentPath(seq)
+	f, err := os.OpenFile(path, os.O_RDWR, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open history segment: %v", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	n := 0
+	for {
+		ev, size, err := readRecord(r)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			if terr := f.Truncate(offset); terr != nil {
+				return n, fmt.Errorf("failed to truncate torn history segment %s: %v", path, terr)
+			}
+			return n, nil
+		}
+		if err := fs.mem.Add(ev); err != nil {
+			return n, fmt.Errorf("failed to replay history segment %s: %v", path, err)
+		}
+		offset += size
+		n++
+	}
+}
+
+// readRecord reads one record, returning io.EOF only on a clean record boundary.
+func readRecord(r io.Reader) (*pb.StreamEvent, int64, error) {
+	var hdr [recordHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, errTornRecord
+	}
+
+	length := binary.BigEndian.Uint32(hdr[0:4])
+	if length > maxRecordLen {
+		return nil, 0, errTornRecord
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, errTornRecord
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return nil, 0, errTornRecord
+	}
+
+	ev := &pb.StreamEvent{}
+	if err := proto.Unmarshal(data, ev); err != nil {
+		return nil, 0, errTornRecord
+	}
+	return ev, int64(recordHeaderLen + len(data)), nil
+}
+
+// segments returns the sequence numbers of the segments on disk, oldest first.
+func (fs *FileStore) segments() ([]int, error) {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history dir: %v", err)
+	}
+	var seqs []int
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	return seqs, nil
+}
+
+func (fs *FileStore) segmentPath(seq int) string {
+	return filepath.Join(fs.dir, fmt.Sprintf("%08d%s", seq, segmentExt))
+}
@@ -0,0 +1,137 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pbService "github.com/morrowc/irc-bot/proto/service"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestFileStore_Replay(t *testing.T) {
+	dir := t.TempDir()
+
+	fs, err := OpenFileStore(dir, 3)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := fs.Add(msgEvent(&pbService.IRCMessage{
+			Content:   fmt.Sprintf("msg%d", i),
+			Timestamp: timestamppb.Now(),
+		})); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Rotation keeps at most the previous and the active segment.
+	segs, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if len(segs) != 2 {
+		t.Errorf("Expected 2 segments on disk, got %d", len(segs))
+	}
+
+	fs, err = OpenFileStore(dir, 3)
+	if err != nil {
+		t.Fatalf("OpenFileStore (reopen) failed: %v", err)
+	}
+	defer fs.Close()
+
+	msgs := fs.GetSince(time.Time{})
+	if len(msgs) != 3 {
+		t.Fatalf("Expected 3 replayed messages, got %d", len(msgs))
+	}
+	if msgs[0].GetMessage().Content != "msg2" || msgs[2].GetMessage().Content != "msg4" {
+		t.Errorf("Expected msg2..msg4, got %s..%s", msgs[0].GetMessage().Content, msgs[2].GetMessage().Content)
+	}
+}
+
+func TestFileStore_TornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	fs, err := OpenFileStore(dir, 10)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	fs.Add(msgEvent(&pbService.IRCMessage{Content: "complete", Timestamp: timestamppb.Now()}))
+	fs.Close()
+
+	// Simulate a crash halfway through writing a record.
+	seg := filepath.Join(dir, "00000001.seg")
+	good, err := os.Stat(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(seg, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 42, 1, 2})
+	f.Close()
+
+	fs, err = OpenFileStore(dir, 10)
+	if err != nil {
+		t.Fatalf("OpenFileStore after torn write failed: %v", err)
+	}
+	if msgs := fs.GetSince(time.Time{}); len(msgs) != 1 || msgs[0].GetMessage().Content != "complete" {
+		t.Errorf("Expected only the complete message, got %v", msgs)
+	}
+
+	// The torn tail is gone and new records append cleanly after it.
+	if st, _ := os.Stat(seg); st.Size() != good.Size() {
+		t.Errorf("Expected segment truncated to %d bytes, got %d", good.Size(), st.Size())
+	}
+	fs.Add(msgEvent(&pbService.IRCMessage{Content: "after", Timestamp: timestamppb.Now()}))
+	fs.Close()
+
+	fs, err = OpenFileStore(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	if msgs := fs.GetSince(time.Time{}); len(msgs) != 2 {
+		t.Errorf("Expected 2 messages after reopen, got %d", len(msgs))
+	}
+}
+
+func TestFileStore_Off(t *testing.T) {
+	dir := t.TempDir()
+	fs, err := OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	defer fs.Close()
+
+	// Nothing is kept, but events are still numbered so clients can resume.
+	ev := msgEvent(&pbService.IRCMessage{Content: "hi", Timestamp: timestamppb.Now()})
+	if err := fs.Add(ev); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if EventID(ev) == 0 {
+		t.Error("Expected the event to get an ID")
+	}
+	if msgs := fs.GetSince(time.Time{}); len(msgs) != 0 {
+		t.Errorf("Expected nothing kept, got %v", msgs)
+	}
+	if st, err := os.Stat(filepath.Join(dir, "00000001.seg")); err != nil || st.Size() != 0 {
+		t.Errorf("Expected nothing written, got %v (err %v)", st, err)
+	}
+}
+
+func TestFileStore_BadRecord(t *testing.T) {
+	dir := t.TempDir()
+	// A whole record, but of an event that can't be kept in history: an
+	// empty one, with a zero length and checksum.
+	if err := os.WriteFile(filepath.Join(dir, "00000001.seg"), make([]byte, recordHeaderLen), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if fs, err := OpenFileStore(dir, 10); err == nil {
+		fs.Close()
+		t.Error("Expected an error replaying an event that can't be kept")
+	}
+}
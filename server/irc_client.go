@@ -1,11 +1,25 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/lrstanley/girc"
+	"github.com/morrowc/irc-bot/backoff"
 	"github.com/morrowc/irc-bot/server/history"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	pbConfig "github.com/morrowc/irc-bot/proto/config"
@@ -13,15 +27,64 @@ import (
 )
 
 type IRCBot struct {
+	network   string // Name of the network; events are marked with it
 	client    *girc.Client
-	history   func(channel string) *history.ChannelBuffer
-	broadcast func(msg *pbService.IRCMessage)
+	history   func(channel string) history.Store
+	broadcast func(ev *pbService.StreamEvent)
+	// Upstream servers, tried in turn by Run
+	servers []*pbConfig.Endpoint
+	retry   backoff.Backoff
+	// TLS settings for the upstream connection, nil without use_tls. Run
+	// sets ServerName per server.
+	tlsConfig *tls.Config
+	// SASL login, and whether a failed login stops the bot from connecting
+	sasl      girc.SASLMech
+	saslAbort bool
+	// Whether to send split messages as draft/multiline batches
+	multiline bool
+	// The configured nick, then the alternates, and how to get the first
+	// back when we had to take another
+	nicks       []string
+	regainEvery time.Duration
+	nickserv    *pbConfig.NickServ
+	// Lines waiting for flood control; Run sends them
+	queue *sendQueue
 	// State
 	mu       sync.RWMutex
 	channels map[string]string // channel -> key
+	connects int               // Successful registrations so far
+	saslFail string            // Why SASL failed on the current connection, if it did
+	mlLimits multilineLimits   // What the server's draft/multiline allows
+	batches  uint64            // Batch references handed out so far
+	welcomed bool              // Registration on the current connection is over
+	refused  int               // Nicks refused while registering on the current connection
+	nick     string            // Nick clients were last told about
+	account  string            // Account we are logged in to on the current connection
+	// Fires if NickServ doesn't log us in, to join our channels anyway; nil
+	// when they aren't waiting, see joinChannels
+	joinTimer *time.Timer
+	// Channels whose history is being filled in from the server's, by
+	// folded name and by the reference of the batch bringing it. A batch
+	// no backfill is waiting for maps to nil.
+	fills     map[string]*backfill
+	fillBatch map[string]*backfill
+	// Lines we sent that the server is yet to echo back
+	echoes map[echoKey][]*echoWait
+	// Topic, members and modes of the channels we are in, by folded name.
+	// Membership also tells which channels a QUIT or NICK, which name none,
+	// belongs to.
+	state map[string]*channelState
 }
 
-func NewIRCBot(cfg *pbConfig.IRCServer, channels []*pbConfig.Channel, histGetter func(string) *history.ChannelBuffer, broadcaster func(*pbService.IRCMessage)) *IRCBot {
+// A connection that lasted this long counts as having worked, so the next
+// reconnect starts with a short delay and the same server.
+const stableConnection = 5 * time.Minute
+
+func NewIRCBot(network string, cfg *pbConfig.IRCServer, channels []*pbConfig.Channel, histGetter func(string) history.Store, broadcaster func(*pbService.StreamEvent)) (*IRCBot, error) {
+	if err := checkNicks(cfg); err != nil {
+		return nil, err
+	}
+
 	// Basic setup config
 	config := girc.Config{
 		Server:     cfg.GetHost(),
@@ -31,36 +94,135 @@ func NewIRCBot(cfg *pbConfig.IRCServer, channels []*pbConfig.Channel, histGetter
 		Name:       cfg.GetUser(),
 		ServerPass: cfg.GetPassword(),
 		SSL:        cfg.GetUseTls(),
+		// Taken nicks are handled by handleNickInUse.
+		HandleNickCollide: func(string) string { return "" },
+	}
+	// girc asks for server-time, message-tags, batch, account-tag and
+	// away-notify on its own, but not echo-message or chathistory.
+	config.SupportedCaps = map[string][]string{echoCap: nil, chathistoryCap: nil}
+	if cfg.GetMultiline() {
+		config.SupportedCaps[multilineCap] = nil
 	}
 
-	if !cfg.GetUseTls() {
-		config.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	var tlsConfig *tls.Config
+	var verifier *upstreamVerifier
+	if cfg.GetUseTls() {
+		var err error
+		tlsConfig, verifier, err = newUpstreamTLSConfig(cfg.GetTls())
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.GetTls() != nil {
+		return nil, errors.New("irc.tls is set but use_tls is not")
+	}
+
+	if sasl := cfg.GetSasl(); sasl != nil {
+		mech, cert, err := saslMech(sasl, cfg.GetUseTls())
+		if err != nil {
+			return nil, err
+		}
+		config.SASL = mech
+		if cert != nil {
+			tlsConfig.Certificates = []tls.Certificate{*cert}
+		}
 	}
 
 	client := girc.New(config)
 
 	bot := &IRCBot{
-		client:    client,
-		history:   histGetter,
-		broadcast: broadcaster,
-		channels:  make(map[string]string),
+		network: network,
+		client:  client,
+		history: histGetter,
+		broadcast: func(ev *pbService.StreamEvent) {
+			setNetwork(ev, network)
+			broadcaster(ev)
+		},
+		servers: append([]*pbConfig.Endpoint{{Host: cfg.GetHost(), Port: cfg.GetPort()}}, cfg.GetFallbackServers()...),
+		retry: backoff.Backoff{
+			Min: secondsOr(cfg.GetReconnectMinDelaySecs(), 5*time.Second),
+			Max: secondsOr(cfg.GetReconnectMaxDelaySecs(), 5*time.Minute),
+		},
+		tlsConfig:   tlsConfig,
+		sasl:        config.SASL,
+		saslAbort:   cfg.GetSasl().GetAbortOnFailure(),
+		multiline:   cfg.GetMultiline(),
+		nicks:       append([]string{cfg.GetNick()}, cfg.GetAltNicks()...),
+		regainEvery: secondsOr(cfg.GetNickRegainIntervalSecs(), time.Minute),
+		nickserv:    cfg.GetNickserv(),
+		nick:        cfg.GetNick(),
+		channels:    make(map[string]string),
+		state:       make(map[string]*channelState),
+		fills:       make(map[string]*backfill),
+		fillBatch:   make(map[string]*backfill),
+		echoes:      make(map[echoKey][]*echoWait),
 	}
 
+	bot.queue = newSendQueue(cfg, func(st *pbService.SendQueueStatus) {
+		bot.broadcast(sendQueueEvent(st))
+	})
 	for _, ch := range channels {
 		bot.channels[ch.GetName()] = ch.GetKey()
 	}
+	if verifier != nil {
+		verifier.report = func(msg string) {
+			log.Print(msg)
+			bot.systemMessage(msg)
+		}
+	}
 
+	// girc answers CTCP queries by default, even ones we sent that the
+	// server echoes back to us.
+	for _, cmd := range []string{girc.CTCP_PING, girc.CTCP_PONG, girc.CTCP_VERSION, girc.CTCP_SOURCE, girc.CTCP_TIME, girc.CTCP_FINGER} {
+		client.CTCP.Clear(cmd)
+	}
+	client.CTCP.Set("*", bot.ignoreCTCP)
+	for cmd := range ctcpReplies {
+		client.CTCP.SetBg(cmd, bot.answerCTCP)
+	}
 	client.Handlers.Add(girc.PRIVMSG, bot.handlePrivMsg)
+	client.Handlers.Add(girc.NOTICE, bot.handleNotice)
 	client.Handlers.Add(girc.JOIN, bot.handleJoin)
+	client.Handlers.Add(girc.PART, bot.handlePart)
+	client.Handlers.Add(girc.QUIT, bot.handleQuit)
+	client.Handlers.Add(girc.KICK, bot.handleKick)
+	client.Handlers.Add(girc.NICK, bot.handleNick)
+	client.Handlers.Add(girc.TOPIC, bot.handleTopic)
+	client.Handlers.Add(girc.MODE, bot.handleMode)
+	client.Handlers.Add(girc.RPL_NAMREPLY, bot.handleNames)
+	client.Handlers.Add(girc.RPL_TOPIC, bot.handleTopicReply)
+	client.Handlers.Add(girc.RPL_TOPICWHOTIME, bot.handleTopicWhoTime)
+	client.Handlers.Add(girc.RPL_CHANNELMODEIS, bot.handleChannelModes)
+	client.Handlers.Add(girc.RPL_LOGGEDIN, bot.handleLoggedIn)
+	client.Handlers.Add(girc.CAP, bot.handleCap)
+	client.Handlers.Add(girc.ALL_EVENTS, bot.handleEcho)
+	client.Handlers.Add("BATCH", bot.handleBatch)
+	client.Handlers.Add("FAIL", bot.handleFail)
+	client.Handlers.Add(girc.RPL_WELCOME, bot.handleWelcome)
+	client.Handlers.Add(girc.RPL_MONOFFLINE, bot.handleMonOffline)
+	for _, cmd := range []string{girc.ERR_NICKNAMEINUSE, girc.ERR_ERRONEUSNICKNAME, girc.ERR_NICKCOLLISION, girc.ERR_UNAVAILRESOURCE} {
+		client.Handlers.Add(cmd, bot.handleNickInUse)
+	}
+	for _, cmd := range []string{girc.ERR_SASLFAIL, girc.ERR_SASLTOOLONG, girc.ERR_SASLABORTED, girc.RPL_SASLMECHS} {
+		client.Handlers.Add(cmd, bot.handleSASLFailure)
+	}
 	client.Handlers.Add(girc.CONNECTED, func(c *girc.Client, e girc.Event) {
-		bot.mu.RLock()
-		defer bot.mu.RUnlock()
-		for ch, key := range bot.channels {
-			c.Cmd.JoinKey(ch, key)
+		bot.mu.Lock()
+		defer bot.mu.Unlock()
+		bot.connects++
+		// Channel state is rebuilt from the JOINs and replies that follow.
+		bot.state = make(map[string]*channelState)
+		// Batch references are per connection.
+		bot.fillBatch = make(map[string]*backfill)
+		if bot.connects == 1 {
+			bot.systemMessage(fmt.Sprintf("Connected to %s", c.Server()))
+		} else {
+			bot.systemMessage(fmt.Sprintf("Reconnected to %s", c.Server()))
 		}
+		bot.claimNick(c)
+		bot.joinChannels(c)
 	})
 
-	return bot
+	return bot, nil
 }
 
 func (b *IRCBot) UpdateChannels(newChannels []*pbConfig.Channel) {
@@ -76,7 +238,8 @@ func (b *IRCBot) UpdateChannels(newChannels []*pbConfig.Channel) {
 	// To Join
 	for ch, key := range newMap {
 		if _, exists := b.channels[ch]; !exists {
-			if b.client.IsConnected() {
+			// Channels waiting on NickServ are joined with the rest.
+			if b.client.IsConnected() && b.joinTimer == nil {
 				b.client.Cmd.JoinKey(ch, key)
 			}
 		}
@@ -98,55 +261,1250 @@ func (b *IRCBot) Connect() error {
 	return b.client.Connect()
 }
 
+// Run keeps the bot connected until ctx is done. When the connection drops
+// it reconnects with exponential backoff, moving on to the next configured
+// server whenever an attempt fails quickly. Channels are rejoined on connect.
+//
+// If SASL login fails the server hangs up on us. Unless the config says to
+// give up, the next attempt then goes ahead without logging in.
+func (b *IRCBot) Run(ctx context.Context) {
+	go b.queue.run(ctx, b.writeRaw)
+	go b.regainNick(ctx)
+
+	skipSASL := false
+	for i := 0; ctx.Err() == nil; {
+		ep := b.servers[i%len(b.servers)]
+		b.client.Config.Server = ep.GetHost()
+		b.client.Config.Port = int(ep.GetPort())
+		if b.tlsConfig != nil {
+			tc := b.tlsConfig.Clone()
+			tc.ServerName = ep.GetHost()
+			b.client.Config.TLSConfig = tc
+		}
+		b.client.Config.SASL = b.sasl
+		if skipSASL {
+			b.client.Config.SASL = nil
+			skipSASL = false
+		}
+		addr := net.JoinHostPort(ep.GetHost(), strconv.Itoa(int(ep.GetPort())))
+
+		b.mu.Lock()
+		b.welcomed = false
+		b.refused = 0
+		b.account = ""
+		if b.joinTimer != nil {
+			b.joinTimer.Stop()
+			b.joinTimer = nil
+		}
+		b.mu.Unlock()
+
+		log.Printf("Connecting to IRC server %s", addr)
+		start := time.Now()
+		err := b.client.Connect()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("connection closed")
+		}
+		for target, n := range b.queue.clear() {
+			b.broadcast(systemEvent(&pbService.SystemMessage{
+				Timestamp: timestamppb.Now(),
+				Channel:   target,
+				Content:   fmt.Sprintf("%d queued lines to %s were not sent: disconnected", n, target),
+			}))
+		}
+
+		b.mu.Lock()
+		saslFail := b.saslFail
+		b.saslFail = ""
+		b.mu.Unlock()
+		if saslFail != "" {
+			if b.saslAbort {
+				log.Printf("SASL authentication failed on %s: %s. Not reconnecting", addr, saslFail)
+				b.systemMessage(fmt.Sprintf("SASL authentication failed: %s. Not reconnecting (abort_on_failure is set)", saslFail))
+				return
+			}
+			// Same server, but without logging in.
+			skipSASL = true
+			err = fmt.Errorf("SASL authentication failed: %s; continuing without it", saslFail)
+		} else if time.Since(start) >= stableConnection {
+			b.retry.Reset()
+		} else {
+			i++ // Try the next server
+		}
+		delay := b.retry.Next()
+		log.Printf("Disconnected from IRC server %s: %v. Reconnecting in %v", addr, err, delay)
+		b.systemMessage(fmt.Sprintf("Disconnected from IRC (%s): %v. Reconnecting in %v", addr, err, delay.Round(time.Second)))
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+}
+
 func (b *IRCBot) Close() {
 	b.client.Close()
 }
 
-func (b *IRCBot) Join(channel, key string) {
-	b.client.Cmd.JoinKey(channel, key)
+// Join joins channel, with its key, if it is one of the configured channels.
+// Others are refused: they would have no history, and not be joined again
+// after a reconnect.
+func (b *IRCBot) Join(channel string) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch, key := range b.channels {
+		if girc.ToRFC1459(ch) == girc.ToRFC1459(channel) {
+			b.client.Cmd.JoinKey(ch, key)
+			return nil
+		}
+	}
+	return errNotConfigured
+}
+
+// Nick returns the nick the bot currently has.
+func (b *IRCBot) Nick() string {
+	return b.client.GetNick()
+}
+
+// SetTopic changes the topic of a channel we are in. The change shows up as
+// a TOPIC event once the server accepts it.
+func (b *IRCBot) SetTopic(channel, topic string) error {
+	if !b.client.IsConnected() {
+		return errNotConnected
+	}
+	if !b.joined(channel) {
+		return fmt.Errorf("not in channel %s", channel)
+	}
+	if !b.queue.push(channel, []*queuedItem{{events: []*girc.Event{{Command: girc.TOPIC, Params: []string{channel, topic}}}}}) {
+		return errQueueFull
+	}
+	return nil
 }
 
-func (b *IRCBot) Send(channel, message string) {
-	b.client.Cmd.Message(channel, message)
+// Send sends a message of the given kind to a channel or nick. For CTCP,
+// message is the CTCP command followed by its arguments. Messages too long
+// for one line, or with line breaks, go out as several lines, each of which
+// is kept in history as sent. It returns the lines as history will keep
+// them, without IDs: lines are kept once they have gone out, or when the
+// server echoes them, so one that is dropped or refused never is. sent, if
+// set, is told once every line is kept, with the lines as kept, IDs and
+// all, or else why one wasn't. Lines not kept are passed as sent.
+func (b *IRCBot) Send(target, message string, kind pbService.IRCMessage_Kind, sent func([]*pbService.IRCMessage, error)) ([]*pbService.IRCMessage, error) {
+	if !b.client.IsConnected() {
+		return nil, errNotConnected
+	}
+	if err := b.checkSend(target, message, kind); err != nil {
+		return nil, err
+	}
+
+	if kind == pbService.IRCMessage_CTCP {
+		cmd, args, _ := strings.Cut(message, " ")
+		cmd = strings.ToUpper(cmd)
+		e := &girc.Event{Command: girc.PRIVMSG, Params: []string{target, girc.EncodeCTCPRaw(cmd, args)}}
+		// Kept the way handleText decodes the echo.
+		msg := b.ownMessage(target, strings.TrimSpace(cmd+" "+args), kind)
+		t := newSendTracker([]*pbService.IRCMessage{msg}, sent)
+		if !b.queue.push(target, []*queuedItem{b.outgoing([]*girc.Event{e}, t, 0, msg)}) {
+			return nil, errQueueFull
+		}
+		return []*pbService.IRCMessage{msg}, nil
+	}
+
+	command := girc.PRIVMSG
+	if kind == pbService.IRCMessage_NOTICE {
+		command = girc.NOTICE
+	}
+	lines := splitText(message, b.maxPayload(command, target, kind))
+	msgs := make([]*pbService.IRCMessage, len(lines))
+	for i, line := range lines {
+		msgs[i] = b.ownMessage(target, line.text, kind)
+	}
+	t := newSendTracker(msgs, sent)
+	var items []*queuedItem
+	if limits, ok := b.multilineLimits(); ok && len(lines) > 1 && kind != pbService.IRCMessage_ACTION {
+		first := 0
+		for _, batch := range batchLines(lines, limits) {
+			items = append(items, b.outgoing(b.batchEvents(command, target, batch), t, first, msgs[first:first+len(batch)]...))
+			first += len(batch)
+		}
+	} else {
+		for i, line := range lines {
+			text := line.text
+			if kind == pbService.IRCMessage_ACTION {
+				text = "\x01ACTION " + text + "\x01"
+			}
+			items = append(items, b.outgoing([]*girc.Event{{Command: command, Params: []string{target, text}}}, t, i, msgs[i]))
+		}
+	}
+	if !b.queue.push(target, items) {
+		return nil, errQueueFull
+	}
+	return msgs, nil
+}
 
-	// Echo back to history/clients so the sender sees it too
-	msg := &pbService.IRCMessage{
+// ownMessage returns a line we send as history keeps it.
+func (b *IRCBot) ownMessage(target, text string, kind pbService.IRCMessage_Kind) *pbService.IRCMessage {
+	return &pbService.IRCMessage{
 		Timestamp: timestamppb.Now(),
-		Channel:   channel,
+		Channel:   target,
 		Sender:    b.client.GetNick(),
-		Content:   message,
+		Content:   text,
+		Kind:      kind,
 	}
+}
 
-	// Store in history
-	if buf := b.history(channel); buf != nil {
-		buf.Add(msg)
+// outgoing makes a queue item of events that carry msgs, which are lines
+// first on of the send t. Unless the server echoes what we send, msgs are
+// recorded once the events have gone out, so the sender and other clients
+// see them too. Otherwise their echoes are waited for, from before they go
+// out so as not to miss one.
+func (b *IRCBot) outgoing(events []*girc.Event, t *sendTracker, first int, msgs ...*pbService.IRCMessage) *queuedItem {
+	var waits []*echoWait
+	if b.client.HasCapability(echoCap) {
+		for i, msg := range msgs {
+			waits = append(waits, b.awaitEcho(msg, t, first+i))
+		}
 	}
+	return &queuedItem{events: events, done: func(err error) {
+		if err != nil {
+			for _, w := range waits {
+				b.forgetEcho(w)
+			}
+			t.failed(err)
+			return
+		}
+		if waits != nil {
+			for _, w := range waits {
+				b.expectEcho(w)
+			}
+			return
+		}
+		for i, msg := range msgs {
+			// Send's caller has msg; history fills in the ID.
+			msg = proto.Clone(msg).(*pbService.IRCMessage)
+			msg.Timestamp = timestamppb.Now()
+			b.record(msg.GetChannel(), messageEvent(msg))
+			t.kept(first+i, msg)
+		}
+	}}
+}
+
+// sendTracker follows the lines of one Send until history keeps them all.
+type sendTracker struct {
+	mu   sync.Mutex
+	msgs []*pbService.IRCMessage // As sent, then as kept
+	left int
+	over bool
+	sent func([]*pbService.IRCMessage, error)
+}
+
+func newSendTracker(msgs []*pbService.IRCMessage, sent func([]*pbService.IRCMessage, error)) *sendTracker {
+	return &sendTracker{msgs: slices.Clone(msgs), left: len(msgs), sent: sent}
+}
 
-	// Broadcast to gRPC clients
-	b.broadcast(msg)
+// kept notes that line i is in history as msg.
+func (t *sendTracker) kept(i int, msg *pbService.IRCMessage) {
+	t.mu.Lock()
+	if t.over {
+		t.mu.Unlock()
+		return
+	}
+	t.msgs[i] = msg
+	t.left--
+	t.over = t.left == 0
+	done := t.over
+	t.mu.Unlock()
+	if done && t.sent != nil {
+		t.sent(t.msgs, nil)
+	}
+}
+
+// failed notes that a line won't be kept, so the send failed.
+func (t *sendTracker) failed(err error) {
+	t.mu.Lock()
+	if t.over {
+		t.mu.Unlock()
+		return
+	}
+	t.over = true
+	t.mu.Unlock()
+	if t.sent != nil {
+		t.sent(t.msgs, err)
+	}
+}
+
+// How long a line we sent is waited for to come back with echo-message.
+// The server doesn't echo a line it refused.
+const echoTimeout = 30 * time.Second
+
+var errNotEchoed = errors.New("the server did not echo the message back")
+
+// echoKey tells which line an echo is of.
+type echoKey struct {
+	target  string // Folded
+	kind    pbService.IRCMessage_Kind
+	content string
+}
+
+func newEchoKey(msg *pbService.IRCMessage) echoKey {
+	return echoKey{girc.ToRFC1459(msg.GetChannel()), msg.GetKind(), msg.GetContent()}
+}
+
+// echoWait is line i of the send t, waiting for its echo. The timer runs
+// once the line has gone out.
+type echoWait struct {
+	key   echoKey
+	t     *sendTracker
+	i     int
+	timer *time.Timer
+}
+
+// awaitEcho starts waiting for the echo of msg, line i of the send t.
+// Echoes of the same line are handed out in the order it was sent.
+func (b *IRCBot) awaitEcho(msg *pbService.IRCMessage, t *sendTracker, i int) *echoWait {
+	w := &echoWait{key: newEchoKey(msg), t: t, i: i}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.echoes[w.key] = append(b.echoes[w.key], w)
+	return w
+}
+
+// expectEcho gives up on w if its echo hasn't come echoTimeout from now.
+func (b *IRCBot) expectEcho(w *echoWait) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !slices.Contains(b.echoes[w.key], w) {
+		return
+	}
+	w.timer = time.AfterFunc(echoTimeout, func() {
+		if b.forgetEcho(w) {
+			w.t.failed(errNotEchoed)
+		}
+	})
+}
+
+// forgetEcho stops waiting for w. It reports whether w was still waiting.
+func (b *IRCBot) forgetEcho(w *echoWait) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	waits := b.echoes[w.key]
+	i := slices.Index(waits, w)
+	if i < 0 {
+		return false
+	}
+	b.setEchoes(w.key, slices.Delete(waits, i, i+1))
+	return true
+}
+
+// echoed hands msg, the echo of a line we sent as kept in history, to the
+// send it is waiting for.
+func (b *IRCBot) echoed(msg *pbService.IRCMessage) {
+	key := newEchoKey(msg)
+	b.mu.Lock()
+	waits := b.echoes[key]
+	if len(waits) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	w := waits[0]
+	b.setEchoes(key, waits[1:])
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	b.mu.Unlock()
+	w.t.kept(w.i, msg)
+}
+
+// setEchoes must be called with b.mu held.
+func (b *IRCBot) setEchoes(key echoKey, waits []*echoWait) {
+	if len(waits) == 0 {
+		delete(b.echoes, key)
+		return
+	}
+	b.echoes[key] = waits
+}
+
+const echoCap = "echo-message"
+
+var (
+	errNotConnected  = errors.New("not connected to IRC")
+	errNotConfigured = errors.New("not one of the bouncer's channels")
+)
+
+// checkSend reports why a message can't be sent to target, which must be a
+// channel we are in or a nick. Only CTCP has to fit in a single line.
+func (b *IRCBot) checkSend(target, message string, kind pbService.IRCMessage_Kind) error {
+	if strings.TrimSpace(message) == "" {
+		return errors.New("message is empty")
+	}
+	if girc.IsValidChannel(target) {
+		if !b.joined(target) {
+			return fmt.Errorf("not in channel %s", target)
+		}
+	} else if !girc.IsValidNick(target) {
+		return fmt.Errorf("invalid target %q", target)
+	}
+
+	if kind == pbService.IRCMessage_CTCP {
+		if strings.HasPrefix(message, " ") {
+			return errors.New("CTCP message has no command")
+		}
+		if strings.ContainsAny(message, "\r\n") {
+			return errors.New("CTCP message contains a line break")
+		}
+		if n, limit := len(message), b.maxPayload(girc.PRIVMSG, target, kind); n > limit {
+			return fmt.Errorf("CTCP message too long: %d bytes over the %d byte limit", n-limit, limit)
+		}
+	}
+	return nil
+}
+
+// maxPayload returns how much text fits in one command to target. Servers
+// relay it with our prefix in front, ":nick!ident@host ", and the whole line
+// must stay within 512 bytes. Until we know our host, assume the longest
+// prefix girc allows for.
+func (b *IRCBot) maxPayload(command, target string, kind pbService.IRCMessage_Kind) int {
+	prefix := girc.DefaultMaxPrefixLength
+	if host := b.client.GetHost(); host != "" {
+		prefix = len(":!@ ") + len(b.client.GetNick()) + len(b.client.GetIdent()) + len(host)
+	}
+	n := girc.DefaultMaxLineLength - prefix - len(command+" "+target+" :")
+	switch kind {
+	case pbService.IRCMessage_ACTION:
+		n -= len("\x01ACTION \x01")
+	case pbService.IRCMessage_CTCP:
+		n -= len("\x01\x01")
+	}
+	return n
+}
+
+// multilineLimits returns the server's draft/multiline limits, if batches
+// can be used on this connection.
+func (b *IRCBot) multilineLimits() (multilineLimits, bool) {
+	if !b.multiline {
+		return multilineLimits{}, false
+	}
+	for _, c := range []string{multilineCap, "batch", "message-tags"} {
+		if !b.client.HasCapability(c) {
+			return multilineLimits{}, false
+		}
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.mlLimits, true
+}
+
+const multilineCap = "draft/multiline"
+
+// batchEvents returns the lines of one draft/multiline batch.
+func (b *IRCBot) batchEvents(command, target string, lines []outLine) []*girc.Event {
+	if len(lines) == 1 {
+		return []*girc.Event{{Command: command, Params: []string{target, lines[0].text}}}
+	}
+
+	b.mu.Lock()
+	b.batches++
+	ref := "ml" + strconv.FormatUint(b.batches, 10)
+	b.mu.Unlock()
+
+	events := []*girc.Event{{Command: "BATCH", Params: []string{"+" + ref, multilineCap, target}}}
+	for i, line := range lines {
+		tags := girc.Tags{"batch": ref}
+		if line.concat && i > 0 {
+			tags[multilineCap+"-concat"] = ""
+		}
+		events = append(events, &girc.Event{Tags: tags, Command: command, Params: []string{target, line.text}})
+	}
+	return append(events, &girc.Event{Command: "BATCH", Params: []string{"-" + ref}})
+}
+
+// writeRaw sends e as it is. girc's own Send would split long lines again,
+// assuming the longest possible prefix, and history would no longer match
+// what went out.
+func (b *IRCBot) writeRaw(e *girc.Event) error {
+	if err := b.client.Cmd.SendRawNoSplit(string(e.Bytes())); err != nil {
+		log.Printf("Failed to send %s: %v", e.Command, err)
+		return err
+	}
+	return nil
+}
+
+// Most lines that may wait in the send queue. Sends beyond that are refused
+// rather than going out many minutes later.
+const maxQueuedLines = 1000
+
+var (
+	errQueueFull = fmt.Errorf("send queue full (%d lines waiting)", maxQueuedLines)
+	errDropped   = errors.New("dropped from the send queue")
+)
+
+// tokenBucket allows a burst of events, then rate events per second.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// take uses up a token if there is one. Otherwise it returns how long until
+// there will be.
+func (tb *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	return tb.takeN(now, 1)
+}
+
+// takeN uses up n tokens at once as soon as there is one, which may leave
+// the bucket owing the rest. Otherwise it returns how long until there is.
+func (tb *tokenBucket) takeN(now time.Time, n int) (bool, time.Duration) {
+	if !tb.last.IsZero() {
+		tb.tokens = min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	}
+	tb.last = now
+	if tb.tokens >= 1 {
+		tb.tokens -= float64(n)
+		return true, 0
+	}
+	return false, time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled completely, i.e. it hasn't
+// been used for a while.
+func (tb *tokenBucket) full(now time.Time) bool {
+	return tb.tokens+now.Sub(tb.last).Seconds()*tb.rate >= tb.burst
+}
+
+// sendQueue paces lines to the IRC server so that a burst of sends doesn't
+// get the bot disconnected for flooding. Lines for each target go out in
+// order; with fair set, targets take turns. The lines of a batch go out
+// together, as one item.
+type sendQueue struct {
+	fair   bool
+	status func(*pbService.SendQueueStatus)
+
+	mu      sync.Mutex
+	bucket  *tokenBucket
+	order   []string                 // Queue keys with items waiting, next first
+	items   map[string][]*queuedItem // Queue key -> items
+	waiting map[string]int32         // Target -> lines waiting
+	depth   int                      // Lines waiting
+	wake    chan struct{}
+}
+
+// queuedItem is a line, or the lines of a batch. done, if set, is told how
+// that went: nil once they were written, else why they weren't.
+type queuedItem struct {
+	target string
+	events []*girc.Event
+	done   func(error)
+}
+
+func newSendQueue(cfg *pbConfig.IRCServer, status func(*pbService.SendQueueStatus)) *sendQueue {
+	rate := cfg.GetSendRate()
+	if rate <= 0 {
+		rate = 0.5
+	}
+	burst := int(cfg.GetSendBurst())
+	if burst <= 0 {
+		burst = 5
+	}
+	return &sendQueue{
+		fair:    cfg.GetSendFair(),
+		status:  status,
+		bucket:  newTokenBucket(rate, burst),
+		items:   make(map[string][]*queuedItem),
+		waiting: make(map[string]int32),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// push queues the items of one message to target, all or none of them.
+func (q *sendQueue) push(target string, items []*queuedItem) bool {
+	n := 0
+	for _, item := range items {
+		item.target = target
+		n += len(item.events)
+	}
+	q.mu.Lock()
+	if q.depth+n > maxQueuedLines {
+		q.mu.Unlock()
+		return false
+	}
+	// Without fair queueing everything shares one queue.
+	key := ""
+	if q.fair {
+		key = girc.ToRFC1459(target)
+	}
+	if len(q.items[key]) == 0 {
+		q.order = append(q.order, key)
+	}
+	q.items[key] = append(q.items[key], items...)
+	q.waiting[target] += int32(n)
+	q.depth += n
+	st := q.statusLocked()
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	q.status(st)
+	return true
+}
+
+// next returns the item to send next. Must be called with q.mu held and an
+// item waiting.
+func (q *sendQueue) next() *queuedItem {
+	return q.items[q.order[0]][0]
+}
+
+// pop takes the next item off the queue. Must be called with q.mu held and an
+// item waiting.
+func (q *sendQueue) pop() *queuedItem {
+	key := q.order[0]
+	item := q.items[key][0]
+	q.items[key] = q.items[key][1:]
+	q.order = q.order[1:]
+	if len(q.items[key]) > 0 {
+		// Back of the line, unless there is nobody else.
+		q.order = append(q.order, key)
+	} else {
+		delete(q.items, key)
+	}
+	if q.waiting[item.target] -= int32(len(item.events)); q.waiting[item.target] == 0 {
+		delete(q.waiting, item.target)
+	}
+	q.depth -= len(item.events)
+	return item
+}
+
+// run writes queued items as the bucket allows until ctx is done. A batch
+// uses up a token for each of its lines.
+func (q *sendQueue) run(ctx context.Context, write func(*girc.Event) error) {
+	for {
+		q.mu.Lock()
+		if q.depth == 0 {
+			q.mu.Unlock()
+			select {
+			case <-q.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ok, wait := q.bucket.takeN(time.Now(), len(q.next().events)); !ok {
+			q.mu.Unlock()
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		item := q.pop()
+		st := q.statusLocked()
+		q.mu.Unlock()
+
+		var err error
+		for _, e := range item.events {
+			if err = write(e); err != nil {
+				break
+			}
+		}
+		if item.done != nil {
+			item.done(err)
+		}
+		q.status(st)
+	}
+}
+
+// clear drops the lines still waiting, e.g. when the connection is lost.
+// It returns how many were dropped per target.
+func (q *sendQueue) clear() map[string]int32 {
+	q.mu.Lock()
+	dropped := q.waiting
+	items := q.items
+	q.order = nil
+	q.items = make(map[string][]*queuedItem)
+	q.waiting = make(map[string]int32)
+	q.depth = 0
+	st := q.statusLocked()
+	q.mu.Unlock()
+
+	for _, list := range items {
+		for _, item := range list {
+			if item.done != nil {
+				item.done(errDropped)
+			}
+		}
+	}
+	if len(dropped) > 0 {
+		q.status(st)
+	}
+	return dropped
+}
+
+// snapshot returns what is waiting to be sent.
+func (q *sendQueue) snapshot() *pbService.SendQueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.statusLocked()
+}
+
+func (q *sendQueue) statusLocked() *pbService.SendQueueStatus {
+	return &pbService.SendQueueStatus{Depth: int32(q.depth), Targets: maps.Clone(q.waiting)}
+}
+
+// joined reports whether the bot is in channel.
+func (b *IRCBot) joined(channel string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.channelState(channel) != nil
 }
 
 func (b *IRCBot) handlePrivMsg(c *girc.Client, e girc.Event) {
+	b.handleText(e, pbService.IRCMessage_PRIVMSG)
+}
+
+// handleEcho records the lines we sent as the server echoes them. girc only
+// hands those to ALL_EVENTS handlers.
+func (b *IRCBot) handleEcho(c *girc.Client, e girc.Event) {
+	if !e.Echo || b.secret(e) {
+		return
+	}
+	var msg *pbService.IRCMessage
+	switch e.Command {
+	case girc.PRIVMSG:
+		msg = b.handleText(e, pbService.IRCMessage_PRIVMSG)
+	case girc.NOTICE:
+		msg = b.handleText(e, pbService.IRCMessage_NOTICE)
+	}
+	if msg != nil {
+		b.echoed(msg)
+	}
+}
+
+// ctcpReplies makes our answers to CTCP queries, as girc's defaults do.
+// FINGER and PONG, which girc also answers, get the unknown query error.
+var ctcpReplies = map[string]func(c *girc.Client, ctcp girc.CTCPEvent) string{
+	girc.CTCP_PING: func(c *girc.Client, ctcp girc.CTCPEvent) string {
+		return ctcp.Text
+	},
+	girc.CTCP_VERSION: func(c *girc.Client, ctcp girc.CTCPEvent) string {
+		return fmt.Sprintf("girc (github.com/lrstanley/girc) using %s (%s, %s)", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	},
+	girc.CTCP_SOURCE: func(c *girc.Client, ctcp girc.CTCPEvent) string {
+		return "https://github.com/lrstanley/girc"
+	},
+	girc.CTCP_TIME: func(c *girc.Client, ctcp girc.CTCPEvent) string {
+		return ":" + time.Now().Format(time.RFC1123Z)
+	},
+}
+
+// skipCTCP reports whether ctcp is one of ours, echoed back to us, or one
+// from the server's history, rather than a query to answer.
+func (b *IRCBot) skipCTCP(ctcp girc.CTCPEvent) bool {
+	return ctcp.Origin != nil && (ctcp.Origin.Echo || b.playback(ctcp.Origin))
+}
+
+// ignoreCTCP keeps girc from answering queries skipCTCP leaves alone with
+// an unknown query error. girc runs the "*" handler first and only sends
+// that error to a valid nick; ctcp.Source is girc's own copy.
+func (b *IRCBot) ignoreCTCP(c *girc.Client, ctcp girc.CTCPEvent) {
+	if b.skipCTCP(ctcp) && ctcp.Source != nil {
+		ctcp.Source.Name = ""
+	}
+}
+
+func (b *IRCBot) answerCTCP(c *girc.Client, ctcp girc.CTCPEvent) {
+	if ctcp.Reply || ctcp.Source == nil || b.skipCTCP(ctcp) {
+		return
+	}
+	c.Cmd.SendCTCPReply(ctcp.Source.ID(), ctcp.Command, ctcpReplies[ctcp.Command](c, ctcp))
+}
+
+func (b *IRCBot) handleNotice(c *girc.Client, e girc.Event) {
+	// Notices from the server itself (e.g. "*** Looking up your hostname")
+	// aren't part of any conversation.
+	if e.Source == nil || (e.Source.IsServer() && strings.Contains(e.Source.Name, ".")) {
+		log.Printf("Server notice: %s", e.Last())
+		return
+	}
+	b.handleText(e, pbService.IRCMessage_NOTICE)
+}
+
+// handleText stores and broadcasts a PRIVMSG or NOTICE. Lines of a
+// chathistory batch go to the backfill that asked for them instead.
+func (b *IRCBot) handleText(e girc.Event, kind pbService.IRCMessage_Kind) *pbService.IRCMessage {
+	msg := textMessage(e, kind)
+	if msg == nil || b.collect(e, msg) {
+		return nil
+	}
+	b.record(msg.GetChannel(), messageEvent(msg))
+	return msg
+}
+
+// textMessage turns a PRIVMSG or NOTICE into a message, decoding any CTCP it
+// carries. It is stamped with the server's time when the server sends one,
+// and keeps the line's tags.
+func textMessage(e girc.Event, kind pbService.IRCMessage_Kind) *pbService.IRCMessage {
+	if e.Source == nil || len(e.Params) < 2 {
+		return nil
+	}
 	channel := e.Params[0]
 	content := e.Last()
 	sender := e.Source.Name
 
-	msg := &pbService.IRCMessage{
-		Timestamp: timestamppb.Now(),
+	// A message to our nick belongs in the query with its sender; the echo
+	// of one we sent, in the query with its target.
+	if !girc.IsValidChannel(channel) && !e.Echo {
+		channel = sender
+	}
+
+	if ctcp := girc.DecodeCTCP(&e); ctcp != nil {
+		if ctcp.Command == girc.CTCP_ACTION {
+			kind = pbService.IRCMessage_ACTION
+			content = ctcp.Text
+		} else {
+			kind = pbService.IRCMessage_CTCP
+			content = strings.TrimSpace(ctcp.Command + " " + ctcp.Text)
+		}
+	}
+
+	return &pbService.IRCMessage{
+		Timestamp: timestamppb.New(eventTime(e)),
 		Channel:   channel,
 		Sender:    sender,
 		Content:   content,
+		Kind:      kind,
+		Tags:      maps.Clone(e.Tags),
+	}
+}
+
+func (b *IRCBot) handleJoin(c *girc.Client, e girc.Event) {
+	if e.Source == nil || len(e.Params) == 0 {
+		return
+	}
+	channel := e.Params[0]
+
+	b.mu.Lock()
+	me := b.isMe(c, e.Source.Name)
+	if me {
+		// NAMES and the topic follow.
+		b.state[girc.ToRFC1459(channel)] = newChannelState(channel)
+	}
+	if st := b.channelState(channel); st != nil {
+		st.addMember(e.Source.Name, "")
+	}
+	b.mu.Unlock()
+
+	if me {
+		// Before the JOIN is recorded, so it waits for what we missed.
+		b.startBackfill(c, channel)
+	}
+
+	b.channelEvent(eventTime(e), &pbService.ChannelEvent{
+		Channel: channel,
+		Type:    pbService.ChannelEvent_JOIN,
+		Actor:   e.Source.Name,
+	})
+}
+
+func (b *IRCBot) handlePart(c *girc.Client, e girc.Event) {
+	if e.Source == nil || len(e.Params) == 0 {
+		return
+	}
+	channel := e.Params[0]
+
+	b.mu.Lock()
+	b.removeMember(c, channel, e.Source.Name)
+	b.mu.Unlock()
+
+	ce := &pbService.ChannelEvent{
+		Channel: channel,
+		Type:    pbService.ChannelEvent_PART,
+		Actor:   e.Source.Name,
+	}
+	if len(e.Params) > 1 {
+		ce.Reason = e.Last()
+	}
+	b.channelEvent(eventTime(e), ce)
+}
+
+func (b *IRCBot) handleKick(c *girc.Client, e girc.Event) {
+	if e.Source == nil || len(e.Params) < 2 {
+		return
+	}
+	channel, target := e.Params[0], e.Params[1]
+
+	b.mu.Lock()
+	b.removeMember(c, channel, target)
+	b.mu.Unlock()
+
+	ce := &pbService.ChannelEvent{
+		Channel: channel,
+		Type:    pbService.ChannelEvent_KICK,
+		Actor:   e.Source.Name,
+		Target:  target,
+	}
+	if len(e.Params) > 2 {
+		ce.Reason = e.Last()
+	}
+	b.channelEvent(eventTime(e), ce)
+}
+
+func (b *IRCBot) handleQuit(c *girc.Client, e girc.Event) {
+	if e.Source == nil {
+		return
+	}
+	b.mu.Lock()
+	var channels []string
+	for _, st := range b.state {
+		if st.removeMember(e.Source.Name) {
+			channels = append(channels, st.name)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, ch := range channels {
+		b.channelEvent(eventTime(e), &pbService.ChannelEvent{
+			Channel: ch,
+			Type:    pbService.ChannelEvent_QUIT,
+			Actor:   e.Source.Name,
+			Reason:  e.Last(),
+		})
+	}
+}
+
+func (b *IRCBot) handleNick(c *girc.Client, e girc.Event) {
+	if e.Source == nil || len(e.Params) == 0 {
+		return
+	}
+	oldNick, newNick := e.Source.Name, e.Last()
+
+	b.mu.Lock()
+	var channels []string
+	for _, st := range b.state {
+		if st.renameMember(oldNick, newNick) {
+			channels = append(channels, st.name)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, ch := range channels {
+		b.channelEvent(eventTime(e), &pbService.ChannelEvent{
+			Channel: ch,
+			Type:    pbService.ChannelEvent_NICK,
+			Actor:   oldNick,
+			OldNick: oldNick,
+			NewNick: newNick,
+		})
+	}
+
+	// girc renames us in its own handler, which runs alongside this one.
+	if b.isMe(c, oldNick) || b.isMe(c, newNick) {
+		b.nickChanged(newNick)
+		if girc.ToRFC1459(newNick) == girc.ToRFC1459(b.nicks[0]) && hasMonitor(c) {
+			c.Send(&girc.Event{Command: "MONITOR", Params: []string{"-", newNick}})
+		}
+	}
+}
+
+func (b *IRCBot) handleTopic(c *girc.Client, e girc.Event) {
+	if e.Source == nil || len(e.Params) == 0 {
+		return
+	}
+	topic := ""
+	if len(e.Params) > 1 {
+		topic = e.Last()
 	}
 
-	// Store in history
+	b.mu.Lock()
+	if st := b.channelState(e.Params[0]); st != nil {
+		st.setTopic(topic, e.Source.Name, eventTime(e))
+	}
+	b.mu.Unlock()
+
+	b.channelEvent(eventTime(e), &pbService.ChannelEvent{
+		Channel: e.Params[0],
+		Type:    pbService.ChannelEvent_TOPIC,
+		Actor:   e.Source.Name,
+		Topic:   topic,
+	})
+}
+
+func (b *IRCBot) handleMode(c *girc.Client, e girc.Event) {
+	// User modes (MODE <our nick> ...) aren't about a channel.
+	if e.Source == nil || len(e.Params) < 2 || !girc.IsValidChannel(e.Params[0]) {
+		return
+	}
+
+	b.mu.Lock()
+	if st := b.channelState(e.Params[0]); st != nil {
+		st.applyModes(serverModes(c), e.Params[1:])
+	}
+	b.mu.Unlock()
+
+	b.channelEvent(eventTime(e), &pbService.ChannelEvent{
+		Channel: e.Params[0],
+		Type:    pbService.ChannelEvent_MODE,
+		Actor:   e.Source.Name,
+		Mode:    strings.Join(e.Params[1:], " "),
+	})
+}
+
+// handleNames records the members listed in a NAMES reply:
+// "353 <me> <type> <channel> :[prefixes]nick ...".
+func (b *IRCBot) handleNames(c *girc.Client, e girc.Event) {
+	if len(e.Params) < 4 {
+		return
+	}
+	mi := serverModes(c)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.channelState(e.Params[2])
+	if st == nil {
+		// A channel we aren't in.
+		return
+	}
+	for _, name := range strings.Fields(e.Last()) {
+		prefixes, nick := mi.splitPrefixes(name)
+		st.addMember(nick, prefixes)
+	}
+}
+
+// handleTopicReply records the topic sent on join: "332 <me> <channel> :topic".
+func (b *IRCBot) handleTopicReply(c *girc.Client, e girc.Event) {
+	if len(e.Params) < 3 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if st := b.channelState(e.Params[1]); st != nil {
+		st.topic = e.Last()
+	}
+}
+
+// handleTopicWhoTime records who set the topic and when:
+// "333 <me> <channel> <setter> <unix time>".
+func (b *IRCBot) handleTopicWhoTime(c *girc.Client, e girc.Event) {
+	if len(e.Params) < 4 {
+		return
+	}
+	setter, _, _ := strings.Cut(e.Params[2], "!")
+	secs, err := strconv.ParseInt(e.Params[3], 10, 64)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.channelState(e.Params[1])
+	if st == nil {
+		return
+	}
+	st.topicSetBy = setter
+	st.topicSetAt = time.Unix(secs, 0)
+}
+
+// handleChannelModes records the modes of a channel:
+// "324 <me> <channel> <modes> [args...]".
+func (b *IRCBot) handleChannelModes(c *girc.Client, e girc.Event) {
+	if len(e.Params) < 3 {
+		return
+	}
+	mi := serverModes(c)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.channelState(e.Params[1])
+	if st == nil {
+		return
+	}
+	st.modes = make(map[byte]string)
+	st.applyModes(mi, e.Params[2:])
+}
+
+// channelState returns the state of a channel we are in, or nil. Only our
+// own JOIN creates it: replies about other channels are ignored. Must be
+// called with b.mu held.
+func (b *IRCBot) channelState(channel string) *channelState {
+	return b.state[girc.ToRFC1459(channel)]
+}
+
+// removeMember must be called with b.mu held. When we are the one leaving,
+// the whole channel is forgotten.
+func (b *IRCBot) removeMember(c *girc.Client, channel, nick string) {
+	if b.isMe(c, nick) {
+		delete(b.state, girc.ToRFC1459(channel))
+		return
+	}
+	if st := b.channelState(channel); st != nil {
+		st.removeMember(nick)
+	}
+}
+
+// ChannelState returns a snapshot of a channel the bot is in, or nil.
+func (b *IRCBot) ChannelState(channel string) *pbService.ChannelState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	st := b.channelState(channel)
+	if st == nil {
+		return nil
+	}
+	return b.snapshot(st)
+}
+
+// snapshot copies a channel's state for clients.
+func (b *IRCBot) snapshot(st *channelState) *pbService.ChannelState {
+	snap := st.snapshot(st.name)
+	snap.Network = b.network
+	return snap
+}
+
+// SendQueueStatus returns the lines waiting for flood control.
+func (b *IRCBot) SendQueueStatus() *pbService.SendQueueStatus {
+	st := b.queue.snapshot()
+	st.Network = b.network
+	return st
+}
+
+// ChannelStates returns snapshots of all channels the bot is in.
+func (b *IRCBot) ChannelStates() []*pbService.ChannelState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var states []*pbService.ChannelState
+	for _, st := range b.state {
+		states = append(states, b.snapshot(st))
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].GetChannel() < states[j].GetChannel() })
+	return states
+}
+
+func (b *IRCBot) isMe(c *girc.Client, nick string) bool {
+	return girc.ToRFC1459(nick) == girc.ToRFC1459(c.GetNick())
+}
+
+// eventTime returns when e happened: the server's time with server-time,
+// else when it arrived. Events made up locally have neither.
+func eventTime(e girc.Event) time.Time {
+	if e.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return e.Timestamp
+}
+
+// channelEvent stamps a channel event with when it happened, stores it and
+// sends it to clients.
+func (b *IRCBot) channelEvent(when time.Time, ce *pbService.ChannelEvent) {
+	ce.Timestamp = timestamppb.New(when)
+	b.record(ce.GetChannel(), channelEvent(ce))
+}
+
+// record stores an event in the channel's history (which assigns its ID)
+// and broadcasts it to gRPC clients. While the channel's history is being
+// filled in, it waits until that is done.
+func (b *IRCBot) record(channel string, ev *pbService.StreamEvent) {
+	if b.hold(channel, ev) {
+		return
+	}
+	b.store(channel, ev)
+}
+
+// store records an event right away.
+func (b *IRCBot) store(channel string, ev *pbService.StreamEvent) {
+	setNetwork(ev, b.network)
 	if buf := b.history(channel); buf != nil {
-		buf.Add(msg)
+		if err := buf.Add(ev); err != nil {
+			log.Printf("Failed to store event for %s: %v", channel, err)
+		}
+	}
+	b.broadcast(ev)
+}
+
+// handleCap notes the draft/multiline limits from the server's CAP LS or NEW,
+// e.g. "draft/multiline=max-bytes=4096,max-lines=24".
+func (b *IRCBot) handleCap(c *girc.Client, e girc.Event) {
+	if len(e.Params) < 3 || (e.Params[1] != girc.CAP_LS && e.Params[1] != girc.CAP_NEW) {
+		return
 	}
+	for _, capability := range strings.Fields(e.Last()) {
+		if name, value, _ := strings.Cut(capability, "="); name == multilineCap {
+			b.mu.Lock()
+			b.mlLimits = parseMultilineCap(value)
+			b.mu.Unlock()
+		}
+	}
+}
+
+// handleSASLFailure notes a failed login; girc closes the connection after it.
+func (b *IRCBot) handleSASLFailure(c *girc.Client, e girc.Event) {
+	reason := e.Last()
+	if e.Command == girc.RPL_SASLMECHS && len(e.Params) >= 3 {
+		reason = fmt.Sprintf("mechanism not supported by server (it offers %s)", e.Params[len(e.Params)-2])
+	}
+
+	b.mu.Lock()
+	b.saslFail = reason
+	b.mu.Unlock()
 
-	// Broadcast to gRPC clients
-	b.broadcast(msg)
+	log.Printf("SASL authentication failed: %s", reason)
+	b.systemMessage(fmt.Sprintf("SASL authentication failed: %s", reason))
 }
 
-func (b *IRCBot) handleJoin(c *girc.Client, e girc.Event) {
-	// Handle join events if needed (maybe system message?)
+// handleLoggedIn reports a successful login: "900 <nick> <mask> <account> :text".
+// Channels waiting for it are joined.
+func (b *IRCBot) handleLoggedIn(c *girc.Client, e girc.Event) {
+	if len(e.Params) < 3 {
+		return
+	}
+	b.mu.Lock()
+	b.account = e.Params[2]
+	if b.joinTimer != nil {
+		b.sendJoins(c)
+	}
+	b.mu.Unlock()
+	b.systemMessage(fmt.Sprintf("Logged in as %s", e.Params[2]))
+}
+
+// systemMessage tells attached clients about a change in the bot's state.
+func (b *IRCBot) systemMessage(content string) {
+	b.broadcast(systemEvent(&pbService.SystemMessage{
+		Timestamp: timestamppb.Now(),
+		Content:   content,
+	}))
+}
+
+// secondsOr converts a config value in seconds, using def if it is unset.
+func secondsOr(secs int32, def time.Duration) time.Duration {
+	if secs <= 0 {
+		return def
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// saslMech builds the girc SASL mechanism for a config. EXTERNAL also returns
+// the client certificate to present during the TLS handshake.
+func saslMech(cfg *pbConfig.SASL, useTLS bool) (girc.SASLMech, *tls.Certificate, error) {
+	switch cfg.GetMechanism() {
+	case pbConfig.SASL_EXTERNAL:
+		if !useTLS {
+			return nil, nil, errors.New("SASL EXTERNAL requires use_tls")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.GetCertFile(), cfg.GetKeyFile())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load SASL client certificate: %v", err)
+		}
+		return &girc.SASLExternal{}, &cert, nil
+	default:
+		if cfg.GetUsername() == "" || cfg.GetPassword() == "" {
+			return nil, nil, errors.New("SASL PLAIN requires a username and password")
+		}
+		return &girc.SASLPlain{User: cfg.GetUsername(), Pass: cfg.GetPassword()}, nil, nil
+	}
 }
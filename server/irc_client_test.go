@@ -1,27 +1,38 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/lrstanley/girc"
+	"github.com/morrowc/irc-bot/backoff"
 	"github.com/morrowc/irc-bot/server/history"
 
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
 	pbService "github.com/morrowc/irc-bot/proto/service"
 )
 
 func TestHandlePrivMsg(t *testing.T) {
 	// Mocks
 	var storedMsg *pbService.IRCMessage
-	historyFunc := func(channel string) *history.ChannelBuffer {
+	historyFunc := func(channel string) history.Store {
 		if channel != "#test" {
 			t.Errorf("Expected #test, got %s", channel)
 		}
 		return history.NewChannelBuffer(10)
 	}
 
-	broadcastFunc := func(msg *pbService.IRCMessage) {
-		storedMsg = msg
+	broadcastFunc := func(ev *pbService.StreamEvent) {
+		storedMsg = ev.GetMessage()
 	}
 
 	bot := &IRCBot{
@@ -51,6 +62,564 @@ func TestHandlePrivMsg(t *testing.T) {
 	if storedMsg.Sender != "sender_nick" {
 		t.Errorf("Expected 'sender_nick', got '%s'", storedMsg.Sender)
 	}
+
+	// With server-time, the message keeps the server's time and its tags.
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	bot.handlePrivMsg(nil, *girc.ParseEvent("@time=2024-05-01T12:00:00.000Z;account=bob :bob!b@example.com PRIVMSG #test :late"))
+	if !storedMsg.GetTimestamp().AsTime().Equal(when) {
+		t.Errorf("Expected the server's time %v, got %v", when, storedMsg.GetTimestamp().AsTime())
+	}
+	if storedMsg.GetTags()["account"] != "bob" {
+		t.Errorf("Expected the account tag, got %v", storedMsg.GetTags())
+	}
+}
+
+func TestHandlePrivMsg_Query(t *testing.T) {
+	var asked []string
+	var got *pbService.IRCMessage
+	bot := &IRCBot{
+		history: func(name string) history.Store {
+			asked = append(asked, name)
+			return nil
+		},
+		broadcast: func(ev *pbService.StreamEvent) {
+			got = ev.GetMessage()
+		},
+	}
+
+	// A DM to our nick is filed under the sender, not under us.
+	bot.handlePrivMsg(nil, girc.Event{
+		Command: girc.PRIVMSG,
+		Params:  []string{"testbot", "psst"},
+		Source:  &girc.Source{Name: "alice"},
+	})
+	if len(asked) != 1 || asked[0] != "alice" || got.GetChannel() != "alice" {
+		t.Errorf("Expected query with alice, got history for %v and channel %q", asked, got.GetChannel())
+	}
+}
+
+func TestHandleText_Kinds(t *testing.T) {
+	var got *pbService.IRCMessage
+	bot := &IRCBot{
+		history:   func(string) history.Store { return nil },
+		broadcast: func(ev *pbService.StreamEvent) { got = ev.GetMessage() },
+	}
+	user := &girc.Source{Name: "alice", Ident: "a", Host: "example.com"}
+
+	tests := []struct {
+		desc        string
+		command     string
+		source      *girc.Source
+		text        string
+		wantKind    pbService.IRCMessage_Kind
+		wantContent string
+	}{
+		{"action", girc.PRIVMSG, user, "\x01ACTION waves\x01", pbService.IRCMessage_ACTION, "waves"},
+		{"ctcp request", girc.PRIVMSG, user, "\x01VERSION\x01", pbService.IRCMessage_CTCP, "VERSION"},
+		{"notice", girc.NOTICE, user, "heads up", pbService.IRCMessage_NOTICE, "heads up"},
+		{"ctcp reply", girc.NOTICE, user, "\x01PING 123\x01", pbService.IRCMessage_CTCP, "PING 123"},
+		{"server notice", girc.NOTICE, &girc.Source{Name: "irc.example.com"}, "*** Looking up your hostname", 0, ""},
+	}
+	for _, tt := range tests {
+		got = nil
+		e := girc.Event{Command: tt.command, Params: []string{"#test", tt.text}, Source: tt.source}
+		if tt.command == girc.NOTICE {
+			bot.handleNotice(nil, e)
+		} else {
+			bot.handlePrivMsg(nil, e)
+		}
+		if tt.wantContent == "" {
+			if got != nil {
+				t.Errorf("%s: expected nothing to be stored, got %v", tt.desc, got)
+			}
+			continue
+		}
+		if got.GetKind() != tt.wantKind || got.GetContent() != tt.wantContent {
+			t.Errorf("%s: got %s %q, want %s %q", tt.desc, got.GetKind(), got.GetContent(), tt.wantKind, tt.wantContent)
+		}
+	}
+}
+
+func TestCheckSend(t *testing.T) {
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{Nick: "testbot"}, nil, func(string) history.Store { return nil }, func(*pbService.StreamEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.handleJoin(bot.client, girc.Event{Source: &girc.Source{Name: "testbot"}, Params: []string{"#Test"}})
+
+	// Room left for a CTCP to #test, between its \x01 delimiters.
+	room := bot.maxPayload(girc.PRIVMSG, "#test", pbService.IRCMessage_CTCP)
+	if want := bot.client.MaxEventLength() - len("PRIVMSG #test :\x01\x01"); room != want {
+		t.Errorf("Expected %d bytes of room before our host is known, got %d", want, room)
+	}
+
+	tests := []struct {
+		desc    string
+		target  string
+		message string
+		kind    pbService.IRCMessage_Kind
+		wantErr string
+	}{
+		{"joined channel", "#test", "hello there", pbService.IRCMessage_PRIVMSG, ""},
+		{"nick", "alice", "hi", pbService.IRCMessage_NOTICE, ""},
+		{"not joined", "#other", "hi", pbService.IRCMessage_PRIVMSG, "not in channel"},
+		{"invalid target", "bad nick", "hi", pbService.IRCMessage_PRIVMSG, "invalid target"},
+		{"empty", "#test", "", pbService.IRCMessage_PRIVMSG, "empty"},
+		{"blank lines", "#test", " \r\n\n", pbService.IRCMessage_PRIVMSG, "empty"},
+		{"long text is split", "#test", strings.Repeat("x ", room), pbService.IRCMessage_PRIVMSG, ""},
+		{"several lines", "#test", "one\ntwo", pbService.IRCMessage_ACTION, ""},
+		{"ctcp line break", "#test", "PING 1\r\nQUIT", pbService.IRCMessage_CTCP, "line break"},
+		{"ctcp at the limit", "#test", strings.Repeat("x", room), pbService.IRCMessage_CTCP, ""},
+		{"ctcp over the limit", "#test", strings.Repeat("x", room+1), pbService.IRCMessage_CTCP, "too long"},
+	}
+	for _, tt := range tests {
+		err := bot.checkSend(tt.target, tt.message, tt.kind)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.desc, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.desc, tt.wantErr, err)
+		}
+	}
+
+	if _, err := bot.Send("#test", "hello", pbService.IRCMessage_PRIVMSG, nil); err != errNotConnected {
+		t.Errorf("Expected errNotConnected, got %v", err)
+	}
+}
+
+// fakeLineServer registers a single client, offering caps, and passes on
+// every line it receives. With echo-message, it echoes PRIVMSGs back.
+func fakeLineServer(t *testing.T, caps string) (*pbConfig.Endpoint, <-chan string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case strings.HasPrefix(line, "CAP LS"):
+				fmt.Fprintf(conn, ":irc.test CAP * LS :%s\r\n", caps)
+			case strings.HasPrefix(line, "CAP REQ"):
+				fmt.Fprintf(conn, ":irc.test CAP * ACK :%s\r\n", strings.TrimPrefix(line, "CAP REQ :"))
+			case strings.HasPrefix(line, "USER "):
+				fmt.Fprint(conn, ":irc.test 001 testbot :Welcome\r\n")
+			case strings.HasPrefix(line, "PRIVMSG ") && strings.Contains(caps, echoCap):
+				fmt.Fprintf(conn, "@time=2024-05-01T12:00:00.000Z;msgid=m1 :testbot!bot@example.com %s\r\n", line)
+			}
+			lines <- line
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+	return &pbConfig.Endpoint{Host: "127.0.0.1", Port: int32(addr.Port)}, lines
+}
+
+func TestSend_Splits(t *testing.T) {
+	text := strings.Repeat("a fairly long paragraph of pasted text ", 30)
+
+	for _, multiline := range []bool{false, true} {
+		srv, lines := fakeLineServer(t, "batch message-tags draft/multiline=max-bytes=800")
+		var sent []*pbService.IRCMessage
+		var mu sync.Mutex
+		bot, err := NewIRCBot("", &pbConfig.IRCServer{
+			Host:      srv.GetHost(),
+			Port:      srv.GetPort(),
+			Nick:      "testbot",
+			User:      "testbot",
+			Multiline: multiline,
+			SendBurst: 100,
+		}, nil, func(string) history.Store { return history.NewChannelBuffer(100) }, func(ev *pbService.StreamEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			if msg := ev.GetMessage(); msg != nil {
+				sent = append(sent, msg)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			bot.Run(ctx)
+			close(done)
+		}()
+		for line := range lines {
+			if strings.HasPrefix(line, "USER ") {
+				break
+			}
+		}
+		if multiline {
+			deadline := time.Now().Add(time.Second)
+			for !bot.client.HasCapability(multilineCap) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		acked := make(chan []*pbService.IRCMessage, 1)
+		ids, err := bot.Send("alice", text, pbService.IRCMessage_PRIVMSG, func(lines []*pbService.IRCMessage, err error) {
+			if err != nil {
+				t.Errorf("multiline=%v: send failed: %v", multiline, err)
+			}
+			acked <- lines
+		})
+		if err != nil {
+			t.Fatalf("multiline=%v: Send failed: %v", multiline, err)
+		}
+
+		// Collect what went out, up to the last line.
+		var got []string
+		var batches int
+		var joined strings.Builder
+		for len(got) < len(ids) {
+			select {
+			case line := <-lines:
+				if strings.HasPrefix(line, "BATCH +") {
+					batches++
+				}
+				_, msg, ok := strings.Cut(line, "PRIVMSG alice :")
+				if !ok {
+					continue
+				}
+				if len(msg)+len("PRIVMSG alice :")+girc.DefaultMaxPrefixLength > girc.DefaultMaxLineLength {
+					t.Errorf("multiline=%v: line too long: %q", multiline, line)
+				}
+				if multiline && !strings.HasPrefix(line, "@batch=") {
+					t.Errorf("multiline=%v: expected a batched line, got %q", multiline, line)
+				}
+				got = append(got, msg)
+				joined.WriteString(msg)
+			case <-time.After(time.Second):
+				t.Fatalf("multiline=%v: got %d of %d lines", multiline, len(got), len(ids))
+			}
+		}
+		if joined.String() != text {
+			t.Errorf("multiline=%v: lines don't add up to the message:\n%q", multiline, joined.String())
+		}
+		if wantBatches := map[bool]int{false: 0, true: 2}[multiline]; batches != wantBatches {
+			t.Errorf("multiline=%v: expected %d batches, got %d", multiline, wantBatches, batches)
+		}
+
+		// History has each line as it was sent, once it has been.
+		deadline := time.Now().Add(time.Second)
+		for {
+			mu.Lock()
+			n := len(sent)
+			mu.Unlock()
+			if n >= len(got) || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		mu.Lock()
+		if len(sent) != len(got) || sent[0].GetContent() != got[0] {
+			t.Errorf("multiline=%v: expected %d echoed lines, got %d", multiline, len(got), len(sent))
+		}
+		mu.Unlock()
+
+		// The sender hears once all of them are in, with their IDs.
+		select {
+		case kept := <-acked:
+			mu.Lock()
+			for i, msg := range kept {
+				if msg.GetId() == 0 || msg.GetId() != sent[i].GetId() {
+					t.Errorf("multiline=%v: expected line %d to be kept with ID %d, got %v", multiline, i, sent[i].GetId(), msg)
+				}
+			}
+			mu.Unlock()
+		case <-time.After(time.Second):
+			t.Errorf("multiline=%v: the send was never acknowledged", multiline)
+		}
+
+		cancel()
+		bot.Close()
+		<-done
+	}
+}
+
+func TestSend_EchoMessage(t *testing.T) {
+	srv, lines := fakeLineServer(t, "echo-message server-time message-tags")
+	buf := history.NewChannelBuffer(10)
+	echoed := make(chan *pbService.IRCMessage, 10)
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{
+		Host: srv.GetHost(),
+		Port: srv.GetPort(),
+		Nick: "testbot",
+		User: "testbot",
+	}, nil, func(string) history.Store { return buf }, func(ev *pbService.StreamEvent) {
+		if msg := ev.GetMessage(); msg != nil {
+			echoed <- msg
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bot.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		bot.Close()
+		<-done
+	}()
+	for line := range lines {
+		if strings.HasPrefix(line, "CAP REQ") && !strings.Contains(line, echoCap) {
+			t.Errorf("Expected echo-message to be requested, got %q", line)
+		}
+		if strings.HasPrefix(line, "USER ") {
+			break
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for !bot.client.HasCapability(echoCap) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Nothing is kept until the server echoes the line.
+	acked := make(chan []*pbService.IRCMessage, 1)
+	sent, err := bot.Send("alice", "hello", pbService.IRCMessage_PRIVMSG, func(lines []*pbService.IRCMessage, err error) {
+		if err != nil {
+			t.Errorf("Send failed: %v", err)
+		}
+		acked <- lines
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if len(sent) != 1 || sent[0].GetId() != 0 || sent[0].GetContent() != "hello" {
+		t.Errorf("Expected one line without an ID, got %v", sent)
+	}
+
+	select {
+	case msg := <-echoed:
+		when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		if msg.GetChannel() != "alice" || msg.GetSender() != "testbot" || msg.GetContent() != "hello" {
+			t.Errorf("Expected our line to alice, got %v", msg)
+		}
+		if !msg.GetTimestamp().AsTime().Equal(when) || msg.GetTags()["msgid"] != "m1" {
+			t.Errorf("Expected the server's time and tags, got %v", msg)
+		}
+		if evs := buf.GetSince(time.Time{}); msg.GetId() == 0 || len(evs) != 1 {
+			t.Errorf("Expected the echo in history, got ID %d and %d events", msg.GetId(), len(evs))
+		}
+		select {
+		case kept := <-acked:
+			if len(kept) != 1 || kept[0].GetId() != msg.GetId() {
+				t.Errorf("Expected the send to be acknowledged with ID %d, got %v", msg.GetId(), kept)
+			}
+		case <-time.After(time.Second):
+			t.Error("The send was never acknowledged")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("The echo was never recorded")
+	}
+
+	// Our own CTCP queries aren't answered when they come back, whether
+	// girc knows them or not.
+	for _, query := range []string{"VERSION", "PING 123", "FOO bar"} {
+		if _, err := bot.Send("alice", query, pbService.IRCMessage_CTCP, nil); err != nil {
+			t.Fatalf("Send %q failed: %v", query, err)
+		}
+	}
+	for timeout := time.After(500 * time.Millisecond); ; {
+		select {
+		case line := <-lines:
+			if strings.HasPrefix(line, "NOTICE testbot ") {
+				t.Errorf("Expected no CTCP reply to ourselves, got %q", line)
+			}
+			continue
+		case <-timeout:
+		}
+		break
+	}
+}
+
+func TestSendTracker(t *testing.T) {
+	a := &pbService.IRCMessage{Content: "a"}
+	b := &pbService.IRCMessage{Content: "b"}
+	var calls int
+	var lines []*pbService.IRCMessage
+	var outcome error
+	sent := func(msgs []*pbService.IRCMessage, err error) {
+		calls++
+		lines, outcome = msgs, err
+	}
+
+	// Told once, when the last line is kept.
+	tr := newSendTracker([]*pbService.IRCMessage{a, b}, sent)
+	tr.kept(1, &pbService.IRCMessage{Content: "b", Id: 2})
+	if calls != 0 {
+		t.Fatal("Expected no word before every line is kept")
+	}
+	tr.kept(0, &pbService.IRCMessage{Content: "a", Id: 1})
+	if calls != 1 || outcome != nil || lines[0].GetId() != 1 || lines[1].GetId() != 2 {
+		t.Errorf("Expected both lines with their IDs, got %d calls: %v, %v", calls, lines, outcome)
+	}
+
+	// A dropped line fails the send, and nothing after that counts.
+	calls = 0
+	tr = newSendTracker([]*pbService.IRCMessage{a, b}, sent)
+	tr.kept(0, &pbService.IRCMessage{Content: "a", Id: 1})
+	tr.failed(errDropped)
+	tr.kept(1, &pbService.IRCMessage{Content: "b", Id: 2})
+	if calls != 1 || outcome != errDropped || lines[0].GetId() != 1 || lines[1] != b {
+		t.Errorf("Expected one failure with the line that was kept, got %d calls: %v, %v", calls, lines, outcome)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tb := newTokenBucket(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if ok, _ := tb.take(now); !ok {
+			t.Fatalf("Expected the burst to allow send %d", i)
+		}
+	}
+	if ok, wait := tb.take(now); ok || wait != 500*time.Millisecond {
+		t.Errorf("Expected to wait 500ms after the burst, got ok=%v wait=%v", ok, wait)
+	}
+	if ok, _ := tb.take(now.Add(500 * time.Millisecond)); !ok {
+		t.Error("Expected a token after 500ms")
+	}
+	if tb.full(now.Add(time.Second)) || !tb.full(now.Add(2*time.Second)) {
+		t.Error("Expected the bucket to refill in 1.5s")
+	}
+
+	// Taking more than there is leaves the bucket owing the rest.
+	tb = newTokenBucket(2, 3)
+	if ok, _ := tb.takeN(now, 5); !ok {
+		t.Fatal("Expected 5 tokens to be taken out of a full bucket")
+	}
+	if ok, wait := tb.take(now); ok || wait != 1500*time.Millisecond {
+		t.Errorf("Expected to wait 1.5s to pay off 2 tokens, got ok=%v wait=%v", ok, wait)
+	}
+}
+
+func TestSendQueue(t *testing.T) {
+	line := func(target, text string) []*queuedItem {
+		return []*queuedItem{{events: []*girc.Event{{Command: girc.PRIVMSG, Params: []string{target, text}}}}}
+	}
+
+	for _, fair := range []bool{false, true} {
+		// The queue reports itself empty once, after the last write.
+		var mu sync.Mutex
+		var last *pbService.SendQueueStatus
+		done := make(chan struct{})
+		q := newSendQueue(&pbConfig.IRCServer{SendBurst: 10, SendRate: 1000, SendFair: fair}, func(st *pbService.SendQueueStatus) {
+			mu.Lock()
+			defer mu.Unlock()
+			last = st
+			if st.GetDepth() == 0 {
+				close(done)
+			}
+		})
+		q.push("#a", append(line("#a", "a1"), line("#a", "a2")...))
+		q.push("#a", line("#a", "a3"))
+		q.push("#b", line("#b", "b1"))
+		if st := q.snapshot(); st.GetDepth() != 4 || st.GetTargets()["#a"] != 3 || st.GetTargets()["#b"] != 1 {
+			t.Errorf("fair=%v: unexpected status %v", fair, st)
+		}
+
+		var sent []string
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			q.run(ctx, func(e *girc.Event) error {
+				sent = append(sent, e.Last())
+				return nil
+			})
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("fair=%v: queue not reported empty", fair)
+		}
+		cancel()
+
+		want := "a1 a2 a3 b1"
+		if fair {
+			want = "a1 b1 a2 a3"
+		}
+		if got := strings.Join(sent, " "); got != want {
+			t.Errorf("fair=%v: sent %q, want %q", fair, got, want)
+		}
+		mu.Lock()
+		if last.GetDepth() != 0 || len(last.GetTargets()) != 0 {
+			t.Errorf("fair=%v: expected an empty queue to be reported last, got %v", fair, last)
+		}
+		mu.Unlock()
+	}
+
+	// Too much at once is refused; a disconnect drops what's waiting.
+	q := newSendQueue(&pbConfig.IRCServer{}, func(*pbService.SendQueueStatus) {})
+	if q.push("#a", []*queuedItem{{events: make([]*girc.Event, maxQueuedLines+1)}}) {
+		t.Error("Expected a message over the queue limit to be refused")
+	}
+	var outcome error
+	x := line("#a", "x")
+	x[0].done = func(err error) { outcome = err }
+	q.push("#a", x)
+	q.push("bob", line("bob", "y"))
+	if dropped := q.clear(); dropped["#a"] != 1 || dropped["bob"] != 1 || q.snapshot().GetDepth() != 0 {
+		t.Errorf("Expected one line each dropped, got %v", dropped)
+	}
+	if outcome != errDropped {
+		t.Errorf("Expected the dropped line to be told so, got %v", outcome)
+	}
+
+	// A batch goes out in one piece, however fair the queue, and takes a
+	// token for each of its lines.
+	q = newSendQueue(&pbConfig.IRCServer{SendBurst: 4, SendRate: 0.001, SendFair: true}, func(*pbService.SendQueueStatus) {})
+	outcomes := make(chan error, 1)
+	q.push("#a", []*queuedItem{{events: []*girc.Event{
+		{Command: "BATCH", Params: []string{"+ml1", multilineCap, "#a"}},
+		{Command: girc.PRIVMSG, Params: []string{"#a", "a1"}},
+		{Command: girc.PRIVMSG, Params: []string{"#a", "a2"}},
+		{Command: "BATCH", Params: []string{"-ml1"}},
+	}, done: func(err error) { outcomes <- err }}})
+	q.push("#b", line("#b", "b1"))
+	written := make(chan string, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.run(ctx, func(e *girc.Event) error {
+		written <- e.Command + " " + e.Params[0]
+		return nil
+	})
+	var sent []string
+	for len(sent) < 4 {
+		select {
+		case line := <-written:
+			sent = append(sent, line)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the whole batch to be sent, got %v", sent)
+		}
+	}
+	if got := strings.Join(sent, ", "); got != "BATCH +ml1, PRIVMSG #a, PRIVMSG #a, BATCH -ml1" {
+		t.Errorf("Expected the batch in one piece, got %q", got)
+	}
+	if err := <-outcomes; err != nil {
+		t.Errorf("Expected the batch to be reported written, got %v", err)
+	}
+	select {
+	case line := <-written:
+		t.Errorf("Expected %q to wait for the bucket to refill", line)
+	case <-time.After(50 * time.Millisecond):
+	}
 }
 
 func TestHandleJoin(t *testing.T) {
@@ -58,3 +627,340 @@ func TestHandleJoin(t *testing.T) {
 	// Should not panic
 	bot.handleJoin(nil, girc.Event{})
 }
+
+func TestChannelEvents(t *testing.T) {
+	bufs := map[string]history.Store{
+		"#a": history.NewChannelBuffer(10),
+		"#b": history.NewChannelBuffer(10),
+	}
+	var events []*pbService.ChannelEvent
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{Nick: "testbot"}, nil, func(ch string) history.Store {
+		return bufs[ch]
+	}, func(ev *pbService.StreamEvent) {
+		if ce := ev.GetChannelEvent(); ce != nil {
+			events = append(events, ce)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := bot.client
+	src := func(nick string) *girc.Source { return &girc.Source{Name: nick} }
+
+	// We join both channels; alice is in both, bob only in #b.
+	bot.handleJoin(c, girc.Event{Source: src("testbot"), Params: []string{"#a"}})
+	bot.handleJoin(c, girc.Event{Source: src("testbot"), Params: []string{"#b"}})
+	bot.handleNames(c, girc.Event{Params: []string{"testbot", "=", "#a", "@alice testbot"}})
+	bot.handleNames(c, girc.Event{Params: []string{"testbot", "=", "#b", "alice +bob testbot"}})
+	events = nil
+
+	bot.handleNick(c, girc.Event{Source: src("Alice"), Params: []string{"alice2"}})
+	bot.handleKick(c, girc.Event{Source: src("alice2"), Params: []string{"#b", "bob", "bye"}})
+	bot.handleQuit(c, girc.Event{Source: src("alice2"), Params: []string{"Quit: gone"}})
+	bot.handleMode(c, girc.Event{Source: src("op"), Params: []string{"#a", "+o", "testbot"}})
+	bot.handleMode(c, girc.Event{Source: src("testbot"), Params: []string{"testbot", "+i"}})
+	bot.handleTopic(c, girc.Event{Source: src("op"), Params: []string{"#a", "new topic"}})
+
+	var got []string
+	for _, ce := range events {
+		got = append(got, fmt.Sprintf("%s %s %s/%s/%s/%s/%s/%s", ce.GetChannel(), ce.GetType(), ce.GetActor(), ce.GetTarget(), ce.GetReason(), ce.GetNewNick(), ce.GetTopic(), ce.GetMode()))
+	}
+	// Per-channel events for NICK and QUIT come in map order.
+	sort.Strings(got)
+	want := []string{
+		"#a MODE op/////+o testbot",
+		"#a NICK Alice///alice2//",
+		"#a QUIT alice2//Quit: gone///",
+		"#a TOPIC op////new topic/",
+		"#b KICK alice2/bob/bye///",
+		"#b NICK Alice///alice2//",
+		"#b QUIT alice2//Quit: gone///",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected channel events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The events are in the channel's history alongside messages.
+	if evs := bufs["#b"].GetSince(time.Time{}); len(evs) != 4 || evs[0].GetChannelEvent().GetType() != pbService.ChannelEvent_JOIN {
+		t.Errorf("Expected join, nick, kick and quit in #b history, got %v", evs)
+	}
+}
+
+func TestChannelStateReplies(t *testing.T) {
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{Nick: "testbot"}, nil, func(string) history.Store { return nil }, func(*pbService.StreamEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := bot.client
+
+	// The server may spell the channel differently from our JOIN.
+	bot.handleJoin(c, girc.Event{Source: &girc.Source{Name: "testbot"}, Params: []string{"#Test"}})
+	bot.handleTopicReply(c, girc.Event{Params: []string{"testbot", "#test", "Welcome to #test"}})
+	bot.handleTopicWhoTime(c, girc.Event{Params: []string{"testbot", "#test", "op!op@host", "1700000000"}})
+	bot.handleNames(c, girc.Event{Params: []string{"testbot", "=", "#test", "@op +alice testbot"}})
+	bot.handleChannelModes(c, girc.Event{Params: []string{"testbot", "#test", "+nt"}})
+	bot.handleMode(c, girc.Event{Source: &girc.Source{Name: "op"}, Params: []string{"#test", "+o", "alice"}})
+
+	st := bot.ChannelState("#test")
+	if st.GetTopic() != "Welcome to #test" || st.GetTopicSetBy() != "op" || st.GetTopicSetAt().GetSeconds() != 1700000000 {
+		t.Errorf("Unexpected topic: %q by %q at %v", st.GetTopic(), st.GetTopicSetBy(), st.GetTopicSetAt())
+	}
+	if st.GetModes() != "+nt" {
+		t.Errorf("Expected modes +nt, got %q", st.GetModes())
+	}
+	var members []string
+	for _, m := range st.GetMembers() {
+		members = append(members, m.GetPrefixes()+m.GetNick())
+	}
+	if got := strings.Join(members, " "); got != "@+alice @op testbot" {
+		t.Errorf("Unexpected members: %s", got)
+	}
+	if states := bot.ChannelStates(); len(states) != 1 || states[0].GetChannel() != "#Test" {
+		t.Errorf("Expected just #Test, got %v", states)
+	}
+
+	// Replies about channels we aren't in, e.g. to a NAMES or MODE query,
+	// don't make us think we are.
+	bot.handleNames(c, girc.Event{Params: []string{"testbot", "=", "#other", "alice"}})
+	bot.handleTopicReply(c, girc.Event{Params: []string{"testbot", "#other", "Elsewhere"}})
+	bot.handleTopicWhoTime(c, girc.Event{Params: []string{"testbot", "#other", "op", "1700000000"}})
+	bot.handleChannelModes(c, girc.Event{Params: []string{"testbot", "#other", "+nt"}})
+	if bot.ChannelState("#other") != nil || bot.joined("#other") || len(bot.ChannelStates()) != 1 {
+		t.Errorf("Expected no state for #other, got %v", bot.ChannelStates())
+	}
+
+	// Leaving forgets the channel.
+	bot.handlePart(c, girc.Event{Source: &girc.Source{Name: "testbot"}, Params: []string{"#test"}})
+	if bot.ChannelState("#test") != nil {
+		t.Error("Expected no state after parting")
+	}
+}
+
+// fakeIRCServer accepts connections, counting them. If welcome is set it
+// registers the client before hanging up.
+func fakeIRCServer(t *testing.T, welcome bool) (*pbConfig.Endpoint, *int32) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	var accepted int32
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			// Drain what the client sends so closing doesn't reset the connection.
+			go io.Copy(io.Discard, conn)
+			if welcome {
+				fmt.Fprint(conn, ":irc.test 001 testbot :Welcome\r\n")
+				// girc waits two seconds after 001 before firing CONNECTED.
+				time.Sleep(2500 * time.Millisecond)
+			}
+			conn.Close()
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+	return &pbConfig.Endpoint{Host: "127.0.0.1", Port: int32(addr.Port)}, &accepted
+}
+
+func TestRun_ReconnectsAndRotates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow: waits for girc's post-welcome delay")
+	}
+	primary, primaryConns := fakeIRCServer(t, false)
+	fallback, fallbackConns := fakeIRCServer(t, true)
+
+	var mu sync.Mutex
+	var notices []string
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{
+		Host:            primary.GetHost(),
+		Port:            primary.GetPort(),
+		Nick:            "testbot",
+		User:            "testbot",
+		FallbackServers: []*pbConfig.Endpoint{fallback},
+	}, nil, func(string) history.Store { return nil }, func(ev *pbService.StreamEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if sm := ev.GetSystemMessage(); sm != nil {
+			notices = append(notices, sm.GetContent())
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.retry = backoff.Backoff{Min: time.Millisecond, Max: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bot.Run(ctx)
+		close(done)
+	}()
+
+	reconnected := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Contains(strings.Join(notices, "\n"), "Reconnected to")
+	}
+	deadline := time.Now().Add(15 * time.Second)
+	for !reconnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The fake servers hang up on their own, so Run notices the cancel.
+	cancel()
+	<-done
+
+	if atomic.LoadInt32(primaryConns) < 1 || atomic.LoadInt32(fallbackConns) < 2 {
+		t.Fatalf("Expected attempts on both servers, got primary=%d fallback=%d", *primaryConns, *fallbackConns)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	joined := strings.Join(notices, "\n")
+	for _, want := range []string{"Disconnected from IRC", "Connected to", "Reconnected to"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("Expected a %q notice, got:\n%s", want, joined)
+		}
+	}
+}
+
+func TestSASLMech(t *testing.T) {
+	if _, _, err := saslMech(&pbConfig.SASL{Username: "bot"}, true); err == nil {
+		t.Error("Expected an error for PLAIN without a password")
+	}
+	if _, _, err := saslMech(&pbConfig.SASL{Mechanism: pbConfig.SASL_EXTERNAL}, false); err == nil {
+		t.Error("Expected an error for EXTERNAL without TLS")
+	}
+	if _, _, err := saslMech(&pbConfig.SASL{Mechanism: pbConfig.SASL_EXTERNAL, CertFile: "nope.crt", KeyFile: "nope.key"}, true); err == nil {
+		t.Error("Expected an error for a missing client certificate")
+	}
+	mech, cert, err := saslMech(&pbConfig.SASL{Username: "bot", Password: "secret"}, false)
+	if err != nil || mech.Method() != "PLAIN" || cert != nil {
+		t.Errorf("Expected PLAIN without a certificate, got %v %v %v", mech, cert, err)
+	}
+}
+
+// fakeSASLServer offers SASL and rejects every login. It records, per
+// connection, whether the client tried to authenticate.
+func fakeSASLServer(t *testing.T) (*pbConfig.Endpoint, func() []bool) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	var mu sync.Mutex
+	var attempts []bool
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			n := len(attempts)
+			attempts = append(attempts, false)
+			mu.Unlock()
+
+			go func() {
+				defer conn.Close()
+				sc := bufio.NewScanner(conn)
+				for sc.Scan() {
+					line := sc.Text()
+					switch {
+					case strings.HasPrefix(line, "CAP LS"):
+						fmt.Fprint(conn, ":irc.test CAP * LS :sasl\r\n")
+					case strings.HasPrefix(line, "CAP REQ"):
+						fmt.Fprintf(conn, ":irc.test CAP * ACK :%s\r\n", strings.TrimPrefix(line, "CAP REQ :"))
+					case line == "AUTHENTICATE PLAIN":
+						mu.Lock()
+						attempts[n] = true
+						mu.Unlock()
+						fmt.Fprint(conn, "AUTHENTICATE +\r\n")
+					case strings.HasPrefix(line, "AUTHENTICATE "):
+						fmt.Fprint(conn, ":irc.test 904 testbot :SASL authentication failed\r\n")
+					case line == "CAP END":
+						// Registration would carry on here; that's all we need.
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+	return &pbConfig.Endpoint{Host: "127.0.0.1", Port: int32(addr.Port)}, func() []bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]bool(nil), attempts...)
+	}
+}
+
+func TestRun_SASLFailure(t *testing.T) {
+	for _, abort := range []bool{false, true} {
+		srv, attempts := fakeSASLServer(t)
+
+		var mu sync.Mutex
+		var notices []string
+		bot, err := NewIRCBot("", &pbConfig.IRCServer{
+			Host: srv.GetHost(),
+			Port: srv.GetPort(),
+			Nick: "testbot",
+			User: "testbot",
+			Sasl: &pbConfig.SASL{Username: "bot", Password: "wrong", AbortOnFailure: abort},
+		}, nil, func(string) history.Store { return nil }, func(ev *pbService.StreamEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			if sm := ev.GetSystemMessage(); sm != nil {
+				notices = append(notices, sm.GetContent())
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bot.retry = backoff.Backoff{Min: time.Millisecond, Max: time.Millisecond}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			bot.Run(ctx)
+			close(done)
+		}()
+
+		if abort {
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected Run to give up after the SASL failure")
+			}
+			if got := attempts(); len(got) != 1 {
+				t.Errorf("Expected a single connection attempt, got %v", got)
+			}
+		} else {
+			deadline := time.Now().Add(5 * time.Second)
+			for len(attempts()) < 2 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			// Wait for the second connection to finish registering.
+			time.Sleep(100 * time.Millisecond)
+			if got := attempts(); len(got) < 2 || !got[0] || got[1] {
+				t.Errorf("Expected a login attempt, then a connection without SASL, got %v", got)
+			}
+		}
+		cancel()
+		<-done
+
+		mu.Lock()
+		if joined := strings.Join(notices, "\n"); !strings.Contains(joined, "SASL authentication failed") {
+			t.Errorf("abort=%v: expected a SASL failure notice, got:\n%s", abort, joined)
+		}
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,779 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lrstanley/girc"
+	"github.com/morrowc/irc-bot/server/history"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+const (
+	// ircServerName is the name the listener uses for itself in replies.
+	ircServerName       = "irc-bot"
+	defaultPlayback     = 50
+	ircRegisterTimeout  = time.Minute
+	ircWriteTimeout     = 30 * time.Second
+	maxIRCLineLength    = 8191 + 512 // Tags plus a 512 byte message
+	ircServerTimeFormat = "2006-01-02T15:04:05.000Z"
+	errInvalidCapCmd    = "410" // Not in girc
+)
+
+// ircCaps are the IRCv3 capabilities clients of the listener can enable.
+var ircCaps = []string{"server-time"}
+
+var ircServer = &girc.Source{Name: ircServerName}
+
+// ircListener lets ordinary IRC clients attach. Each connection is attached
+// to one network and fed from the same history and broadcasts as the gRPC
+// streams.
+type ircListener struct {
+	svc      *IRCServiceServer
+	playback int
+}
+
+func newIRCListener(svc *IRCServiceServer, cfg *pbConfig.IRCListener) *ircListener {
+	playback := int(cfg.GetPlayback())
+	if playback <= 0 {
+		playback = defaultPlayback
+	}
+	return &ircListener{svc: svc, playback: playback}
+}
+
+// serve accepts connections until lis is closed.
+func (l *ircListener) serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go l.handle(conn)
+	}
+}
+
+// ircConn is one client of the listener.
+type ircConn struct {
+	l    *ircListener
+	conn net.Conn
+	peer string
+	wmu  sync.Mutex // Replies and the queue's sender both write
+
+	// Registration
+	pass, user   string
+	capNegotiate bool // CAP LS or REQ seen, waiting for CAP END
+
+	network string
+	bot     *IRCBot
+	q       *clientQueue
+
+	mu         sync.Mutex
+	nick       string                  // The nick the client knows it has: the bot's
+	serverTime bool                    // server-time enabled
+	parted     map[string]bool         // Folded channels the client left; not forwarded
+	own        map[ownLine][]time.Time // Lines the client sent, not yet seen back; see sentOwn
+	lastSpread string                  // Last QUIT or NICK forwarded, see spread
+	lastAt     time.Time
+}
+
+// ownLine is a line the client sent, which it doesn't expect back. Lines
+// are told by content: with echo-message they have no ID until the server
+// echoes them.
+type ownLine struct {
+	key     string
+	kind    pbService.IRCMessage_Kind
+	content string
+}
+
+func (l *ircListener) handle(conn net.Conn) {
+	c := &ircConn{
+		l:      l,
+		conn:   conn,
+		peer:   conn.RemoteAddr().String(),
+		nick:   "*",
+		parted: make(map[string]bool),
+		own:    make(map[ownLine][]time.Time),
+	}
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxIRCLineLength)
+	conn.SetReadDeadline(time.Now().Add(ircRegisterTimeout))
+	for scanner.Scan() {
+		e := girc.ParseEvent(scanner.Text())
+		if e == nil {
+			continue
+		}
+		if !c.handleLine(e) {
+			break
+		}
+	}
+	if c.q != nil {
+		l.svc.streams.Delete(c)
+		c.q.close(nil)
+		// The sender may be writing; wait for it, as conn is closed next.
+		c.q.wait()
+		c.q.logStats()
+	}
+}
+
+// handleLine processes a line from the client. It returns false once the
+// connection should be closed.
+func (c *ircConn) handleLine(e *girc.Event) bool {
+	switch e.Command {
+	case girc.CAP:
+		c.handleCap(e)
+	case girc.PING:
+		c.write(&girc.Event{Source: ircServer, Command: girc.PONG, Params: []string{ircServerName, e.Last()}})
+	case girc.PONG:
+	case girc.QUIT:
+		c.write(&girc.Event{Command: girc.ERROR, Params: []string{"Closing link"}})
+		return false
+	default:
+		if c.q == nil {
+			return c.handleRegistration(e)
+		}
+		c.handleCommand(e)
+	}
+	return true
+}
+
+func (c *ircConn) handleRegistration(e *girc.Event) bool {
+	switch e.Command {
+	case girc.PASS:
+		c.pass = e.Last()
+	case girc.NICK:
+		if len(e.Params) > 0 {
+			c.setNick(e.Params[0])
+		}
+	case girc.USER:
+		if len(e.Params) < 4 {
+			c.reply(girc.ERR_NEEDMOREPARAMS, girc.USER, "Not enough parameters")
+			return true
+		}
+		c.user = e.Params[0]
+	default:
+		c.reply(girc.ERR_NOTREGISTERED, "You have not registered")
+		return true
+	}
+	if c.getNick() == "*" || c.user == "" || c.capNegotiate {
+		return true
+	}
+	return c.register()
+}
+
+// register authenticates the client once it sent NICK and USER, welcomes it
+// and attaches it to its network.
+func (c *ircConn) register() bool {
+	svc := c.l.svc
+	name, err := svc.checkToken(c.pass)
+	if err != nil {
+		log.Printf("Rejected IRC client at %s: %v", c.peer, err)
+		c.reply(girc.ERR_PASSWDMISMATCH, "Password incorrect")
+		c.write(&girc.Event{Command: girc.ERROR, Params: []string{"Closing link: " + err.Error()}})
+		return false
+	}
+
+	_, network, qualified := strings.Cut(c.user, "/")
+	if !qualified {
+		network = svc.defaultNetwork()
+	}
+	bot, err := svc.bot(network)
+	if err != nil {
+		log.Printf("Rejected IRC client %s at %s: %v", name, c.peer, err)
+		c.write(&girc.Event{Command: girc.ERROR, Params: []string{"Closing link: " + err.Error()}})
+		return false
+	}
+	c.network, c.bot = network, bot
+	c.conn.SetReadDeadline(time.Time{})
+
+	// The client has the bot's nick, whatever it asked for.
+	nick := bot.Nick()
+	if asked := c.getNick(); asked != nick {
+		c.write(&girc.Event{Source: &girc.Source{Name: asked}, Command: girc.NICK, Params: []string{nick}})
+		c.setNick(nick)
+	}
+	c.welcome()
+
+	// Live events queue up while we replay; the sender starts once the
+	// replay is done.
+	svc.mu.RLock()
+	queueSize := int(svc.config.GetClientQueueSize())
+	policy := svc.config.GetOverflowPolicy()
+	svc.mu.RUnlock()
+	c.q = newClientQueue(c, c.peer, queueSize, policy)
+	c.q.id = clientIdentity{token: name}
+	svc.streams.Store(c, c.q)
+	log.Printf("IRC client %s at %s attached to network %q", c.q.id, c.peer, network)
+
+	c.q.skipThrough(c.replay())
+	go c.q.run()
+	go func() {
+		// Closing the connection ends the read loop in handle.
+		<-c.q.Done()
+		if err := c.q.Err(); err != nil {
+			c.write(&girc.Event{Command: girc.ERROR, Params: []string{"Closing link: " + err.Error()}})
+		}
+		c.conn.Close()
+	}()
+	return true
+}
+
+func (c *ircConn) welcome() {
+	network := c.network
+	if network == "" {
+		network = ircServerName
+	}
+	prefix, ok := c.bot.client.GetServerOption("PREFIX")
+	if !ok {
+		prefix = defaultPrefix
+	}
+	c.reply(girc.RPL_WELCOME, fmt.Sprintf("Welcome to the %s bouncer, %s", ircServerName, c.getNick()))
+	c.reply(girc.RPL_YOURHOST, fmt.Sprintf("Your host is %s, attached to network %s", ircServerName, network))
+	c.reply(girc.RPL_CREATED, "This server was created some time ago")
+	c.reply(girc.RPL_MYINFO, ircServerName, ircServerName, "o", "o")
+	c.reply(girc.RPL_ISUPPORT, "CHANTYPES="+channelPrefixes, "PREFIX="+prefix, "NETWORK="+network, "are supported by this server")
+	c.reply(girc.ERR_NOMOTD, "MOTD File is missing")
+}
+
+// replay sends each channel the bot is in as a join followed by its recent
+// messages, then recent messages of queries. It returns the newest ID sent
+// per history key.
+func (c *ircConn) replay() map[string]uint64 {
+	svc := c.l.svc
+	svc.mu.RLock()
+	hist := svc.history
+	svc.mu.RUnlock()
+
+	replayed := make(map[string]uint64)
+	send := func(key string, buf history.Store) {
+		evs, _ := buf.Page(0, c.l.playback, false)
+		for _, ev := range evs {
+			// Channel events before now would confuse the client about
+			// who is here; NAMES has that.
+			if ev.GetMessage() != nil {
+				c.writeAll(c.lines(ev))
+			}
+			replayed[key] = history.EventID(ev)
+		}
+	}
+
+	for _, st := range c.bot.ChannelStates() {
+		c.write(&girc.Event{Source: &girc.Source{Name: c.getNick()}, Command: girc.JOIN, Params: []string{st.GetChannel()}})
+		c.sendTopic(st, false)
+		c.sendNames(st)
+		key := historyKey(c.network, st.GetChannel())
+		if buf := hist[key]; buf != nil {
+			send(key, buf)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(hist)) {
+		if network, name := splitHistoryKey(key); network == c.network && !girc.IsValidChannel(name) {
+			send(key, hist[key])
+		}
+	}
+	return replayed
+}
+
+func (c *ircConn) handleCap(e *girc.Event) {
+	if len(e.Params) == 0 {
+		return
+	}
+	switch strings.ToUpper(e.Params[0]) {
+	case girc.CAP_LS:
+		if c.q == nil {
+			c.capNegotiate = true
+		}
+		c.write(&girc.Event{Source: ircServer, Command: girc.CAP, Params: []string{c.getNick(), girc.CAP_LS, strings.Join(ircCaps, " ")}})
+	case girc.CAP_LIST:
+		var enabled []string
+		c.mu.Lock()
+		if c.serverTime {
+			enabled = append(enabled, "server-time")
+		}
+		c.mu.Unlock()
+		c.write(&girc.Event{Source: ircServer, Command: girc.CAP, Params: []string{c.getNick(), girc.CAP_LIST, strings.Join(enabled, " ")}})
+	case girc.CAP_REQ:
+		if c.q == nil {
+			c.capNegotiate = true
+		}
+		req := strings.Fields(e.Last())
+		for _, cp := range req {
+			if !slices.Contains(ircCaps, strings.TrimPrefix(cp, "-")) {
+				c.write(&girc.Event{Source: ircServer, Command: girc.CAP, Params: []string{c.getNick(), girc.CAP_NAK, e.Last()}})
+				return
+			}
+		}
+		c.mu.Lock()
+		for _, cp := range req {
+			if cp == "server-time" || cp == "-server-time" {
+				c.serverTime = cp == "server-time"
+			}
+		}
+		c.mu.Unlock()
+		c.write(&girc.Event{Source: ircServer, Command: girc.CAP, Params: []string{c.getNick(), girc.CAP_ACK, e.Last()}})
+	case girc.CAP_END:
+		if c.capNegotiate && c.q == nil {
+			c.capNegotiate = false
+			if c.getNick() != "*" && c.user != "" && !c.register() {
+				c.conn.Close()
+			}
+		}
+	default:
+		c.reply(errInvalidCapCmd, e.Params[0], "Invalid CAP command")
+	}
+}
+
+// handleCommand processes a command from a registered client.
+func (c *ircConn) handleCommand(e *girc.Event) {
+	switch e.Command {
+	case girc.PRIVMSG, girc.NOTICE:
+		if len(e.Params) < 2 {
+			c.reply(girc.ERR_NOTEXTTOSEND, "No text to send")
+			return
+		}
+		for _, target := range strings.Split(e.Params[0], ",") {
+			c.sendText(e.Command, target, e.Last())
+		}
+	case girc.JOIN:
+		if len(e.Params) == 0 {
+			c.reply(girc.ERR_NEEDMOREPARAMS, girc.JOIN, "Not enough parameters")
+			return
+		}
+		// Keys come from the config, not the client.
+		for _, channel := range strings.Split(e.Params[0], ",") {
+			c.join(channel)
+		}
+	case girc.PART:
+		// The bouncer stays; only this client leaves.
+		if len(e.Params) == 0 {
+			return
+		}
+		for _, channel := range strings.Split(e.Params[0], ",") {
+			c.mu.Lock()
+			c.parted[girc.ToRFC1459(channel)] = true
+			c.mu.Unlock()
+			c.write(&girc.Event{Source: &girc.Source{Name: c.getNick()}, Command: girc.PART, Params: []string{channel}})
+		}
+	case girc.NAMES:
+		if len(e.Params) == 0 {
+			return
+		}
+		for _, channel := range strings.Split(e.Params[0], ",") {
+			if st := c.bot.ChannelState(channel); st != nil {
+				c.sendNames(st)
+			} else {
+				c.reply(girc.RPL_ENDOFNAMES, channel, "End of /NAMES list")
+			}
+		}
+	case girc.TOPIC:
+		if len(e.Params) == 0 {
+			c.reply(girc.ERR_NEEDMOREPARAMS, girc.TOPIC, "Not enough parameters")
+			return
+		}
+		channel := e.Params[0]
+		if len(e.Params) > 1 {
+			if err := c.bot.SetTopic(channel, e.Last()); err != nil {
+				c.reply(girc.ERR_NOTONCHANNEL, channel, err.Error())
+			}
+			return
+		}
+		if st := c.bot.ChannelState(channel); st != nil {
+			c.sendTopic(st, true)
+		} else {
+			c.reply(girc.ERR_NOTONCHANNEL, channel, "You're not on that channel")
+		}
+	case girc.MODE:
+		if len(e.Params) == 0 {
+			return
+		}
+		if !girc.IsValidChannel(e.Params[0]) {
+			c.reply(girc.RPL_UMODEIS, "+")
+			return
+		}
+		if len(e.Params) > 1 {
+			// Lists like bans aren't kept; changes aren't passed on.
+			c.reply(girc.RPL_ENDOFBANLIST, e.Params[0], "End of channel ban list")
+			return
+		}
+		if st := c.bot.ChannelState(e.Params[0]); st != nil {
+			modes := strings.Fields(st.GetModes())
+			if len(modes) == 0 {
+				modes = []string{"+"}
+			}
+			c.reply(girc.RPL_CHANNELMODEIS, append([]string{e.Params[0]}, modes...)...)
+		}
+	case girc.WHO:
+		if len(e.Params) == 0 {
+			return
+		}
+		if st := c.bot.ChannelState(e.Params[0]); st != nil {
+			for _, m := range st.GetMembers() {
+				c.reply(girc.RPL_WHOREPLY, e.Params[0], m.GetNick(), ircServerName, ircServerName, m.GetNick(), "H"+m.GetPrefixes(), "0 "+m.GetNick())
+			}
+		}
+		c.reply(girc.RPL_ENDOFWHO, e.Params[0], "End of /WHO list")
+	case girc.NICK:
+		c.write(&girc.Event{Source: ircServer, Command: girc.NOTICE, Params: []string{c.getNick(), "The bouncer's nick can't be changed from here"}})
+	case girc.USER, girc.PASS:
+		c.reply(girc.ERR_ALREADYREGISTRED, "You may not reregister")
+	default:
+		c.reply(girc.ERR_UNKNOWNCOMMAND, e.Command, "Unknown command")
+	}
+}
+
+// sendText sends a PRIVMSG or NOTICE from the client. The lines come back as
+// broadcasts; those are not shown to this client, which already has them.
+func (c *ircConn) sendText(command, target, text string) {
+	kind := pbService.IRCMessage_PRIVMSG
+	if command == girc.NOTICE {
+		kind = pbService.IRCMessage_NOTICE
+	}
+	if ctcp, ok := strings.CutPrefix(text, "\x01"); ok {
+		ctcp = strings.TrimSuffix(ctcp, "\x01")
+		cmd, args, _ := strings.Cut(ctcp, " ")
+		if cmd == girc.CTCP_ACTION {
+			kind, text = pbService.IRCMessage_ACTION, args
+		} else if command == girc.PRIVMSG {
+			kind, text = pbService.IRCMessage_CTCP, ctcp
+		} else {
+			// CTCP replies aren't supported.
+			return
+		}
+	}
+
+	// Hold c.mu so the sender doesn't get to the lines before they are
+	// marked as ours.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lines, err := c.l.svc.send(limitKey(c.q.id, c.peer), &pbService.SendMessageRequest{
+		Network: c.network,
+		Channel: target,
+		Message: text,
+		Kind:    kind,
+	}, c.sentOwn)
+	if err != nil {
+		c.replyLocked(girc.ERR_CANNOTSENDTOCHAN, target, "Cannot send: "+err.Error())
+		return
+	}
+	now := time.Now()
+	for line := range c.own {
+		c.setOwn(line, c.waitingOwn(line, now))
+	}
+	for _, msg := range lines {
+		line := c.ownLine(msg)
+		c.own[line] = append(c.own[line], time.Time{})
+	}
+}
+
+// How long a line the client sent is looked out for once it is in history,
+// which may hold it back while a backfill is going on.
+const ownLineTimeout = 30 * time.Second
+
+func (c *ircConn) ownLine(msg *pbService.IRCMessage) ownLine {
+	return ownLine{historyKey(c.network, msg.GetChannel()), msg.GetKind(), msg.GetContent()}
+}
+
+// sentOwn hears how a send from the client went. Lines kept in history have
+// mostly come back by then; any still missing are waited for until
+// ownLineTimeout has passed, unless the send failed and they won't come.
+// Until then they wait with a zero time.
+func (c *ircConn) sentOwn(msgs []*pbService.IRCMessage, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range msgs {
+		line := c.ownLine(msg)
+		waits := c.own[line]
+		i := slices.Index(waits, time.Time{})
+		if i < 0 {
+			// Already seen back.
+			continue
+		}
+		if err != nil {
+			waits = slices.Delete(waits, i, i+1)
+		} else {
+			waits[i] = time.Now().Add(ownLineTimeout)
+		}
+		c.setOwn(line, waits)
+	}
+}
+
+// waitingOwn returns when to stop waiting for each copy of line the client
+// sent, leaving out those waited for long enough. Must be called with c.mu
+// held.
+func (c *ircConn) waitingOwn(line ownLine, now time.Time) []time.Time {
+	return slices.DeleteFunc(c.own[line], func(until time.Time) bool {
+		return !until.IsZero() && now.After(until)
+	})
+}
+
+// setOwn must be called with c.mu held.
+func (c *ircConn) setOwn(line ownLine, waits []time.Time) {
+	if len(waits) == 0 {
+		delete(c.own, line)
+		return
+	}
+	c.own[line] = waits
+}
+
+// join shows a channel again if the bot is in it, or joins it if it is one
+// of the bot's configured channels.
+func (c *ircConn) join(channel string) {
+	st := c.bot.ChannelState(channel)
+	if st == nil {
+		if err := c.bot.Join(channel); err != nil {
+			c.reply(girc.ERR_NOSUCHCHANNEL, channel, "Cannot join: "+err.Error())
+			return
+		}
+	}
+	c.mu.Lock()
+	delete(c.parted, girc.ToRFC1459(channel))
+	c.mu.Unlock()
+	if st == nil {
+		// The JOIN comes back as a broadcast.
+		return
+	}
+	c.write(&girc.Event{Source: &girc.Source{Name: c.getNick()}, Command: girc.JOIN, Params: []string{st.GetChannel()}})
+	c.sendTopic(st, false)
+	c.sendNames(st)
+}
+
+// sendTopic sends the topic of a channel. Without one, nothing is sent unless
+// the client asked.
+func (c *ircConn) sendTopic(st *pbService.ChannelState, asked bool) {
+	if st.GetTopic() == "" {
+		if asked {
+			c.reply(girc.RPL_NOTOPIC, st.GetChannel(), "No topic is set")
+		}
+		return
+	}
+	c.reply(girc.RPL_TOPIC, st.GetChannel(), st.GetTopic())
+	if st.GetTopicSetBy() != "" {
+		c.reply(girc.RPL_TOPICWHOTIME, st.GetChannel(), st.GetTopicSetBy(), fmt.Sprint(st.GetTopicSetAt().AsTime().Unix()))
+	}
+}
+
+// sendNames sends the members of a channel, as many per line as fit.
+func (c *ircConn) sendNames(st *pbService.ChannelState) {
+	var names []string
+	n := 0
+	for _, m := range st.GetMembers() {
+		name := m.GetPrefixes() + m.GetNick()
+		if n+len(name) > 400 {
+			c.reply(girc.RPL_NAMREPLY, "=", st.GetChannel(), strings.Join(names, " "))
+			names, n = nil, 0
+		}
+		names = append(names, name)
+		n += len(name) + 1
+	}
+	if len(names) > 0 {
+		c.reply(girc.RPL_NAMREPLY, "=", st.GetChannel(), strings.Join(names, " "))
+	}
+	c.reply(girc.RPL_ENDOFNAMES, st.GetChannel(), "End of /NAMES list")
+}
+
+// Send writes a broadcast event to the client, as IRC lines. Events of other
+// networks, and lines the client sent itself, are skipped.
+func (c *ircConn) Send(ev *pbService.StreamEvent) error {
+	var network string
+	switch e := ev.GetEvent().(type) {
+	case *pbService.StreamEvent_Message:
+		network = e.Message.GetNetwork()
+	case *pbService.StreamEvent_ChannelEvent:
+		network = e.ChannelEvent.GetNetwork()
+	case *pbService.StreamEvent_SystemMessage:
+		network = e.SystemMessage.GetNetwork()
+	default:
+		return nil
+	}
+	if network != c.network {
+		return nil
+	}
+
+	c.mu.Lock()
+	var own bool
+	if msg := ev.GetMessage(); msg != nil && girc.ToRFC1459(msg.GetSender()) == girc.ToRFC1459(c.nick) {
+		line := ownLine{eventKey(ev), msg.GetKind(), msg.GetContent()}
+		waits := c.waitingOwn(line, time.Now())
+		if own = len(waits) > 0; own {
+			waits = waits[1:]
+		}
+		c.setOwn(line, waits)
+	}
+	parted := c.parted[girc.ToRFC1459(history.EventChannel(ev))]
+	c.mu.Unlock()
+	if own || parted {
+		return nil
+	}
+	return c.writeAll(c.lines(ev))
+}
+
+// lines renders an event as what an IRC server would have sent.
+func (c *ircConn) lines(ev *pbService.StreamEvent) []*girc.Event {
+	nick := c.getNick()
+	switch e := ev.GetEvent().(type) {
+	case *pbService.StreamEvent_Message:
+		msg := e.Message
+		target := msg.GetChannel()
+		if !girc.IsValidChannel(target) && girc.ToRFC1459(msg.GetSender()) != girc.ToRFC1459(nick) {
+			// A query with them; they wrote to us.
+			target = nick
+		}
+		command, text := girc.PRIVMSG, msg.GetContent()
+		switch msg.GetKind() {
+		case pbService.IRCMessage_NOTICE:
+			command = girc.NOTICE
+		case pbService.IRCMessage_ACTION:
+			text = "\x01ACTION " + text + "\x01"
+		case pbService.IRCMessage_CTCP:
+			text = "\x01" + text + "\x01"
+		}
+		return []*girc.Event{c.tag(&girc.Event{
+			Source:  &girc.Source{Name: msg.GetSender()},
+			Command: command,
+			Params:  []string{target, text},
+		}, msg.GetTimestamp())}
+
+	case *pbService.StreamEvent_ChannelEvent:
+		ce := e.ChannelEvent
+		out := &girc.Event{Source: &girc.Source{Name: ce.GetActor()}}
+		switch ce.GetType() {
+		case pbService.ChannelEvent_JOIN:
+			out.Command, out.Params = girc.JOIN, []string{ce.GetChannel()}
+		case pbService.ChannelEvent_PART:
+			out.Command, out.Params = girc.PART, []string{ce.GetChannel(), ce.GetReason()}
+		case pbService.ChannelEvent_KICK:
+			out.Command, out.Params = girc.KICK, []string{ce.GetChannel(), ce.GetTarget(), ce.GetReason()}
+		case pbService.ChannelEvent_TOPIC:
+			out.Command, out.Params = girc.TOPIC, []string{ce.GetChannel(), ce.GetTopic()}
+		case pbService.ChannelEvent_MODE:
+			out.Command, out.Params = girc.MODE, append([]string{ce.GetChannel()}, strings.Fields(ce.GetMode())...)
+		case pbService.ChannelEvent_QUIT:
+			if !c.spread("QUIT " + ce.GetActor() + " " + ce.GetReason()) {
+				return nil
+			}
+			out.Command, out.Params = girc.QUIT, []string{ce.GetReason()}
+		case pbService.ChannelEvent_NICK:
+			if !c.spread("NICK " + ce.GetOldNick() + " " + ce.GetNewNick()) {
+				return nil
+			}
+			out.Source.Name = ce.GetOldNick()
+			out.Command, out.Params = girc.NICK, []string{ce.GetNewNick()}
+			if girc.ToRFC1459(ce.GetOldNick()) == girc.ToRFC1459(nick) {
+				c.setNick(ce.GetNewNick())
+			}
+		default:
+			return nil
+		}
+		return []*girc.Event{c.tag(out, ce.GetTimestamp())}
+
+	case *pbService.StreamEvent_SystemMessage:
+		msg := e.SystemMessage
+		var out []*girc.Event
+		if newNick := msg.GetNick(); newNick != "" && girc.ToRFC1459(newNick) != girc.ToRFC1459(nick) {
+			// The bot changed nick without a channel seeing it.
+			out = append(out, &girc.Event{Source: &girc.Source{Name: nick}, Command: girc.NICK, Params: []string{newNick}})
+			c.setNick(newNick)
+			nick = newNick
+		}
+		target := nick
+		if girc.IsValidChannel(msg.GetChannel()) {
+			target = msg.GetChannel()
+		}
+		return append(out, c.tag(&girc.Event{
+			Source:  ircServer,
+			Command: girc.NOTICE,
+			Params:  []string{target, msg.GetContent()},
+		}, msg.GetTimestamp()))
+	}
+	return nil
+}
+
+// spread reports whether a QUIT or NICK, which the bot records once per
+// channel the user was in, is new rather than another copy of the last one.
+func (c *ircConn) spread(desc string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if desc == c.lastSpread && now.Sub(c.lastAt) < time.Second {
+		return false
+	}
+	c.lastSpread, c.lastAt = desc, now
+	return true
+}
+
+// tag adds the time of an event for clients that enabled server-time.
+func (c *ircConn) tag(e *girc.Event, ts *timestamppb.Timestamp) *girc.Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.serverTime && ts != nil {
+		e.Tags = girc.Tags{"time": ts.AsTime().UTC().Format(ircServerTimeFormat)}
+	}
+	return e
+}
+
+func (c *ircConn) getNick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+func (c *ircConn) setNick(nick string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nick = nick
+}
+
+// reply sends a numeric reply to the client.
+func (c *ircConn) reply(code string, params ...string) {
+	c.write(&girc.Event{Source: ircServer, Command: code, Params: append([]string{c.getNick()}, params...)})
+}
+
+// replyLocked is reply with c.mu held.
+func (c *ircConn) replyLocked(code string, params ...string) {
+	c.write(&girc.Event{Source: ircServer, Command: code, Params: append([]string{c.nick}, params...)})
+}
+
+func (c *ircConn) write(e *girc.Event) error {
+	return c.writeAll([]*girc.Event{e})
+}
+
+func (c *ircConn) writeAll(events []*girc.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, e := range events {
+		buf = append(append(buf, e.Bytes()...), '\r', '\n')
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(ircWriteTimeout))
+	if _, err := c.conn.Write(buf); err != nil {
+		return fmt.Errorf("failed to write to IRC client: %v", err)
+	}
+	return nil
+}
+
+// defaultNetwork is the network of IRC clients that don't name one: the
+// unnamed network, or the only one there is.
+func (s *IRCServiceServer) defaultNetwork() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.bots[""]; !ok && len(s.bots) == 1 {
+		for name := range s.bots {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+	"github.com/morrowc/irc-bot/server/history"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+// ircTestClient talks to the IRC listener like an IRC client would.
+type ircTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialIRC(t *testing.T, addr string, lines ...string) *ircTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &ircTestClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	c.send(lines...)
+	return c
+}
+
+func (c *ircTestClient) send(lines ...string) {
+	c.t.Helper()
+	for _, line := range lines {
+		if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// next reads a line.
+func (c *ircTestClient) next() string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("Expected a line, got %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+// expect reads lines until one contains want, and returns it.
+func (c *ircTestClient) expect(want string) string {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var seen []string
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("Expected a line with %q, got %v after %q", want, err, seen)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.Contains(line, want) {
+			return line
+		}
+		seen = append(seen, line)
+	}
+}
+
+func TestIRCListener(t *testing.T) {
+	cb := history.NewChannelBuffer(10)
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cb.Add(messageEvent(&pbService.IRCMessage{Channel: "#test", Sender: "alice", Content: "hi there", Timestamp: timestamppb.New(when)}))
+	srv := NewIRCServiceServer(&pbConfig.Service{ClientPasskey: "s3cret"}, map[string]history.Store{"#test": cb})
+
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{Nick: "testbot"}, nil, func(string) history.Store { return nil }, srv.Broadcast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.handleJoin(bot.client, girc.Event{Source: &girc.Source{Name: "testbot"}, Params: []string{"#test"}})
+	bot.handleJoin(bot.client, girc.Event{Source: &girc.Source{Name: "alice"}, Params: []string{"#test"}})
+	bot.handleTopicReply(bot.client, girc.Event{Params: []string{"testbot", "#test", "hello"}})
+	srv.SetBot("", bot)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go newIRCListener(srv, &pbConfig.IRCListener{}).serve(lis)
+
+	// A wrong password is turned away.
+	bad := dialIRC(t, lis.Addr().String(), "PASS nope", "NICK me", "USER me 0 * :Me")
+	bad.expect(" 464 ")
+	bad.expect("ERROR")
+
+	c := dialIRC(t, lis.Addr().String(), "CAP LS 302", "PASS s3cret", "NICK me", "USER me 0 * :Me")
+	c.expect("CAP * LS server-time")
+	c.send("CAP REQ :server-time")
+	c.expect("CAP me ACK server-time")
+	c.send("CAP END")
+	c.expect(":me NICK testbot")
+	c.expect(" 001 testbot ")
+	c.expect(":testbot JOIN #test")
+	c.expect(" 332 testbot #test hello")
+	if line := c.expect(" 353 "); !strings.HasSuffix(line, ":alice testbot") {
+		t.Errorf("Expected alice and testbot in NAMES, got %q", line)
+	}
+	c.expect(" 366 ")
+	c.expect("@time=2024-05-01T12:00:00.000Z :alice PRIVMSG #test :hi there")
+
+	// Live events of its network reach the client.
+	srv.Broadcast(messageEvent(&pbService.IRCMessage{Network: "libera", Channel: "#test", Sender: "bob", Content: "elsewhere", Timestamp: timestamppb.Now()}))
+	bot.handleText(girc.Event{Source: &girc.Source{Name: "bob"}, Command: girc.PRIVMSG, Params: []string{"testbot", "\x01ACTION waves\x01"}}, pbService.IRCMessage_PRIVMSG)
+	if line := c.expect("PRIVMSG"); !strings.HasSuffix(line, ":bob PRIVMSG testbot :\x01ACTION waves\x01") {
+		t.Errorf("Expected bob's action in a query, got %q", line)
+	}
+
+	c.send("PING :abc")
+	c.expect("PONG irc-bot abc")
+	c.send("TOPIC #test")
+	c.expect(" 332 testbot #test hello")
+	c.send("PRIVMSG #test :hi")
+	c.expect(" 404 testbot #test :Cannot send: " + errNotConnected.Error())
+
+	// Parting only hides the channel from this client.
+	c.send("PART #test")
+	c.expect(":testbot PART #test")
+	bot.handleText(girc.Event{Source: &girc.Source{Name: "alice"}, Command: girc.PRIVMSG, Params: []string{"#test", "hidden"}}, pbService.IRCMessage_PRIVMSG)
+	srv.Broadcast(systemEvent(&pbService.SystemMessage{Content: "marker"}))
+	if line := c.next(); line != ":irc-bot NOTICE testbot marker" {
+		t.Errorf("Expected only the notice, got %q", line)
+	}
+
+	// Joining shows it again; channels that aren't configured are refused.
+	c.send("JOIN #other,#TEST")
+	c.expect(" 403 testbot #other :Cannot join: " + errNotConfigured.Error())
+	c.expect(":testbot JOIN #test")
+
+	// Removing the network disconnects its clients.
+	srv.SetBot("", nil)
+	c.expect("ERROR")
+}
+
+func TestIRCConnLines(t *testing.T) {
+	c := &ircConn{nick: "testbot", own: make(map[ownLine][]time.Time), parted: make(map[string]bool)}
+	render := func(ev *pbService.StreamEvent) string {
+		var out []string
+		for _, e := range c.lines(ev) {
+			out = append(out, e.String())
+		}
+		return strings.Join(out, "\n")
+	}
+
+	tests := []struct {
+		ev   *pbService.StreamEvent
+		want string
+	}{
+		{messageEvent(&pbService.IRCMessage{Channel: "alice", Sender: "testbot", Content: "hey"}), ":testbot PRIVMSG alice hey"},
+		{messageEvent(&pbService.IRCMessage{Channel: "alice", Sender: "alice", Content: "hi you", Kind: pbService.IRCMessage_NOTICE}), ":alice NOTICE testbot :hi you"},
+		{messageEvent(&pbService.IRCMessage{Channel: "#test", Sender: "alice", Content: "VERSION", Kind: pbService.IRCMessage_CTCP}), ":alice PRIVMSG #test \x01VERSION\x01"},
+		{channelEvent(&pbService.ChannelEvent{Channel: "#test", Type: pbService.ChannelEvent_KICK, Actor: "op", Target: "alice", Reason: "bye now"}), ":op KICK #test alice :bye now"},
+		{channelEvent(&pbService.ChannelEvent{Channel: "#test", Type: pbService.ChannelEvent_MODE, Actor: "op", Mode: "+o alice"}), ":op MODE #test +o alice"},
+		// One QUIT per channel the user was in; the client wants one.
+		{channelEvent(&pbService.ChannelEvent{Channel: "#a", Type: pbService.ChannelEvent_QUIT, Actor: "bob", Reason: "gone"}), ":bob QUIT gone"},
+		{channelEvent(&pbService.ChannelEvent{Channel: "#b", Type: pbService.ChannelEvent_QUIT, Actor: "bob", Reason: "gone"}), ""},
+		{channelEvent(&pbService.ChannelEvent{Channel: "#a", Type: pbService.ChannelEvent_NICK, OldNick: "testbot", NewNick: "testbot_"}), ":testbot NICK testbot_"},
+	}
+	for _, tt := range tests {
+		if got := render(tt.ev); got != tt.want {
+			t.Errorf("lines(%v) = %q, want %q", tt.ev, got, tt.want)
+		}
+	}
+	if c.nick != "testbot_" {
+		t.Errorf("Expected the client's nick to follow the bot's, got %q", c.nick)
+	}
+
+	// A nick change outside any channel comes as a system message.
+	if got, want := render(systemEvent(&pbService.SystemMessage{Content: "Now known as bot", Nick: "bot"})), ":testbot_ NICK bot\n:irc-bot NOTICE bot :Now known as bot"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got, want := render(systemEvent(&pbService.SystemMessage{Content: "Nick is bot", Nick: "bot"})), ":irc-bot NOTICE bot :Nick is bot"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestIRCConnSkipsOwnLines(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	c := &ircConn{conn: server, nick: "testbot", own: make(map[ownLine][]time.Time), parted: make(map[string]bool)}
+	r := bufio.NewReader(client)
+
+	// The client sent "hi" twice; with echo-message the lines come back
+	// with IDs it has never seen.
+	c.own[ownLine{"#test", pbService.IRCMessage_PRIVMSG, "hi"}] = make([]time.Time, 2)
+	for i := 0; i < 2; i++ {
+		if err := c.Send(messageEvent(&pbService.IRCMessage{Id: uint64(i + 1), Channel: "#test", Sender: "testbot", Content: "hi"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.own) != 0 {
+		t.Errorf("Expected both lines to be seen back, %v left", c.own)
+	}
+	// Once they are back, the same text from elsewhere is shown.
+	go c.Send(messageEvent(&pbService.IRCMessage{Id: 3, Channel: "#test", Sender: "testbot", Content: "hi"}))
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ":testbot PRIVMSG #test hi\r\n"; line != want {
+		t.Errorf("Expected %q, got %q", want, line)
+	}
+}
+
+func TestIRCConnForgetsOwnLines(t *testing.T) {
+	c := &ircConn{nick: "testbot", own: make(map[ownLine][]time.Time)}
+	hi := &pbService.IRCMessage{Channel: "#test", Kind: pbService.IRCMessage_PRIVMSG, Content: "hi"}
+	line := c.ownLine(hi)
+
+	// A line dropped from the send queue won't come back.
+	c.own[line] = make([]time.Time, 1)
+	c.sentOwn([]*pbService.IRCMessage{hi}, errDropped)
+	if len(c.own) != 0 {
+		t.Errorf("Expected a dropped line to be forgotten, %v left", c.own)
+	}
+
+	// One that went out is waited for, but not forever: the server may
+	// have refused it.
+	c.own[line] = make([]time.Time, 1)
+	c.sentOwn([]*pbService.IRCMessage{hi}, nil)
+	if got := c.waitingOwn(line, time.Now()); len(got) != 1 {
+		t.Errorf("Expected a sent line to be waited for, got %v", got)
+	}
+	if got := c.waitingOwn(line, time.Now().Add(ownLineTimeout+time.Second)); len(got) != 0 {
+		t.Errorf("Expected a sent line to be given up on, got %v", got)
+	}
+
+	// Lines still queued are waited for however long they take.
+	c.own[line] = make([]time.Time, 1)
+	if got := c.waitingOwn(line, time.Now().Add(time.Hour)); len(got) != 1 {
+		t.Errorf("Expected a queued line to be waited for, got %v", got)
+	}
+}
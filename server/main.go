@@ -1,18 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"maps"
 	"net"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/lrstanley/girc"
+	"github.com/morrowc/irc-bot/server/certs"
 	"github.com/morrowc/irc-bot/server/history"
+	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/protobuf/encoding/prototext"
@@ -23,6 +35,7 @@ import (
 
 var (
 	configPath = flag.String("config", "config.textproto", "Path to configuration file")
+	hashToken  = flag.Bool("hash-token", false, "Read a client token from stdin, print its bcrypt hash for service.client_tokens and exit")
 )
 
 func loadConfig(path string) (*pbConfig.Config, error) {
@@ -40,55 +53,120 @@ func loadConfig(path string) (*pbConfig.Config, error) {
 }
 
 func main() {
+	// `server certs ...` runs the certificate authority instead.
+	if len(os.Args) > 1 && os.Args[1] == "certs" {
+		if err := certs.Run(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "certs: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 	flag.Parse()
 
+	if *hashToken {
+		hash, err := hashClientToken(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(hash)
+		return
+	}
+
 	config, err := loadConfig(*configPath)
 	if err != nil {
 		log.Fatal(err)
 	}
+	networks, err := configNetworks(config)
+	if err != nil {
+		log.Fatalf("invalid config: %v", err)
+	}
 
-	// Initialize History Buffers
+	// Initialize History Buffers, keyed by historyKey.
 	var histMu sync.RWMutex
-	histBuffers := make(map[string]*history.ChannelBuffer)
-	for _, ch := range config.GetChannels() {
-		limit := int(ch.GetHistoryLimit())
-		if limit == 0 {
-			limit = 100 // Default if 0? Or just 0.
+	histBuffers := make(map[string]history.Store)
+	for _, n := range networks {
+		for _, ch := range n.GetChannels() {
+			store, err := newHistoryStore(config, n.GetName(), ch)
+			if err != nil {
+				log.Fatalf("failed to open history for %s: %v", historyKey(n.GetName(), ch.GetName()), err)
+			}
+			histBuffers[historyKey(n.GetName(), ch.GetName())] = store
 		}
-		histBuffers[ch.GetName()] = history.NewChannelBuffer(limit)
 	}
 
-	// Helper to get buffer safely
-	getBuffer := func(name string) *history.ChannelBuffer {
-		histMu.RLock()
-		defer histMu.RUnlock()
-		return histBuffers[name]
-	}
 	// Initialize gRPC Service
 	grpcService := NewIRCServiceServer(config.GetService(), histBuffers)
 
-	// Helper to broadcast to gRPC clients
-	broadcaster := func(msg *pbService.IRCMessage) {
-		grpcService.Broadcast(msg)
-	}
+	// Helper to get buffer safely, for the bot of a network. Private
+	// conversations (queries) get a buffer the first time they are used, and
+	// lose it to newer ones once max_queries are open. The maps are shared
+	// with the gRPC service, so they are replaced rather than modified.
+	queries := make(map[string]time.Time) // History key -> last used
+	histConfig := config
+	bufferGetter := func(network string) func(string) history.Store {
+		return func(name string) history.Store {
+			key := historyKey(network, name)
+			if girc.IsValidChannel(name) {
+				histMu.RLock()
+				defer histMu.RUnlock()
+				return histBuffers[key]
+			}
 
-	// Start IRC Client
-	bot := NewIRCBot(config.GetIrc(), config.GetChannels(), getBuffer, broadcaster)
+			histMu.Lock()
+			defer histMu.Unlock()
+			if store := histBuffers[key]; store != nil {
+				queries[key] = time.Now()
+				return store
+			}
+			newHistBuffers := maps.Clone(histBuffers)
+			if old := queryToEvict(queries, int(histConfig.GetMaxQueries())); old != "" {
+				log.Printf("Closing history of query %s to make room for %s", old, key)
+				if err := newHistBuffers[old].Close(); err != nil {
+					log.Printf("Failed to close history for %s: %v", old, err)
+				}
+				delete(newHistBuffers, old)
+				delete(queries, old)
+			}
+			_, peer := splitHistoryKey(key)
+			store := newQueryStore(histConfig, network, peer)
+			newHistBuffers[key] = store
+			histBuffers = newHistBuffers
+			queries[key] = time.Now()
+			grpcService.SetHistory(histBuffers)
+			return store
+		}
+	}
 
-	// Link bot to service
-	grpcService.SetBot(bot)
+	// Helper to broadcast to gRPC clients
+	broadcaster := func(ev *pbService.StreamEvent) {
+		grpcService.Broadcast(ev)
+	}
 
-	go func() {
-		if err := bot.Connect(); err != nil {
-			log.Fatalf("IRC Connect failed: %v", err)
+	// Start an IRC client per network and link it to the service. Each stays
+	// connected, reconnecting as needed; channels are (re)joined by the bot
+	// on every connect.
+	bots := make(map[string]*runningBot)
+	startBot := func(n *pbConfig.Network) error {
+		bot, err := NewIRCBot(n.GetName(), n.GetIrc(), n.GetChannels(), bufferGetter(n.GetName()), broadcaster)
+		if err != nil {
+			return err
 		}
-	}()
-
-	// Join channels on connect (handled in IRCBot or manually here?)
-	// girc has auto-join if configured, but let's do it manually or via callback.
-	// simpler: bot.Join(...) called after connect?
-	// Actually girc connect blocks. So we should configure it to auto-join or handle 001 event.
-	// Let's rely on the bot to handle rejoins if possible, or adds a handler for 001.
+		ctx, stop := context.WithCancel(context.Background())
+		go bot.Run(ctx)
+		bots[n.GetName()] = &runningBot{bot: bot, stop: stop}
+		grpcService.SetBot(n.GetName(), bot)
+		return nil
+	}
+	stopBot := func(name string) {
+		grpcService.SetBot(name, nil)
+		bots[name].close()
+		delete(bots, name)
+	}
+	for _, n := range networks {
+		if err := startBot(n); err != nil {
+			log.Fatalf("failed to set up IRC client for network %q: %v", n.GetName(), err)
+		}
+	}
 
 	// Start gRPC Server
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", config.GetService().GetHost(), config.GetService().GetPort()))
@@ -98,45 +176,26 @@ func main() {
 
 	// mTLS Configuration
 	tlsConfig := config.GetTls()
-	var opts []grpc.ServerOption
-
-	if tlsConfig != nil {
-		// Load CA
-		caCert, err := os.ReadFile(tlsConfig.GetCaFile())
-		if err != nil {
-			log.Fatalf("failed to read CA cert: %v", err)
-		}
-		caCertPool := x509.NewCertPool()
-		if !caCertPool.AppendCertsFromPEM(caCert) {
-			log.Fatalf("failed to append CA cert")
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpcService.UnaryAuth),
+		grpc.StreamInterceptor(grpcService.StreamAuth),
+	}
+	if config.GetService().GetClientPasskey() == "" && len(config.GetService().GetClientTokens()) == 0 {
+		if tlsConfig == nil {
+			log.Printf("WARNING: neither TLS nor client tokens are configured; any client that can connect is accepted")
+		} else {
+			log.Printf("No client tokens configured; clients are authenticated by certificate only")
 		}
+	}
 
-		// Load Server Cert/Key
-		serverCert, err := tls.LoadX509KeyPair(tlsConfig.GetCertFile(), tlsConfig.GetKeyFile())
+	var grpcTLS *serverTLS
+	if tlsConfig != nil {
+		grpcTLS, err = newServerTLS(tlsConfig)
 		if err != nil {
-			log.Fatalf("failed to load server keypair: %v", err)
-		}
-
-		// Create TLS Config
-		tConf := &tls.Config{
-			ClientCAs:    caCertPool,
-			ClientAuth:   tls.RequireAndVerifyClientCert,
-			Certificates: []tls.Certificate{serverCert},
-			VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-				// Check Client CN
-				// Note: verifiedChains[0][0] is the leaf certificate
-				if len(verifiedChains) > 0 && len(verifiedChains[0]) > 0 {
-					clientCert := verifiedChains[0][0]
-					expectedCN := tlsConfig.GetClientCn()
-					if clientCert.Subject.CommonName != expectedCN {
-						return fmt.Errorf("client CN %q does not match expected %q", clientCert.Subject.CommonName, expectedCN)
-					}
-				}
-				return nil
-			},
+			log.Fatalf("failed to set up TLS: %v", err)
 		}
-		creds := credentials.NewTLS(tConf)
-		opts = append(opts, grpc.Creds(creds))
+		grpcService.SetClientVerifier(grpcTLS.Clients())
+		opts = append(opts, grpc.Creds(credentials.NewTLS(grpcTLS.Config())))
 	}
 
 	grpcServer := grpc.NewServer(opts...)
@@ -150,6 +209,25 @@ func main() {
 		}
 	}()
 
+	// Optional listener for ordinary IRC clients
+	var ircLis net.Listener
+	if lc := config.GetIrcListener(); lc != nil {
+		ircLis, err = listenIRC(lc, grpcTLS)
+		if err != nil {
+			log.Fatalf("failed to start IRC listener: %v", err)
+		}
+		svc := config.GetService()
+		if svc.GetClientPasskey() == "" && len(svc.GetClientTokens()) == 0 {
+			log.Printf("WARNING: no client tokens configured; the IRC listener will turn every client away")
+		}
+		go func() {
+			log.Printf("Starting IRC listener on %s", ircLis.Addr())
+			if err := newIRCListener(grpcService, lc).serve(ircLis); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Fatalf("failed to serve IRC: %v", err)
+			}
+		}()
+	}
+
 	// Wait for shutdown signal or SIGHUP
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
@@ -164,33 +242,74 @@ func main() {
 				log.Printf("Failed to reload config: %v", err)
 				continue
 			}
+			newNetworks, err := configNetworks(newConfig)
+			if err != nil {
+				log.Printf("Failed to reload config: %v", err)
+				continue
+			}
+
+			// Disconnect from networks that went away before their
+			// history is closed.
+			netNames := make(map[string]bool)
+			for _, n := range newNetworks {
+				netNames[n.GetName()] = true
+			}
+			for name := range bots {
+				if !netNames[name] {
+					log.Printf("Disconnecting from network %q", name)
+					stopBot(name)
+				}
+			}
 
 			// Update History Buffers
 			// Strategy: Create new map. Copy existing buffers for channels that still exist.
 			// Create new buffers for new channels.
-			newHistBuffers := make(map[string]*history.ChannelBuffer)
+			histMu.Lock()
+			newHistBuffers := make(map[string]history.Store)
 
-			// Populate new map
-			for _, ch := range newConfig.GetChannels() {
-				name := ch.GetName()
-				if existing, ok := histBuffers[name]; ok {
-					// Update limit if changed?
-					// For now, simpler to just reuse existing buffer instance.
-					// If limit changed, we might need to resize. ChannelBuffer doesn't support resize yet.
-					// Assuming limit doesn't change often or we don't care about immediate resize.
-					newHistBuffers[name] = existing
+			// Queries are not in the config; keep those of the networks
+			// that are left.
+			for key := range queries {
+				if network, _ := splitHistoryKey(key); netNames[network] {
+					newHistBuffers[key] = histBuffers[key]
 				} else {
-					limit := int(ch.GetHistoryLimit())
-					if limit == 0 {
-						limit = 100
+					delete(queries, key)
+				}
+			}
+
+			// Populate new map
+			for _, n := range newNetworks {
+				for _, ch := range n.GetChannels() {
+					key := historyKey(n.GetName(), ch.GetName())
+					if existing, ok := histBuffers[key]; ok {
+						// Update limit if changed?
+						// For now, simpler to just reuse existing buffer instance.
+						// If limit changed, we might need to resize. ChannelBuffer doesn't support resize yet.
+						// Assuming limit doesn't change often or we don't care about immediate resize.
+						newHistBuffers[key] = existing
+					} else {
+						store, err := newHistoryStore(newConfig, n.GetName(), ch)
+						if err != nil {
+							log.Printf("Failed to open history for %s, keeping it in memory: %v", key, err)
+							store = history.NewChannelBuffer(historyLimit(ch))
+						}
+						newHistBuffers[key] = store
+					}
+				}
+			}
+
+			// Close stores of channels that went away.
+			for name, store := range histBuffers {
+				if _, ok := newHistBuffers[name]; !ok {
+					if err := store.Close(); err != nil {
+						log.Printf("Failed to close history for %s: %v", name, err)
 					}
-					newHistBuffers[name] = history.NewChannelBuffer(limit)
 				}
 			}
 
 			// Update global histBuffers ref for wrapper
-			histMu.Lock()
 			histBuffers = newHistBuffers
+			histConfig = newConfig
 			histMu.Unlock()
 			// Note: getBuffer closure captures the *variable* histBuffers if we didn't re-declare it?
 			// "getBuffer := func..." defined earlier closes over the variable.
@@ -215,7 +334,25 @@ func main() {
 
 			// Pass updates to Components
 			grpcService.UpdateState(newConfig.GetService(), histBuffers)
-			bot.UpdateChannels(newConfig.GetChannels())
+			if grpcTLS != nil && newConfig.GetTls() != nil {
+				if err := grpcTLS.reload(newConfig.GetTls()); err != nil {
+					log.Printf("Failed to reload TLS, keeping the old certificates: %v", err)
+				} else {
+					grpcService.SetClientVerifier(grpcTLS.Clients())
+				}
+			} else if (grpcTLS != nil) != (newConfig.GetTls() != nil) {
+				log.Printf("TLS can only be turned on or off with a restart")
+			}
+			for _, n := range newNetworks {
+				if rb := bots[n.GetName()]; rb != nil {
+					// Server settings only change on restart.
+					rb.bot.UpdateChannels(n.GetChannels())
+				} else if err := startBot(n); err != nil {
+					log.Printf("Failed to set up IRC client for network %q: %v", n.GetName(), err)
+				} else {
+					log.Printf("Connecting to new network %q", n.GetName())
+				}
+			}
 
 			log.Println("Configuration reloaded.")
 
@@ -226,6 +363,150 @@ func main() {
 	}
 
 	log.Println("Shutting down...")
-	bot.Close()
+	if ircLis != nil {
+		ircLis.Close()
+	}
+	for name := range bots {
+		stopBot(name)
+	}
 	grpcServer.GracefulStop()
+
+	histMu.Lock()
+	for name, store := range histBuffers {
+		if err := store.Close(); err != nil {
+			log.Printf("Failed to close history for %s: %v", name, err)
+		}
+	}
+	histMu.Unlock()
+}
+
+// listenIRC opens the IRC listener's socket, serving TLS with the gRPC
+// server's certificate if asked to.
+func listenIRC(lc *pbConfig.IRCListener, serverTLS *serverTLS) (net.Listener, error) {
+	port := lc.GetPort()
+	if port == 0 {
+		port = 6667
+		if lc.GetUseTls() {
+			port = 6697
+		}
+	}
+	addr := net.JoinHostPort(lc.GetHost(), strconv.Itoa(int(port)))
+	if !lc.GetUseTls() {
+		return net.Listen("tcp", addr)
+	}
+	if serverTLS == nil {
+		return nil, errors.New("use_tls needs the tls section for the server certificate")
+	}
+	return tls.Listen("tcp", addr, serverTLS.ListenerConfig())
+}
+
+// runningBot is the IRC client of a network and what stops it.
+type runningBot struct {
+	bot  *IRCBot
+	stop context.CancelFunc
+}
+
+func (r *runningBot) close() {
+	r.stop()
+	r.bot.Close()
+}
+
+// hashClientToken reads a token, one line, and returns its bcrypt hash.
+func hashClientToken(r io.Reader) (string, error) {
+	token, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read token: %v", err)
+	}
+	token = strings.TrimRight(token, "\r\n")
+	if token == "" {
+		return "", errors.New("empty token")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash token: %v", err)
+	}
+	return string(hash), nil
+}
+
+// historyLimit returns the configured history size of a channel.
+func historyLimit(ch *pbConfig.Channel) int {
+	limit := int(ch.GetHistoryLimit())
+	if limit == 0 {
+		limit = 100 // Default if 0? Or just 0.
+	}
+	return limit
+}
+
+// Query buffers open at once, unless max_queries says otherwise.
+const defaultMaxQueries = 100
+
+// queryToEvict returns the query, out of those open and when each was last
+// used, that has to be closed before another can be opened; "" if there is
+// room.
+func queryToEvict(queries map[string]time.Time, max int) string {
+	if max <= 0 {
+		max = defaultMaxQueries
+	}
+	if len(queries) < max {
+		return ""
+	}
+	var oldest string
+	for key, used := range queries {
+		if oldest == "" || used.Before(queries[oldest]) {
+			oldest = key
+		}
+	}
+	return oldest
+}
+
+// newQueryStore creates the history store for a private conversation with
+// peer on a network. Queries that can't be kept on disk are kept in memory.
+func newQueryStore(config *pbConfig.Config, network, peer string) history.Store {
+	ch := &pbConfig.Channel{
+		Name:         peer,
+		HistoryLimit: config.GetQueryHistoryLimit(),
+		Storage:      config.GetQueryStorage(),
+	}
+	store, err := newHistoryStore(config, network, ch)
+	if err != nil {
+		log.Printf("Failed to open history for query %s, keeping it in memory: %v", historyKey(network, peer), err)
+		return history.NewChannelBuffer(historyLimit(ch))
+	}
+	return store
+}
+
+// Directories in history_dir, and in a network's directory there, that no
+// network name or escaped channel name can take.
+const (
+	unnamedNetworkDir = "_default"
+	queriesDir        = "_queries"
+)
+
+// newHistoryStore creates the history store configured for a channel or
+// query of a network.
+func newHistoryStore(config *pbConfig.Config, network string, ch *pbConfig.Channel) (history.Store, error) {
+	switch ch.GetStorage() {
+	case pbConfig.HistoryStorage_HISTORY_DISK:
+		dir := config.GetHistoryDir()
+		if dir == "" {
+			dir = "history"
+		}
+		return history.OpenFileStore(historyPath(dir, network, ch.GetName()), historyLimit(ch))
+	default:
+		return history.NewChannelBuffer(historyLimit(ch)), nil
+	}
+}
+
+// historyPath returns where the history of a channel or query of a network
+// is kept in dir. Each network has a directory of its own, with its queries
+// in a directory apart from its channels.
+func historyPath(dir, network, name string) string {
+	if network == "" {
+		network = unnamedNetworkDir
+	}
+	// Channel names may contain characters that are awkward in paths.
+	if name == "" || !strings.ContainsRune(channelPrefixes, rune(name[0])) {
+		return filepath.Join(dir, network, queriesDir, url.PathEscape(name))
+	}
+	return filepath.Join(dir, network, url.PathEscape(name))
 }
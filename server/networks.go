@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lrstanley/girc"
+	"github.com/morrowc/irc-bot/server/history"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+// channelPrefixes are the characters channel names start with. Network names
+// can't start with them, so history keys can be told apart.
+const channelPrefixes = "#&+!"
+
+// configNetworks returns the networks in config. The top-level irc and
+// channels are a network with no name.
+func configNetworks(config *pbConfig.Config) ([]*pbConfig.Network, error) {
+	var nets []*pbConfig.Network
+	if config.GetIrc() != nil {
+		nets = append(nets, &pbConfig.Network{Irc: config.GetIrc(), Channels: config.GetChannels()})
+	} else if len(config.GetChannels()) > 0 {
+		return nil, errors.New("channels are set without irc; put them in a network")
+	}
+	nets = append(nets, config.GetNetworks()...)
+	if len(nets) == 0 {
+		return nil, errors.New("no IRC network configured")
+	}
+
+	seen := make(map[string]bool)
+	for _, n := range nets {
+		name := n.GetName()
+		if seen[name] {
+			if name == "" {
+				return nil, errors.New("only one network can be unnamed")
+			}
+			return nil, fmt.Errorf("network %q is configured twice", name)
+		}
+		seen[name] = true
+		// Names are used in history keys and paths, where those starting
+		// with "_" are reserved.
+		if strings.ContainsAny(name, "/ ") || name == "." || name == ".." || (name != "" && strings.ContainsRune(channelPrefixes+"_", rune(name[0]))) {
+			return nil, fmt.Errorf("invalid network name %q", name)
+		}
+		if n.GetIrc() == nil {
+			return nil, fmt.Errorf("network %q has no irc settings", name)
+		}
+	}
+	return nets, nil
+}
+
+// historyKey names the history of a channel or query: the channel itself on
+// the unnamed network, else "network/channel". Queries go by the folded nick,
+// since "Alice" and "alice" are the same person.
+func historyKey(network, channel string) string {
+	if channel != "" && !strings.ContainsRune(channelPrefixes, rune(channel[0])) {
+		channel = girc.ToRFC1459(channel)
+	}
+	if network == "" {
+		return channel
+	}
+	return network + "/" + channel
+}
+
+// splitHistoryKey undoes historyKey. Channels start with a prefix and nicks
+// can't contain "/", so a key with a "/" after something else is qualified.
+func splitHistoryKey(key string) (network, channel string) {
+	if key == "" || strings.ContainsRune(channelPrefixes, rune(key[0])) {
+		return "", key
+	}
+	if network, channel, ok := strings.Cut(key, "/"); ok {
+		return network, channel
+	}
+	return "", key
+}
+
+// eventKey returns the history key of the channel an event belongs to.
+func eventKey(ev *pbService.StreamEvent) string {
+	var network string
+	switch e := ev.GetEvent().(type) {
+	case *pbService.StreamEvent_Message:
+		network = e.Message.GetNetwork()
+	case *pbService.StreamEvent_ChannelEvent:
+		network = e.ChannelEvent.GetNetwork()
+	case *pbService.StreamEvent_SystemMessage:
+		network = e.SystemMessage.GetNetwork()
+	}
+	return historyKey(network, history.EventChannel(ev))
+}
+
+// setNetwork marks an event with the network it happened on.
+func setNetwork(ev *pbService.StreamEvent, network string) {
+	switch e := ev.GetEvent().(type) {
+	case *pbService.StreamEvent_Message:
+		e.Message.Network = network
+	case *pbService.StreamEvent_SystemMessage:
+		e.SystemMessage.Network = network
+	case *pbService.StreamEvent_ChannelEvent:
+		e.ChannelEvent.Network = network
+	case *pbService.StreamEvent_ChannelState:
+		e.ChannelState.Network = network
+	case *pbService.StreamEvent_SendQueue:
+		e.SendQueue.Network = network
+	}
+}
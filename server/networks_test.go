@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+func TestConfigNetworks(t *testing.T) {
+	irc := &pbConfig.IRCServer{Host: "irc.test.net"}
+	cfg := &pbConfig.Config{
+		Irc:      irc,
+		Channels: []*pbConfig.Channel{{Name: "#test"}},
+		Networks: []*pbConfig.Network{{Name: "libera", Irc: irc, Channels: []*pbConfig.Channel{{Name: "#go"}}}},
+	}
+	nets, err := configNetworks(cfg)
+	if err != nil {
+		t.Fatalf("configNetworks failed: %v", err)
+	}
+	if len(nets) != 2 || nets[0].GetName() != "" || nets[0].GetChannels()[0].GetName() != "#test" || nets[1].GetName() != "libera" {
+		t.Errorf("Expected the unnamed network then libera, got %v", nets)
+	}
+
+	bad := map[string]*pbConfig.Config{
+		"nothing":        {},
+		"channels only":  {Channels: cfg.Channels},
+		"two unnamed":    {Irc: irc, Networks: []*pbConfig.Network{{Irc: irc}}},
+		"duplicate":      {Networks: []*pbConfig.Network{{Name: "a", Irc: irc}, {Name: "a", Irc: irc}}},
+		"slash":          {Networks: []*pbConfig.Network{{Name: "a/b", Irc: irc}}},
+		"channel prefix": {Networks: []*pbConfig.Network{{Name: "#a", Irc: irc}}},
+		"dot dot":        {Networks: []*pbConfig.Network{{Name: "..", Irc: irc}}},
+		"reserved":       {Networks: []*pbConfig.Network{{Name: "_default", Irc: irc}}},
+		"no irc":         {Networks: []*pbConfig.Network{{Name: "a"}}},
+	}
+	for name, c := range bad {
+		if _, err := configNetworks(c); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestHistoryKey(t *testing.T) {
+	tests := []struct {
+		network, channel, key string
+	}{
+		{"", "#test", "#test"},
+		{"", "alice", "alice"},
+		{"libera", "#test", "libera/#test"},
+		{"libera", "alice", "libera/alice"},
+		{"", "#a/b", "#a/b"},
+		{"oftc", "#a/b", "oftc/#a/b"},
+	}
+	for _, tt := range tests {
+		if got := historyKey(tt.network, tt.channel); got != tt.key {
+			t.Errorf("historyKey(%q, %q) = %q, want %q", tt.network, tt.channel, got, tt.key)
+		}
+		if network, channel := splitHistoryKey(tt.key); network != tt.network || channel != tt.channel {
+			t.Errorf("splitHistoryKey(%q) = %q, %q, want %q, %q", tt.key, network, channel, tt.network, tt.channel)
+		}
+	}
+
+	// Queries go by the folded nick; channels keep their name.
+	if got := historyKey("libera", "Alice[m]"); got != "libera/alice{m}" {
+		t.Errorf("Expected the query key to be folded, got %q", got)
+	}
+	if got := historyKey("", "#Test"); got != "#Test" {
+		t.Errorf("Expected the channel key as configured, got %q", got)
+	}
+}
+
+func TestSetNetwork(t *testing.T) {
+	evs := []*pbService.StreamEvent{
+		messageEvent(&pbService.IRCMessage{}),
+		systemEvent(&pbService.SystemMessage{}),
+		channelStateEvent(&pbService.ChannelState{}),
+		sendQueueEvent(&pbService.SendQueueStatus{}),
+	}
+	for _, ev := range evs {
+		setNetwork(ev, "libera")
+	}
+	if evs[0].GetMessage().GetNetwork() != "libera" || evs[1].GetSystemMessage().GetNetwork() != "libera" ||
+		evs[2].GetChannelState().GetNetwork() != "libera" || evs[3].GetSendQueue().GetNetwork() != "libera" {
+		t.Errorf("Expected every event on libera, got %v", evs)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lrstanley/girc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+const defaultNickService = "NickServ"
+
+// How long our channels wait to be joined for NickServ to log us in.
+const identifyTimeout = 10 * time.Second
+
+const (
+	// Most nicks refused while registering before we give up on the
+	// connection, as the server may be refusing them for some other
+	// reason than that they are taken.
+	maxNickAttempts = 10
+	// Longest nick we make up where the server doesn't say: what servers
+	// typically allow.
+	defaultNickLen = 30
+)
+
+// checkNicks checks the nick settings of cfg.
+func checkNicks(cfg *pbConfig.IRCServer) error {
+	if !girc.IsValidNick(cfg.GetNick()) {
+		return fmt.Errorf("invalid nick %q", cfg.GetNick())
+	}
+	for _, nick := range cfg.GetAltNicks() {
+		if !girc.IsValidNick(nick) {
+			return fmt.Errorf("invalid alternate nick %q", nick)
+		}
+	}
+	if ns := cfg.GetNickserv(); ns != nil && ns.GetPassword() == "" {
+		return fmt.Errorf("nickserv is set without a password")
+	}
+	return nil
+}
+
+// nextNick returns the nick to try after rejected was refused at
+// registration: the next one configured, or rejected with "_" added. To
+// stay within maxLen, letters make way for the "_"s; once there are none
+// left to give up, it returns "".
+func nextNick(nicks []string, rejected string, maxLen int) string {
+	for i, nick := range nicks {
+		if girc.ToRFC1459(nick) == girc.ToRFC1459(rejected) && i+1 < len(nicks) {
+			return nicks[i+1]
+		}
+	}
+	base := strings.TrimRight(rejected, "_")
+	n := len(rejected) - len(base) + 1
+	if len(base)+n > maxLen {
+		if n >= maxLen {
+			return ""
+		}
+		base = base[:maxLen-n]
+	}
+	return base + strings.Repeat("_", n)
+}
+
+// nickLen returns the longest nick the server allows.
+func nickLen(c *girc.Client) int {
+	if n, ok := c.GetServerOptionInt("NICKLEN"); ok && n > 0 {
+		return n
+	}
+	return defaultNickLen
+}
+
+// handleNickInUse tries the next nick when ours is refused while
+// registering, up to maxNickAttempts; then we quit and Run tries again
+// later. Once registered, a refusal only means our nick isn't free yet; we
+// keep the one we have.
+func (b *IRCBot) handleNickInUse(c *girc.Client, e girc.Event) {
+	if len(e.Params) < 2 {
+		return
+	}
+	b.mu.Lock()
+	welcomed := b.welcomed
+	if !welcomed {
+		b.refused++
+	}
+	tries := b.refused
+	b.mu.Unlock()
+	if welcomed {
+		return
+	}
+	next := nextNick(b.nicks, e.Params[1], nickLen(c))
+	if next == "" || tries >= maxNickAttempts {
+		log.Printf("Nick %s is not available (%s); giving up after %d nicks", e.Params[1], e.Last(), tries)
+		b.systemMessage(fmt.Sprintf("No nick available after trying %d; will reconnect", tries))
+		c.Quit("No nick available")
+		return
+	}
+	log.Printf("Nick %s is not available (%s); trying %s", e.Params[1], e.Last(), next)
+	c.Cmd.Nick(next)
+}
+
+// handleWelcome notes that registration is over, and the nick the server
+// gave us.
+func (b *IRCBot) handleWelcome(c *girc.Client, e girc.Event) {
+	if len(e.Params) == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.welcomed = true
+	b.mu.Unlock()
+	b.nickChanged(e.Params[0])
+}
+
+// nickChanged tells clients when the bot's nick is no longer the one they
+// were last told about.
+func (b *IRCBot) nickChanged(nick string) {
+	b.mu.Lock()
+	if girc.ToRFC1459(nick) == girc.ToRFC1459(b.nick) {
+		b.mu.Unlock()
+		return
+	}
+	b.nick = nick
+	b.mu.Unlock()
+
+	content := fmt.Sprintf("Now known as %s", nick)
+	if primary := b.nicks[0]; girc.ToRFC1459(nick) != girc.ToRFC1459(primary) {
+		content += fmt.Sprintf(" (%s is taken)", primary)
+	}
+	log.Print(content)
+	b.broadcast(systemEvent(&pbService.SystemMessage{
+		Timestamp: timestamppb.Now(),
+		Content:   content,
+		Nick:      nick,
+	}))
+}
+
+// nickMessage tells a client that just attached what the bot's nick is,
+// nil while it has none.
+func (b *IRCBot) nickMessage() *pbService.SystemMessage {
+	if !b.client.IsConnected() {
+		return nil
+	}
+	nick := b.Nick()
+	return &pbService.SystemMessage{
+		Timestamp: timestamppb.Now(),
+		Content:   fmt.Sprintf("Nick is %s", nick),
+		Network:   b.network,
+		Nick:      nick,
+	}
+}
+
+// onPrimary reports whether the bot has its configured nick.
+func (b *IRCBot) onPrimary(c *girc.Client) bool {
+	return girc.ToRFC1459(c.GetNick()) == girc.ToRFC1459(b.nicks[0])
+}
+
+// claimNick logs in to NickServ, then sets about getting our nick back if
+// we had to take another one: through NickServ if it is set to recover the
+// nick, and by watching for it with MONITOR where the server has it.
+func (b *IRCBot) claimNick(c *girc.Client) {
+	ns := b.nickserv
+	if ns != nil {
+		c.Cmd.Message(b.nickService(), b.nickServCommand("IDENTIFY"))
+	}
+	if b.onPrimary(c) {
+		return
+	}
+
+	primary := b.nicks[0]
+	switch ns.GetRecover() {
+	case pbConfig.NickServ_GHOST:
+		c.Cmd.Message(b.nickService(), b.nickServCommand("GHOST"))
+		c.Cmd.Nick(primary)
+	case pbConfig.NickServ_REGAIN:
+		c.Cmd.Message(b.nickService(), b.nickServCommand("REGAIN"))
+	}
+	if hasMonitor(c) {
+		c.Send(&girc.Event{Command: "MONITOR", Params: []string{"+", primary}})
+	}
+}
+
+// joinChannels joins our channels, once NickServ has logged us in if we
+// identify to it: channels may let only our account in, or give it ops.
+// If it doesn't within identifyTimeout, they are joined anyway. Must be
+// called with b.mu held.
+func (b *IRCBot) joinChannels(c *girc.Client) {
+	if b.joinTimer != nil {
+		b.joinTimer.Stop()
+		b.joinTimer = nil
+	}
+	if b.nickserv == nil || b.account != "" {
+		b.sendJoins(c)
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(identifyTimeout, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.joinTimer != timer {
+			return
+		}
+		log.Printf("Not logged in to %s after %v; joining channels anyway", b.nickService(), identifyTimeout)
+		b.sendJoins(c)
+	})
+	b.joinTimer = timer
+}
+
+// sendJoins joins our channels. Must be called with b.mu held.
+func (b *IRCBot) sendJoins(c *girc.Client) {
+	if b.joinTimer != nil {
+		b.joinTimer.Stop()
+		b.joinTimer = nil
+	}
+	for ch, key := range b.channels {
+		c.Cmd.JoinKey(ch, key)
+	}
+}
+
+// nickService returns who NickServ is on this network.
+func (b *IRCBot) nickService() string {
+	if s := b.nickserv.GetService(); s != "" {
+		return s
+	}
+	return defaultNickService
+}
+
+// nickServCommands are the NickServ commands we send, which carry the
+// password.
+var nickServCommands = []string{"IDENTIFY", "GHOST", "REGAIN"}
+
+// nickServCommand returns the line we send NickServ for cmd: IDENTIFY
+// names our account, GHOST and REGAIN the nick we want back.
+func (b *IRCBot) nickServCommand(cmd string) string {
+	name := b.nicks[0]
+	if account := b.nickserv.GetAccount(); cmd == "IDENTIFY" && account != "" {
+		name = account
+	}
+	return fmt.Sprintf("%s %s %s", cmd, name, b.nickserv.GetPassword())
+}
+
+// secret reports whether e is one of the lines carrying our password that
+// we send NickServ, so that it is never kept in history.
+func (b *IRCBot) secret(e girc.Event) bool {
+	if b.nickserv.GetPassword() == "" || len(e.Params) < 2 || girc.ToRFC1459(e.Params[0]) != girc.ToRFC1459(b.nickService()) {
+		return false
+	}
+	for _, cmd := range nickServCommands {
+		if e.Last() == b.nickServCommand(cmd) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMonitor(c *girc.Client) bool {
+	_, ok := c.GetServerOption("MONITOR")
+	return ok
+}
+
+// handleMonOffline takes our nick as soon as MONITOR says it is free:
+// "731 <nick> :nick1!user@host,nick2".
+func (b *IRCBot) handleMonOffline(c *girc.Client, e girc.Event) {
+	if b.onPrimary(c) {
+		return
+	}
+	primary := girc.ToRFC1459(b.nicks[0])
+	for _, target := range strings.Split(e.Last(), ",") {
+		nick, _, _ := strings.Cut(target, "!")
+		if girc.ToRFC1459(nick) == primary {
+			c.Cmd.Nick(b.nicks[0])
+			return
+		}
+	}
+}
+
+// regainNick tries to get our nick back every regainEvery, unless MONITOR
+// tells us when to.
+func (b *IRCBot) regainNick(ctx context.Context) {
+	ticker := time.NewTicker(b.regainEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		b.mu.RLock()
+		welcomed := b.welcomed
+		b.mu.RUnlock()
+		c := b.client
+		if !welcomed || !c.IsConnected() || b.onPrimary(c) || hasMonitor(c) {
+			continue
+		}
+		c.Cmd.Nick(b.nicks[0])
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lrstanley/girc"
+	"github.com/morrowc/irc-bot/server/history"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+	pbService "github.com/morrowc/irc-bot/proto/service"
+)
+
+func TestNextNick(t *testing.T) {
+	nicks := []string{"bot", "bot2", "Bot3"}
+	tests := []struct {
+		rejected string
+		maxLen   int
+		want     string
+	}{
+		{"bot", 30, "bot2"},
+		{"BOT2", 30, "Bot3"},
+		{"bot3", 30, "bot3_"},
+		{"bot3_", 30, "bot3__"},
+		{"other", 30, "other_"},
+		// Letters make way for "_"s at the server's limit.
+		{"other", 5, "othe_"},
+		{"othe_", 5, "oth__"},
+		{"_____", 5, ""},
+	}
+	for _, tt := range tests {
+		if got := nextNick(nicks, tt.rejected, tt.maxLen); got != tt.want {
+			t.Errorf("nextNick(%q, %d) = %q, want %q", tt.rejected, tt.maxLen, got, tt.want)
+		}
+	}
+
+	if err := checkNicks(&pbConfig.IRCServer{Nick: "bad nick"}); err == nil {
+		t.Error("Expected an error for an invalid nick")
+	}
+	if err := checkNicks(&pbConfig.IRCServer{}); err == nil {
+		t.Error("Expected an error for a missing nick")
+	}
+	if err := checkNicks(&pbConfig.IRCServer{Nick: "bot", AltNicks: []string{"bad nick"}}); err == nil {
+		t.Error("Expected an error for an invalid alternate nick")
+	}
+	if err := checkNicks(&pbConfig.IRCServer{Nick: "bot", Nickserv: &pbConfig.NickServ{}}); err == nil {
+		t.Error("Expected an error for nickserv without a password")
+	}
+}
+
+// fakeNickServer has the first two nicks a client tries taken, offers
+// MONITOR, and passes on every line it receives. It tells the client when
+// the first nick is free, then lets it have it.
+func fakeNickServer(t *testing.T) (*pbConfig.Endpoint, <-chan string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		var nick string
+		var user bool
+		taken := map[string]bool{"testbot": true, "alt1": true}
+		// Registration is over once the client has a nick and has sent USER.
+		welcome := func() {
+			fmt.Fprintf(conn, ":irc.test 001 %s :Welcome\r\n", nick)
+			fmt.Fprintf(conn, ":irc.test 005 %s MONITOR=100 :are supported by this server\r\n", nick)
+		}
+		for sc.Scan() {
+			line := sc.Text()
+			lines <- line
+			switch {
+			case strings.HasPrefix(line, "NICK "):
+				want := strings.TrimPrefix(line, "NICK ")
+				switch {
+				case taken[want]:
+					target := nick
+					if target == "" {
+						target = "*"
+					}
+					fmt.Fprintf(conn, ":irc.test 433 %s %s :Nickname is already in use\r\n", target, want)
+				case nick == "":
+					nick = want
+					if user {
+						welcome()
+					}
+				default:
+					fmt.Fprintf(conn, ":%s!bot@example.com NICK %s\r\n", nick, want)
+					nick = want
+				}
+			case strings.HasPrefix(line, "USER "):
+				user = true
+				if nick != "" {
+					welcome()
+				}
+			case line == "MONITOR + testbot":
+				delete(taken, "testbot")
+				fmt.Fprintf(conn, ":irc.test 731 %s :testbot\r\n", nick)
+			}
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+	return &pbConfig.Endpoint{Host: "127.0.0.1", Port: int32(addr.Port)}, lines
+}
+
+func TestNickRegain(t *testing.T) {
+	srv, lines := fakeNickServer(t)
+	nicks := make(chan string, 10)
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{
+		Host:     srv.GetHost(),
+		Port:     srv.GetPort(),
+		Nick:     "testbot",
+		User:     "testbot",
+		AltNicks: []string{"alt1", "alt2"},
+		Nickserv: &pbConfig.NickServ{Password: "s3cret", Recover: pbConfig.NickServ_GHOST},
+	}, nil, func(string) history.Store { return nil }, func(ev *pbService.StreamEvent) {
+		if sm := ev.GetSystemMessage(); sm.GetNick() != "" {
+			nicks <- sm.GetNick() + ": " + sm.GetContent()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bot.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		bot.Close()
+		<-done
+	}()
+
+	// The alternates are tried in turn, and the nick comes back once the
+	// server says it is free. GHOST is followed by a NICK of its own, which
+	// is refused here.
+	want := []string{
+		"NICK testbot", "NICK alt1", "NICK alt2",
+		"PRIVMSG NickServ :IDENTIFY testbot s3cret",
+		"PRIVMSG NickServ :GHOST testbot s3cret",
+		"NICK testbot",
+		"MONITOR + testbot",
+		"NICK testbot",
+		"MONITOR - testbot",
+	}
+	var sent []string
+	deadline := time.After(10 * time.Second)
+	for len(sent) == 0 || sent[len(sent)-1] != want[len(want)-1] {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, "CAP ") && !strings.HasPrefix(line, "USER ") {
+				sent = append(sent, line)
+			}
+		case <-deadline:
+			t.Fatalf("Expected %q, got %q", want, sent)
+		}
+	}
+	if got := strings.Join(sent, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), got)
+	}
+
+	for _, w := range []string{"alt2: Now known as alt2 (testbot is taken)", "testbot: Now known as testbot"} {
+		select {
+		case n := <-nicks:
+			if n != w {
+				t.Errorf("Expected %q, got %q", w, n)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected %q", w)
+		}
+	}
+}
+
+func TestNickGivesUp(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	// The server refuses every nick.
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			line := sc.Text()
+			lines <- line
+			if nick, ok := strings.CutPrefix(line, "NICK "); ok {
+				fmt.Fprintf(conn, ":irc.test 433 * %s :Nickname is already in use\r\n", nick)
+			}
+			if strings.HasPrefix(line, "QUIT ") {
+				return
+			}
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{
+		Host:     "127.0.0.1",
+		Port:     int32(addr.Port),
+		Nick:     "testbot",
+		User:     "testbot",
+		AltNicks: []string{"alt1"},
+	}, nil, func(string) history.Store { return nil }, func(*pbService.StreamEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bot.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		bot.Close()
+		<-done
+	}()
+
+	var nicks []string
+	for deadline := time.After(5 * time.Second); ; {
+		select {
+		case line := <-lines:
+			if nick, ok := strings.CutPrefix(line, "NICK "); ok {
+				nicks = append(nicks, nick)
+			}
+			if !strings.HasPrefix(line, "QUIT ") {
+				continue
+			}
+		case <-deadline:
+			t.Fatalf("Expected to give up, tried %q", nicks)
+		}
+		break
+	}
+	if len(nicks) != maxNickAttempts || nicks[1] != "alt1" || nicks[2] != "alt1_" {
+		t.Errorf("Expected %d nicks, the alternate then made up ones, got %q", maxNickAttempts, nicks)
+	}
+}
+
+// fakeLoginServer registers a single client and passes on every line it
+// receives. Once the client has identified to NickServ, it logs it in when
+// login is closed.
+func fakeLoginServer(t *testing.T) (*pbConfig.Endpoint, <-chan string, chan<- struct{}) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	lines := make(chan string, 100)
+	login := make(chan struct{})
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case strings.HasPrefix(line, "USER "):
+				fmt.Fprint(conn, ":irc.test 001 testbot :Welcome\r\n")
+			case strings.HasPrefix(line, "PRIVMSG NickServ :IDENTIFY "):
+				go func() {
+					<-login
+					fmt.Fprint(conn, ":irc.test 900 testbot testbot!bot@example.com testbot :You are now logged in as testbot\r\n")
+				}()
+			}
+			lines <- line
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+	return &pbConfig.Endpoint{Host: "127.0.0.1", Port: int32(addr.Port)}, lines, login
+}
+
+func TestJoinAfterIdentify(t *testing.T) {
+	srv, lines, login := fakeLoginServer(t)
+	bot, err := NewIRCBot("", &pbConfig.IRCServer{
+		Host:     srv.GetHost(),
+		Port:     srv.GetPort(),
+		Nick:     "testbot",
+		User:     "testbot",
+		Nickserv: &pbConfig.NickServ{Password: "s3cret"},
+	}, []*pbConfig.Channel{{Name: "#test"}}, func(string) history.Store { return nil }, func(*pbService.StreamEvent) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bot.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		bot.Close()
+		<-done
+	}()
+
+	// Channels are joined once NickServ has logged us in, not before.
+	next := func(timeout time.Duration) string {
+		for {
+			select {
+			case line := <-lines:
+				if !strings.HasPrefix(line, "CAP ") && !strings.HasPrefix(line, "NICK ") && !strings.HasPrefix(line, "USER ") {
+					return line
+				}
+			case <-time.After(timeout):
+				return ""
+			}
+		}
+	}
+	if line := next(5 * time.Second); line != "PRIVMSG NickServ :IDENTIFY testbot s3cret" {
+		t.Fatalf("Expected IDENTIFY first, got %q", line)
+	}
+	if line := next(100 * time.Millisecond); line != "" {
+		t.Fatalf("Expected nothing until we are logged in, got %q", line)
+	}
+	close(login)
+	if line := next(2 * time.Second); !strings.HasPrefix(line, "JOIN #test") {
+		t.Errorf("Expected JOIN #test once logged in, got %q", line)
+	}
+}
+
+func TestHandleEcho_Secret(t *testing.T) {
+	var stored []*pbService.IRCMessage
+	bot := &IRCBot{
+		nicks:     []string{"testbot"},
+		nickserv:  &pbConfig.NickServ{Password: "s3cret"},
+		history:   func(string) history.Store { return nil },
+		broadcast: func(ev *pbService.StreamEvent) { stored = append(stored, ev.GetMessage()) },
+	}
+	me := &girc.Source{Name: "testbot"}
+	for _, line := range []string{"IDENTIFY testbot s3cret", "GHOST testbot s3cret", "REGAIN testbot s3cret"} {
+		bot.handleEcho(nil, girc.Event{Echo: true, Source: me, Command: girc.PRIVMSG, Params: []string{"nickserv", line}})
+	}
+	if len(stored) != 0 {
+		t.Errorf("Expected the password to stay out of history, got %v", stored)
+	}
+	// Only those lines: others that happen to contain the password are kept.
+	for _, p := range [][]string{{"NickServ", "INFO"}, {"NickServ", "INFO s3cret"}, {"#test", "IDENTIFY testbot s3cret"}} {
+		bot.handleEcho(nil, girc.Event{Echo: true, Source: me, Command: girc.PRIVMSG, Params: p})
+	}
+	if len(stored) != 3 || stored[0].GetChannel() != "NickServ" || stored[2].GetChannel() != "#test" {
+		t.Errorf("Expected other lines to be kept, got %v", stored)
+	}
+}
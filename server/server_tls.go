@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+// serverTLS provides the TLS config of the gRPC listener. Everything in it is
+// read from the files named in the config, and reload reads them again, so
+// certificates can be rotated or revoked without a restart.
+type serverTLS struct {
+	mu      sync.RWMutex
+	conf    *tls.Config
+	clients *clientVerifier
+}
+
+func newServerTLS(cfg *pbConfig.TLS) (*serverTLS, error) {
+	t := &serverTLS{}
+	if err := t.reload(cfg); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// reload reads the TLS files again. If anything is wrong with them, the
+// previous config stays in use.
+func (t *serverTLS) reload(cfg *pbConfig.TLS) error {
+	v, err := newClientVerifier(cfg)
+	if err != nil {
+		return err
+	}
+	serverCert, err := tls.LoadX509KeyPair(cfg.GetCertFile(), cfg.GetKeyFile())
+	if err != nil {
+		return fmt.Errorf("failed to load server keypair: %v", err)
+	}
+	conf := &tls.Config{
+		MinVersion:            tls.VersionTLS12,
+		ClientCAs:             v.roots,
+		ClientAuth:            tls.RequireAndVerifyClientCert,
+		Certificates:          []tls.Certificate{serverCert},
+		VerifyPeerCertificate: v.verifyPeer,
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conf = conf
+	t.clients = v
+	return nil
+}
+
+// Config returns the config to serve with. Each handshake uses whatever was
+// loaded last.
+func (t *serverTLS) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: t.configForClient,
+	}
+}
+
+func (t *serverTLS) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.conf, nil
+}
+
+// ListenerConfig returns the config for listeners whose clients don't present
+// certificates, like the IRC listener. It serves the server certificate that
+// was loaded last.
+func (t *serverTLS) ListenerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+			return &t.conf.Certificates[0], nil
+		},
+	}
+}
+
+// Clients returns the rules client certificates are currently checked by.
+func (t *serverTLS) Clients() *clientVerifier {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.clients
+}
+
+// clientVerifier decides whether a client certificate is accepted and who it
+// belongs to.
+type clientVerifier struct {
+	roots   *x509.CertPool
+	allow   *clientAllowList
+	crls    []*x509.RevocationList
+	revoked [][]byte // SHA-256 fingerprints
+}
+
+func newClientVerifier(cfg *pbConfig.TLS) (*clientVerifier, error) {
+	caPEM, err := os.ReadFile(cfg.GetCaFile())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA cert: %v", err)
+	}
+	var cas []*x509.Certificate
+	for rest := caPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CA cert: %v", err)
+		}
+		cas = append(cas, ca)
+	}
+	if len(cas) == 0 {
+		return nil, fmt.Errorf("no certificates found in CA file %s", cfg.GetCaFile())
+	}
+
+	v := &clientVerifier{roots: x509.NewCertPool()}
+	for _, ca := range cas {
+		v.roots.AddCert(ca)
+	}
+	if v.allow, err = newClientAllowList(cfg); err != nil {
+		return nil, err
+	}
+	for _, fp := range cfg.GetRevokedFingerprints() {
+		sum, err := parseFingerprint(fp)
+		if err != nil {
+			return nil, err
+		}
+		v.revoked = append(v.revoked, sum)
+	}
+	if crlFile := cfg.GetCrlFile(); crlFile != "" {
+		if v.crls, err = readCRLs(crlFile, cas); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// readCRLs reads the revocation lists in a PEM or DER file. Each must be
+// signed by one of the CAs.
+func readCRLs(path string, cas []*x509.Certificate) ([]*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CRL: %v", err)
+	}
+	var ders [][]byte
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = [][]byte{data}
+	}
+
+	var crls []*x509.RevocationList
+	for _, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CRL %s: %v", path, err)
+		}
+		signed := false
+		for _, ca := range cas {
+			if crl.CheckSignatureFrom(ca) == nil {
+				signed = true
+				break
+			}
+		}
+		if !signed {
+			return nil, fmt.Errorf("CRL %s is not signed by the CA", path)
+		}
+		crls = append(crls, crl)
+	}
+	return crls, nil
+}
+
+// verify checks a certificate chain as presented by a client, the leaf first,
+// and returns the name the client is allowed under.
+func (v *clientVerifier) verify(certs []*x509.Certificate) (string, error) {
+	if len(certs) == 0 {
+		return "", errors.New("no client certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	chains, err := certs[0].Verify(opts)
+	if err != nil {
+		return "", err
+	}
+	return v.check(chains[0])
+}
+
+// check returns the name a verified chain is allowed under, or why it isn't.
+func (v *clientVerifier) check(chain []*x509.Certificate) (string, error) {
+	for _, cert := range chain {
+		if err := v.checkRevoked(cert); err != nil {
+			return "", err
+		}
+	}
+	name, ok := v.allow.match(chain[0])
+	if !ok {
+		return "", errors.New("client certificate is not allowed")
+	}
+	return name, nil
+}
+
+func (v *clientVerifier) checkRevoked(cert *x509.Certificate) error {
+	sum := sha256.Sum256(cert.Raw)
+	for _, fp := range v.revoked {
+		if bytes.Equal(fp, sum[:]) {
+			return fmt.Errorf("certificate %q is revoked", cert.Subject.String())
+		}
+	}
+	for _, crl := range v.crls {
+		if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) {
+			continue
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return fmt.Errorf("certificate %q is revoked", cert.Subject.String())
+			}
+		}
+	}
+	return nil
+}
+
+// verifyPeer is the tls.Config.VerifyPeerCertificate callback. It runs after
+// the chain was verified against the CA.
+func (v *clientVerifier) verifyPeer(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		return errors.New("no verified client certificate")
+	}
+	if _, err := v.check(verifiedChains[0]); err != nil {
+		log.Printf("Rejected client %s: %v", describeCert(verifiedChains[0][0]), err)
+		return err
+	}
+	return nil
+}
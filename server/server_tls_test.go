@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate for name, usable by both clients and servers,
+// and its keypair.
+func (ca *testCA) issue(t *testing.T, name string, serial int64) (*x509.Certificate, tls.Certificate, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, pair, certPEM, keyPEM
+}
+
+// crl returns a PEM CRL revoking serials.
+func (ca *testCA) crl(t *testing.T, serials ...int64) []byte {
+	t.Helper()
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, s := range serials {
+		tmpl.RevokedCertificateEntries = append(tmpl.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber: big.NewInt(s), RevocationTime: time.Now(),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// handshake connects to a server using conf with the client certificate and
+// returns the server's error.
+func handshake(t *testing.T, conf *tls.Config, ca *testCA, client tls.Certificate) error {
+	t.Helper()
+	c, s := net.Pipe()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tc := tls.Client(c, &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{client}})
+		if tc.Handshake() == nil {
+			// Under TLS 1.3 the server checks the client's certificate
+			// after the client is done; wait for its verdict.
+			tc.Read(make([]byte, 1))
+		}
+		c.Close()
+	}()
+	err := tls.Server(s, conf).Handshake()
+	s.Close()
+	<-done
+	return err
+}
+
+func TestServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	_, _, serverPEM, serverKey := ca.issue(t, "localhost", 2)
+	laptop, laptopPair, _, _ := ca.issue(t, "laptop", 3)
+	phone, phonePair, _, _ := ca.issue(t, "phone", 4)
+	laptopSum := sha256.Sum256(laptop.Raw)
+
+	cfg := &pbConfig.TLS{
+		CaFile:   writeFile(t, dir, "ca.pem", ca.pem),
+		CertFile: writeFile(t, dir, "server.pem", serverPEM),
+		KeyFile:  writeFile(t, dir, "server.key", serverKey),
+	}
+	st, err := newServerTLS(cfg)
+	if err != nil {
+		t.Fatalf("newServerTLS failed: %v", err)
+	}
+	conf := st.Config()
+	if err := handshake(t, conf, ca, laptopPair); err != nil {
+		t.Errorf("Expected the laptop to be accepted, got %v", err)
+	}
+	if name, err := st.Clients().verify([]*x509.Certificate{laptop}); err != nil || name != "laptop" {
+		t.Errorf("Expected laptop, got %q %v", name, err)
+	}
+
+	// A revoked fingerprint takes effect on reload, for new connections.
+	cfg.RevokedFingerprints = []string{formatFingerprint(laptopSum[:])}
+	if err := st.reload(cfg); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if err := handshake(t, conf, ca, laptopPair); err == nil {
+		t.Error("Expected the revoked laptop to be rejected")
+	}
+	if err := handshake(t, conf, ca, phonePair); err != nil {
+		t.Errorf("Expected the phone to be accepted, got %v", err)
+	}
+
+	// So does a CRL.
+	cfg.CrlFile = writeFile(t, dir, "ca.crl", ca.crl(t, 4))
+	if err := st.reload(cfg); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if _, err := st.Clients().verify([]*x509.Certificate{phone}); err == nil {
+		t.Error("Expected the phone to be revoked by the CRL")
+	}
+
+	// Bad files leave the previous config in place.
+	bad := []*pbConfig.TLS{
+		{CaFile: cfg.CaFile, CertFile: cfg.CertFile, KeyFile: filepath.Join(dir, "missing.key")},
+		{CaFile: cfg.CaFile, CertFile: cfg.CertFile, KeyFile: cfg.KeyFile, CrlFile: writeFile(t, dir, "other.crl", newTestCA(t).crl(t))},
+		{CaFile: cfg.CaFile, CertFile: cfg.CertFile, KeyFile: cfg.KeyFile, RevokedFingerprints: []string{"abcd"}},
+	}
+	for _, b := range bad {
+		if err := st.reload(b); err == nil {
+			t.Errorf("Expected reload of %v to fail", b)
+		}
+	}
+	if _, err := st.Clients().verify([]*x509.Certificate{laptop}); err == nil {
+		t.Error("Expected the laptop to stay revoked")
+	}
+
+	// Certificates from another CA are never accepted.
+	_, otherPair, _, _ := newTestCA(t).issue(t, "laptop", 3)
+	if err := handshake(t, conf, ca, otherPair); err == nil {
+		t.Error("Expected a certificate from another CA to be rejected")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// outLine is one line of an outgoing message as it is sent to IRC.
+type outLine struct {
+	text string
+	// concat marks the rest of a line that was too long, as opposed to a
+	// line break in the original text.
+	concat bool
+}
+
+// splitText breaks text into lines of at most max bytes. Line breaks in text
+// start a new line and blank lines are dropped, since IRC can't carry them.
+// A line that is too long is split after the last space that fits, or between
+// two runes if a single word doesn't fit. The space stays at the end of the
+// first part, so the parts joined together give back the original line.
+func splitText(text string, max int) []outLine {
+	if max < utf8.UTFMax {
+		max = utf8.UTFMax
+	}
+	text = strings.ToValidUTF8(text, "\uFFFD")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var lines []outLine
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		concat := false
+		for len(line) > max {
+			cut := strings.LastIndexByte(line[:max], ' ') + 1
+			if cut <= 1 {
+				cut = max
+				for !utf8.RuneStart(line[cut]) {
+					cut--
+				}
+			}
+			lines = append(lines, outLine{text: line[:cut], concat: concat})
+			line = line[cut:]
+			concat = true
+		}
+		lines = append(lines, outLine{text: line, concat: concat})
+	}
+	return lines
+}
+
+// multilineLimits are the draft/multiline limits a server advertises. Zero
+// means no limit.
+type multilineLimits struct {
+	maxBytes int
+	maxLines int
+}
+
+// parseMultilineCap reads the value of the draft/multiline capability, e.g.
+// "max-bytes=4096,max-lines=24".
+func parseMultilineCap(value string) multilineLimits {
+	var l multilineLimits
+	for _, kv := range strings.Split(value, ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			continue
+		}
+		switch k {
+		case "max-bytes":
+			l.maxBytes = n
+		case "max-lines":
+			l.maxLines = n
+		}
+	}
+	return l
+}
+
+// batchLines groups lines into batches within the server's limits. A batch's
+// size is the text of its lines plus a line break before each line that
+// doesn't continue the previous one.
+func batchLines(lines []outLine, l multilineLimits) [][]outLine {
+	var batches [][]outLine
+	var cur []outLine
+	size := 0
+	for _, line := range lines {
+		n := len(line.text)
+		if len(cur) > 0 && !line.concat {
+			n++
+		}
+		if len(cur) > 0 && ((l.maxBytes > 0 && size+n > l.maxBytes) || (l.maxLines > 0 && len(cur) >= l.maxLines)) {
+			batches = append(batches, cur)
+			cur, size = nil, 0
+			n = len(line.text)
+		}
+		cur = append(cur, line)
+		size += n
+	}
+	if len(cur) > 0 {
+		batches = append(batches, cur)
+	}
+	return batches
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		desc string
+		text string
+		max  int
+		want []outLine
+	}{
+		{"fits", "hello world", 20, []outLine{{"hello world", false}}},
+		{"word boundary", "hello big world", 10, []outLine{{"hello big ", false}, {"world", true}}},
+		{"long word", "abcdefghij", 4, []outLine{{"abcd", false}, {"efgh", true}, {"ij", true}}},
+		{"line breaks", "one\r\ntwo\n\nthree\r", 10, []outLine{{"one", false}, {"two", false}, {"three", false}}},
+		{"rune boundary", "ééééé", 5, []outLine{{"éé", false}, {"éé", true}, {"é", true}}},
+		{"leading space", " abcdefgh", 5, []outLine{{" abcd", false}, {"efgh", true}}},
+		{"invalid UTF-8", "a\xffb", 10, []outLine{{"a\uFFFDb", false}}},
+	}
+	for _, tt := range tests {
+		if got := splitText(tt.text, tt.max); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.desc, got, tt.want)
+		}
+	}
+
+	// A long paragraph comes back whole when the parts are joined.
+	text := strings.Repeat("ünïcödé wörds ", 100)
+	var joined strings.Builder
+	for _, line := range splitText(text, 50) {
+		if len(line.text) > 50 || !utf8.ValidString(line.text) {
+			t.Errorf("Bad line %q", line.text)
+		}
+		joined.WriteString(line.text)
+	}
+	if joined.String() != text {
+		t.Errorf("Joined lines differ from the original:\n%q\n%q", joined.String(), text)
+	}
+}
+
+func TestParseMultilineCap(t *testing.T) {
+	if got := parseMultilineCap("max-bytes=4096,max-lines=24"); got != (multilineLimits{maxBytes: 4096, maxLines: 24}) {
+		t.Errorf("Unexpected limits %+v", got)
+	}
+	if got := parseMultilineCap("max-bytes=x,other"); got != (multilineLimits{}) {
+		t.Errorf("Expected no limits, got %+v", got)
+	}
+}
+
+func TestBatchLines(t *testing.T) {
+	lines := []outLine{{"aaaa", false}, {"bbbb", true}, {"cccc", false}, {"dd", false}}
+
+	// "aaaa" + "bbbb" + "\ncccc" is 13 bytes.
+	got := batchLines(lines, multilineLimits{maxBytes: 13})
+	if len(got) != 2 || len(got[0]) != 3 || len(got[1]) != 1 {
+		t.Errorf("Expected batches of 3 and 1 lines, got %+v", got)
+	}
+	got = batchLines(lines, multilineLimits{maxLines: 3})
+	if len(got) != 2 || len(got[0]) != 3 {
+		t.Errorf("Expected batches of 3 and 1 lines, got %+v", got)
+	}
+	if got := batchLines(lines, multilineLimits{}); len(got) != 1 {
+		t.Errorf("Expected a single batch without limits, got %+v", got)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+// upstreamVerifier checks the IRC server's certificate. It replaces the
+// standard verification so that pinned fingerprints can be honoured and a
+// failure can name the certificate that was presented.
+type upstreamVerifier struct {
+	roots        *x509.CertPool // nil means the system roots
+	fingerprints [][]byte
+	insecure     bool
+	// report is told about verification failures, which otherwise only
+	// show up as a failed connection.
+	report func(msg string)
+}
+
+// newUpstreamTLSConfig builds the TLS config for the IRC connection. Run sets
+// ServerName for each server it tries.
+func newUpstreamTLSConfig(cfg *pbConfig.UpstreamTLS) (*tls.Config, *upstreamVerifier, error) {
+	v := &upstreamVerifier{insecure: cfg.GetInsecureSkipVerify()}
+
+	if caFile := cfg.GetCaFile(); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read IRC CA file: %v", err)
+		}
+		v.roots = x509.NewCertPool()
+		if !v.roots.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in IRC CA file %s", caFile)
+		}
+	}
+
+	for _, fp := range cfg.GetFingerprints() {
+		sum, err := parseFingerprint(fp)
+		if err != nil {
+			return nil, nil, err
+		}
+		v.fingerprints = append(v.fingerprints, sum)
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	if cfg.GetMinVersion() == pbConfig.TLSVersion_TLS_1_3 {
+		minVersion = tls.VersionTLS13
+	}
+
+	return &tls.Config{
+		MinVersion: minVersion,
+		// verify does the checks instead; see upstreamVerifier.
+		InsecureSkipVerify: true,
+		VerifyConnection:   v.verify,
+	}, v, nil
+}
+
+func (v *upstreamVerifier) verify(cs tls.ConnectionState) error {
+	if v.insecure {
+		return nil
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	leaf := cs.PeerCertificates[0]
+
+	var err error
+	if len(v.fingerprints) > 0 {
+		err = v.checkFingerprint(leaf)
+	} else {
+		opts := x509.VerifyOptions{
+			Roots:         v.roots,
+			DNSName:       cs.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err = leaf.Verify(opts)
+	}
+	if err != nil {
+		err = fmt.Errorf("TLS verification of %s failed: %v (presented %s)", cs.ServerName, err, describeCert(leaf))
+		if v.report != nil {
+			v.report(err.Error())
+		}
+	}
+	return err
+}
+
+func (v *upstreamVerifier) checkFingerprint(cert *x509.Certificate) error {
+	sum := sha256.Sum256(cert.Raw)
+	for _, fp := range v.fingerprints {
+		if bytes.Equal(fp, sum[:]) {
+			return nil
+		}
+	}
+	return errors.New("certificate does not match any pinned fingerprint")
+}
+
+// describeCert names a certificate well enough to decide whether to trust it.
+func describeCert(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return fmt.Sprintf("certificate %q issued by %q, valid until %s, SHA-256 %s",
+		cert.Subject.String(), cert.Issuer.String(), cert.NotAfter.Format("2006-01-02"), formatFingerprint(sum[:]))
+}
+
+// parseFingerprint reads a SHA-256 fingerprint in hex, with or without
+// colons.
+func parseFingerprint(fp string) ([]byte, error) {
+	sum, err := hex.DecodeString(strings.ReplaceAll(fp, ":", ""))
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("invalid SHA-256 fingerprint %q", fp)
+	}
+	return sum, nil
+}
+
+// formatFingerprint renders a hash as colon separated hex, e.g. "AB:CD:...".
+func formatFingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pbConfig "github.com/morrowc/irc-bot/proto/config"
+)
+
+// selfSignedCert returns a self-signed certificate for host and its PEM.
+func selfSignedCert(t *testing.T, host string) (*x509.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestUpstreamVerifier(t *testing.T) {
+	cert, certPEM := selfSignedCert(t, "irc.test")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(cert.Raw)
+	other := sha256.Sum256([]byte("other"))
+
+	tests := []struct {
+		desc    string
+		cfg     *pbConfig.UpstreamTLS
+		host    string
+		wantErr bool
+	}{
+		{"system roots", nil, "irc.test", true},
+		{"custom CA", &pbConfig.UpstreamTLS{CaFile: caFile}, "irc.test", false},
+		{"custom CA, wrong host", &pbConfig.UpstreamTLS{CaFile: caFile}, "irc.other", true},
+		{"pinned", &pbConfig.UpstreamTLS{Fingerprints: []string{formatFingerprint(sum[:])}}, "irc.other", false},
+		{"pinned, plain hex", &pbConfig.UpstreamTLS{Fingerprints: []string{hex.EncodeToString(sum[:])}}, "irc.test", false},
+		{"pinned other", &pbConfig.UpstreamTLS{Fingerprints: []string{hex.EncodeToString(other[:])}}, "irc.test", true},
+		{"insecure", &pbConfig.UpstreamTLS{InsecureSkipVerify: true}, "irc.other", false},
+	}
+	for _, tt := range tests {
+		tc, v, err := newUpstreamTLSConfig(tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: newUpstreamTLSConfig failed: %v", tt.desc, err)
+		}
+		var reported string
+		v.report = func(msg string) { reported = msg }
+
+		err = tc.VerifyConnection(tls.ConnectionState{ServerName: tt.host, PeerCertificates: []*x509.Certificate{cert}})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got err %v, want error %v", tt.desc, err, tt.wantErr)
+		}
+		// Failures name the certificate so it can be pinned or trusted.
+		if tt.wantErr && (!strings.Contains(reported, "CN=irc.test") || !strings.Contains(reported, formatFingerprint(sum[:]))) {
+			t.Errorf("%s: expected the presented certificate in %q", tt.desc, reported)
+		}
+	}
+}
+
+func TestNewUpstreamTLSConfig(t *testing.T) {
+	tc, _, err := newUpstreamTLSConfig(&pbConfig.UpstreamTLS{MinVersion: pbConfig.TLSVersion_TLS_1_3})
+	if err != nil || tc.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3 minimum, got %v (err %v)", tc, err)
+	}
+	if tc, _, _ := newUpstreamTLSConfig(nil); tc.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2 minimum by default, got %x", tc.MinVersion)
+	}
+	if _, _, err := newUpstreamTLSConfig(&pbConfig.UpstreamTLS{Fingerprints: []string{"abcd"}}); err == nil {
+		t.Error("Expected an error for a short fingerprint")
+	}
+	if _, _, err := newUpstreamTLSConfig(&pbConfig.UpstreamTLS{CaFile: "nope.pem"}); err == nil {
+		t.Error("Expected an error for a missing CA file")
+	}
+}